@@ -1,5 +1,6 @@
 #!/usr/bin/env python3
 
+import os
 from typing import Dict, List
 
 import yaml
@@ -40,9 +41,10 @@ class Config:
 
         for name in self.provider:
             if name == 'datadog':
+                # keys given by keysFrom are set as environment variables
                 return datadog.Datadog(
-                    apikey=self.provider[name]['apikey'],
-                    appkey=self.provider[name]['appkey']
+                    apikey=self.provider[name].get('apikey') or os.environ.get('APIKey', ''),
+                    appkey=self.provider[name].get('appkey') or os.environ.get('APPKey', '')
                 )
         return None
 
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 SIA Platform Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// V1beta2SpecAnnotation keeps the v1beta2 spec on v1beta1 objects
+	// for restoring fields which cannot be represented in v1beta1.
+	V1beta2SpecAnnotation = "ihpa.ake.cyberagent.co.jp/v1beta2-spec"
+
+	// V1beta1JobTemplateAnnotation keeps the job template of v1beta1 FittingJob on v1beta2 objects
+	// for restoring fields which cannot be represented by JobPatchSpec.
+	V1beta1JobTemplateAnnotation = "ihpa.ake.cyberagent.co.jp/v1beta1-job-template"
+
+	// estimationModeNone in v1beta1 is called "raw" in v1beta2.
+	estimationModeNone = "none"
+	estimatorModeRaw   = "raw"
+	// estimatorModeFloor does not exist in v1beta1, and it is represented as "adjust"
+	// because forecasted metrics are adjusted in the same way.
+	estimationModeAdjust = "adjust"
+	estimatorModeFloor   = "floor"
+)
+
+// marshalConversionData stores v as json into the annotation of obj.
+func marshalConversionData(obj metav1.Object, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversion data: %w", err)
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = string(data)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// unmarshalConversionData restores v from the annotation of obj and removes the annotation.
+// It returns false if the annotation does not exist.
+func unmarshalConversionData(obj metav1.Object, key string, v interface{}) (bool, error) {
+	annotations := obj.GetAnnotations()
+	data, ok := annotations[key]
+	if !ok {
+		return false, nil
+	}
+	delete(annotations, key)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return false, fmt.Errorf("failed to unmarshal conversion data: %w", err)
+	}
+	return true, nil
+}
+
+func convertEstimationModeToV1beta2(mode string) string {
+	if mode == estimationModeNone {
+		return estimatorModeRaw
+	}
+	return mode
+}
+
+func convertEstimationModeFromV1beta2(mode string) string {
+	switch mode {
+	case estimatorModeRaw:
+		return estimationModeNone
+	case estimatorModeFloor:
+		return estimationModeAdjust
+	}
+	return mode
+}
+
+func convertChangePointDetectionConfigToV1beta2(src *ChangePointDetectionConfig) v1beta2.ChangePointDetectionConfig {
+	return v1beta2.ChangePointDetectionConfig{
+		PercentageThreshold: src.PercentageThreshold,
+		WindowSize:          src.WindowSize,
+		TrajectoryRows:      src.TrajectoryRows,
+		TrajectoryFeatures:  src.TrajectoryFeatures,
+		TestRows:            src.TestRows,
+		TestFeatures:        src.TestFeatures,
+		Lag:                 src.Lag,
+	}
+}
+
+func convertChangePointDetectionConfigFromV1beta2(src *v1beta2.ChangePointDetectionConfig) ChangePointDetectionConfig {
+	return ChangePointDetectionConfig{
+		PercentageThreshold: src.PercentageThreshold,
+		WindowSize:          src.WindowSize,
+		TrajectoryRows:      src.TrajectoryRows,
+		TrajectoryFeatures:  src.TrajectoryFeatures,
+		TestRows:            src.TestRows,
+		TestFeatures:        src.TestFeatures,
+		Lag:                 src.Lag,
+	}
+}
+
+// convertMetricProviderToV1beta2 converts MetricProvider.
+// Prometheus fields are restored from restored if it is given because v1beta1 has no Prometheus field.
+func convertMetricProviderToV1beta2(src *MetricProvider, restored *v1beta2.MetricProvider) v1beta2.MetricProvider {
+	dst := v1beta2.MetricProvider{Name: src.Name}
+	if src.Datadog != nil {
+		dst.Datadog = &v1beta2.DatadogProviderSource{
+			APIKey:   src.Datadog.APIKey,
+			APPKey:   src.Datadog.APPKey,
+			KeysFrom: src.Datadog.KeysFrom,
+		}
+	}
+	if src.Prometheus != nil {
+		dst.Prometheus = &v1beta2.PrometheusProviderSource{}
+		if restored != nil && restored.Prometheus != nil {
+			dst.Prometheus = restored.Prometheus
+		}
+	}
+	return dst
+}
+
+func convertMetricProviderFromV1beta2(src *v1beta2.MetricProvider) MetricProvider {
+	dst := MetricProvider{Name: src.Name}
+	if src.Datadog != nil {
+		dst.Datadog = &DatadogProviderSource{
+			APIKey:   src.Datadog.APIKey,
+			APPKey:   src.Datadog.APPKey,
+			KeysFrom: src.Datadog.KeysFrom,
+		}
+	}
+	if src.Prometheus != nil {
+		dst.Prometheus = &PrometheusProviderSource{}
+	}
+	return dst
+}
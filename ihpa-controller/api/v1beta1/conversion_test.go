@@ -0,0 +1,346 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testMetricSpecs() []autoscalingv2beta2.MetricSpec {
+	return []autoscalingv2beta2.MetricSpec{
+		{
+			Type: autoscalingv2beta2.ResourceMetricSourceType,
+			Resource: &autoscalingv2beta2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:               autoscalingv2beta2.UtilizationMetricType,
+					AverageUtilization: func(i int32) *int32 { return &i }(50),
+				},
+			},
+		},
+		{
+			Type: autoscalingv2beta2.ExternalMetricSourceType,
+			External: &autoscalingv2beta2.ExternalMetricSource{
+				Metric: autoscalingv2beta2.MetricIdentifier{Name: "nginx.net.request_per_s"},
+				Target: autoscalingv2beta2.MetricTarget{Type: autoscalingv2beta2.AverageValueMetricType},
+			},
+		},
+	}
+}
+
+func testIHPAV1beta1() *IntelligentHorizontalPodAutoscaler {
+	metrics := testMetricSpecs()
+	return &IntelligentHorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec: IntelligentHorizontalPodAutoscalerSpec{
+			HorizontalPodAutoscalerTemplate: HorizontalPodAutoscalerTemplateSpec{
+				Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx"},
+					MaxReplicas:    5,
+					Metrics:        metrics,
+				},
+			},
+			EstimationGapMinutes: 5,
+			EstimationMode:       "none",
+			FittingJobConfig: FittingJobConfig{
+				Seasonality:        "daily",
+				ExecuteOn:          12,
+				Image:              "your-job-image:v1",
+				ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "pull-secret"}},
+				ServiceAccountName: "ihpa-configmap-rw",
+			},
+			MetricProvider: MetricProvider{
+				Name:           "datadog",
+				ProviderSource: ProviderSource{Datadog: &DatadogProviderSource{APIKey: "xxx", APPKey: "yyy"}},
+			},
+		},
+	}
+}
+
+func testIHPAV1beta2() *v1beta2.IntelligentHorizontalPodAutoscaler {
+	metrics := testMetricSpecs()
+	return &v1beta2.IntelligentHorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec: v1beta2.IntelligentHorizontalPodAutoscalerSpec{
+			HorizontalPodAutoscalerTemplate: v1beta2.ExtendedHorizontalPodAutoscalerTemplateSpec{
+				Spec: v1beta2.ExtendedHorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx"},
+					MaxReplicas:    5,
+					Metrics: []v1beta2.ExtendedMetricSpec{
+						{
+							Type:     metrics[0].Type,
+							Resource: metrics[0].Resource,
+							FittingJobPatchSpec: v1beta2.FittingJobPatchSpec{
+								JobPatchSpec: v1beta2.JobPatchSpec{Image: "your-job-image:v1"},
+								Seasonality:  "daily",
+								ExecuteOn:    12,
+							},
+						},
+						{
+							Type:     metrics[1].Type,
+							External: metrics[1].External,
+							FittingJobPatchSpec: v1beta2.FittingJobPatchSpec{
+								JobPatchSpec: v1beta2.JobPatchSpec{
+									Image:        "your-job-image:v2",
+									NodeSelector: map[string]string{"role": "batch"},
+								},
+								Seasonality:  "weekly",
+								ExecuteOn:    3,
+								CustomConfig: `{"custom":1}`,
+							},
+						},
+					},
+					Behavior: &v1beta2.HorizontalPodAutoscalerBehavior{
+						ScaleDown: &v1beta2.HPAScalingRules{
+							StabilizationWindowSeconds: func(i int32) *int32 { return &i }(600),
+							Policies: []v1beta2.HPAScalingPolicy{
+								{Type: v1beta2.PodsScalingPolicy, Value: 1, PeriodSeconds: 60},
+							},
+						},
+					},
+				},
+			},
+			EstimatorPatchSpec: v1beta2.EstimatorPatchSpec{Mode: "raw", GapMinutes: 10},
+			ScheduledOverrides: []v1beta2.ScheduledOverride{
+				{
+					Name:            "campaign",
+					Schedule:        "0 20 * * 5",
+					DurationMinutes: 60,
+					TimeZone:        "Asia/Tokyo",
+					MinReplicas:     func(i int32) *int32 { return &i }(10),
+				},
+			},
+			Shadow:       true,
+			Paused:       true,
+			PausedReason: "incident",
+			MetricProvider: v1beta2.MetricProvider{
+				Name: "prometheus",
+				ProviderSource: v1beta2.ProviderSource{
+					Prometheus: &v1beta2.PrometheusProviderSource{URL: "http://prometheus.monitoring.svc:9090"},
+				},
+			},
+		},
+	}
+}
+
+func TestIntelligentHorizontalPodAutoscalerConvertTo(t *testing.T) {
+	src := testIHPAV1beta1()
+	dst := &v1beta2.IntelligentHorizontalPodAutoscaler{}
+	if err := src.ConvertTo(dst); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFittingJob := v1beta2.FittingJobPatchSpec{
+		JobPatchSpec: v1beta2.JobPatchSpec{
+			Image:              "your-job-image:v1",
+			ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "pull-secret"}},
+			ServiceAccountName: "ihpa-configmap-rw",
+		},
+		Seasonality: "daily",
+		ExecuteOn:   12,
+	}
+	metrics := dst.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("number of metrics is not match (got=%d, exp=%d)", len(metrics), 2)
+	}
+	for _, m := range metrics {
+		if !reflect.DeepEqual(m.FittingJobPatchSpec, expectedFittingJob) {
+			t.Fatalf("fittingjob patch spec is not match (got=%v, exp=%v)", m.FittingJobPatchSpec, expectedFittingJob)
+		}
+	}
+	expectedEstimator := v1beta2.EstimatorPatchSpec{Mode: "raw", GapMinutes: 5}
+	if !reflect.DeepEqual(dst.Spec.EstimatorPatchSpec, expectedEstimator) {
+		t.Fatalf("estimator patch spec is not match (got=%v, exp=%v)", dst.Spec.EstimatorPatchSpec, expectedEstimator)
+	}
+
+	// converting back without any change
+	restored := &IntelligentHorizontalPodAutoscaler{}
+	if err := restored.ConvertFrom(dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, src) {
+		t.Fatalf("restored ihpa is not match (got=%v, exp=%v)", restored, src)
+	}
+}
+
+func TestIntelligentHorizontalPodAutoscalerConvertFrom(t *testing.T) {
+	tests := []struct {
+		modify   func(*IntelligentHorizontalPodAutoscaler)
+		expected func(*v1beta2.IntelligentHorizontalPodAutoscaler)
+	}{
+		{
+			// lossless round trip
+			modify:   func(*IntelligentHorizontalPodAutoscaler) {},
+			expected: func(*v1beta2.IntelligentHorizontalPodAutoscaler) {},
+		},
+		{
+			// fields in v1beta1 are changed, but fields only in v1beta2 are kept
+			modify: func(ihpa *IntelligentHorizontalPodAutoscaler) {
+				ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.MaxReplicas = 10
+				ihpa.Spec.FittingJobConfig.ExecuteOn = 6
+			},
+			expected: func(ihpa *v1beta2.IntelligentHorizontalPodAutoscaler) {
+				ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.MaxReplicas = 10
+				metrics := ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics
+				for i := range metrics {
+					metrics[i].FittingJobPatchSpec.Seasonality = "daily"
+					metrics[i].FittingJobPatchSpec.ExecuteOn = 6
+					metrics[i].FittingJobPatchSpec.Image = "your-job-image:v1"
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		src := testIHPAV1beta2()
+		mid := &IntelligentHorizontalPodAutoscaler{}
+		if err := mid.ConvertFrom(src); err != nil {
+			t.Fatal(err)
+		}
+		if mid.Spec.EstimationMode != "none" {
+			t.Fatalf("estimation mode is not match (got=%s, exp=%s)", mid.Spec.EstimationMode, "none")
+		}
+		if _, ok := mid.Annotations[V1beta2SpecAnnotation]; !ok {
+			t.Fatalf("annotation %s is not found", V1beta2SpecAnnotation)
+		}
+		if _, ok := src.Annotations[V1beta2SpecAnnotation]; ok {
+			t.Fatalf("annotation of source is changed")
+		}
+		tt.modify(mid)
+
+		got := &v1beta2.IntelligentHorizontalPodAutoscaler{}
+		if err := mid.ConvertTo(got); err != nil {
+			t.Fatal(err)
+		}
+		expected := testIHPAV1beta2()
+		tt.expected(expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("converted ihpa is not match (got=%v, exp=%v)", got, expected)
+		}
+	}
+}
+
+func TestFloorModeConversion(t *testing.T) {
+	src := testIHPAV1beta2()
+	src.Spec.EstimatorPatchSpec = v1beta2.EstimatorPatchSpec{Mode: "floor", GapMinutes: 10, FloorMaxStep: 3}
+
+	mid := &IntelligentHorizontalPodAutoscaler{}
+	if err := mid.ConvertFrom(src); err != nil {
+		t.Fatal(err)
+	}
+	if mid.Spec.EstimationMode != "adjust" {
+		t.Fatalf("estimation mode is not match (got=%s, exp=%s)", mid.Spec.EstimationMode, "adjust")
+	}
+
+	got := &v1beta2.IntelligentHorizontalPodAutoscaler{}
+	if err := mid.DeepCopy().ConvertTo(got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Spec.EstimatorPatchSpec, src.Spec.EstimatorPatchSpec) {
+		t.Fatalf("estimator patch spec is not match (got=%v, exp=%v)", got.Spec.EstimatorPatchSpec, src.Spec.EstimatorPatchSpec)
+	}
+
+	// floor mode is dropped when the mode is changed in v1beta1
+	mid.Spec.EstimationMode = "none"
+	if err := mid.ConvertTo(got); err != nil {
+		t.Fatal(err)
+	}
+	expected := v1beta2.EstimatorPatchSpec{Mode: "raw", GapMinutes: 10}
+	if !reflect.DeepEqual(got.Spec.EstimatorPatchSpec, expected) {
+		t.Fatalf("estimator patch spec is not match (got=%v, exp=%v)", got.Spec.EstimatorPatchSpec, expected)
+	}
+}
+
+func TestFittingJobConversion(t *testing.T) {
+	v1beta1Sample := &FittingJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "fittingjob", Namespace: "default"},
+		Spec: FittingJobSpec{
+			Seasonality:   "daily",
+			ExecuteOn:     12,
+			DataConfigMap: corev1.LocalObjectReference{Name: "data"},
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "fittingjob"}},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							ImagePullSecrets: []corev1.LocalObjectReference{{Name: "pull-secret"}},
+							Containers:       []corev1.Container{{Name: "fittingjob", Image: "your-job-image:v1"}},
+						},
+					},
+				},
+			},
+			TargetMetric: autoscalingv2beta2.MetricIdentifier{Name: "nginx.net.request_per_s"},
+			Provider: MetricProvider{
+				Name:           "datadog",
+				ProviderSource: ProviderSource{Datadog: &DatadogProviderSource{APIKey: "xxx", APPKey: "yyy"}},
+			},
+		},
+	}
+	v1beta2Sample := &v1beta2.FittingJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "fittingjob", Namespace: "default"},
+		Spec: v1beta2.FittingJobSpec{
+			JobPatchSpec: v1beta2.JobPatchSpec{
+				ConcurrencyPolicy:          "Forbid",
+				SuccessfulJobsHistoryLimit: func(i int32) *int32 { return &i }(1),
+				TTLSecondsAfterFinished:    func(i int32) *int32 { return &i }(3600),
+				Image:                      "your-job-image:v1",
+				Volumes: []corev1.Volume{
+					{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				},
+			},
+			Seasonality:   "weekly",
+			ExecuteOn:     4,
+			JitterMinutes: func(i int32) *int32 { return &i }(30),
+			Schedule:      "30 2 * * 1-5",
+			TimeZone:      "Asia/Tokyo",
+			Suspend:       true,
+			CustomConfig:  `{"custom":1}`,
+			DataConfigMap: corev1.LocalObjectReference{Name: "data"},
+			TargetMetric:  autoscalingv2beta2.MetricIdentifier{Name: "nginx.net.request_per_s"},
+			Provider: v1beta2.MetricProvider{
+				Name: "prometheus",
+				ProviderSource: v1beta2.ProviderSource{
+					Prometheus: &v1beta2.PrometheusProviderSource{URL: "http://prometheus.monitoring.svc:9090"},
+				},
+			},
+		},
+	}
+
+	// v1beta1 -> v1beta2 -> v1beta1
+	hub := &v1beta2.FittingJob{}
+	if err := v1beta1Sample.DeepCopy().ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Spec.Image != "your-job-image:v1" || len(hub.Spec.ImagePullSecrets) != 1 {
+		t.Fatalf("job patch spec is not converted (got=%v)", hub.Spec.JobPatchSpec)
+	}
+	spoke := &FittingJob{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(spoke, v1beta1Sample) {
+		t.Fatalf("restored fittingjob is not match (got=%v, exp=%v)", spoke, v1beta1Sample)
+	}
+
+	// v1beta2 -> v1beta1 -> v1beta2
+	spoke = &FittingJob{}
+	if err := spoke.ConvertFrom(v1beta2Sample); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image != "your-job-image:v1" {
+		t.Fatalf("job template is not converted (got=%v)", spoke.Spec.JobTemplate)
+	}
+	hub = &v1beta2.FittingJob{}
+	if err := spoke.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hub, v1beta2Sample) {
+		t.Fatalf("restored fittingjob is not match (got=%v, exp=%v)", hub, v1beta2Sample)
+	}
+}
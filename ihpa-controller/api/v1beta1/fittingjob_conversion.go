@@ -0,0 +1,152 @@
+/*
+Copyright 2020 SIA Platform Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"reflect"
+
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this FittingJob to the Hub version (v1beta2).
+// JobTemplate is mapped onto JobPatchSpec. When the template has fields which JobPatchSpec cannot represent,
+// the template is kept in the annotation so that the conversion back to v1beta1 is lossless.
+func (src *FittingJob) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta2.FittingJob)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	var restored v1beta2.FittingJobSpec
+	ok, err := unmarshalConversionData(&dst.ObjectMeta, V1beta2SpecAnnotation, &restored)
+	if err != nil {
+		return err
+	}
+
+	dst.Spec.JobPatchSpec = convertJobTemplateToJobPatchSpec(&src.Spec.JobTemplate)
+	dst.Spec.Seasonality = src.Spec.Seasonality
+	dst.Spec.ExecuteOn = src.Spec.ExecuteOn
+	dst.Spec.ChangePointDetectionConfig = convertChangePointDetectionConfigToV1beta2(&src.Spec.ChangePointDetectionConfig)
+	dst.Spec.DataConfigMap = src.Spec.DataConfigMap
+	dst.Spec.TargetMetric = src.Spec.TargetMetric
+
+	var restoredProvider *v1beta2.MetricProvider
+	if ok {
+		dst.Spec.CustomConfig = restored.CustomConfig
+		dst.Spec.Suspend = restored.Suspend
+		dst.Spec.JitterMinutes = restored.JitterMinutes
+		dst.Spec.Schedule = restored.Schedule
+		dst.Spec.TimeZone = restored.TimeZone
+		copyCronJobFields(&dst.Spec.JobPatchSpec, &restored.JobPatchSpec)
+		restoredProvider = &restored.Provider
+	}
+	dst.Spec.Provider = convertMetricProviderToV1beta2(&src.Spec.Provider, restoredProvider)
+
+	if !reflect.DeepEqual(convertJobPatchSpecToJobTemplate(&dst.Spec.JobPatchSpec), src.Spec.JobTemplate) {
+		if err := marshalConversionData(&dst.ObjectMeta, V1beta1JobTemplateAnnotation, &src.Spec.JobTemplate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta2) to this version.
+// CustomConfig, Suspend, schedule fields, fields of CronJob and Prometheus fields are kept in the annotation because v1beta1 has no field for them.
+func (dst *FittingJob) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta2.FittingJob)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	var restored batchv1beta1.JobTemplateSpec
+	ok, err := unmarshalConversionData(&dst.ObjectMeta, V1beta1JobTemplateAnnotation, &restored)
+	if err != nil {
+		return err
+	}
+
+	// The kept template is used as long as JobPatchSpec is not changed in v1beta2.
+	// Fields of CronJob are not in the template, so they are not compared.
+	restoredJPS := convertJobTemplateToJobPatchSpec(&restored)
+	copyCronJobFields(&restoredJPS, &src.Spec.JobPatchSpec)
+	if ok && reflect.DeepEqual(restoredJPS, src.Spec.JobPatchSpec) {
+		dst.Spec.JobTemplate = restored
+	} else {
+		dst.Spec.JobTemplate = convertJobPatchSpecToJobTemplate(&src.Spec.JobPatchSpec)
+	}
+	dst.Spec.Seasonality = src.Spec.Seasonality
+	dst.Spec.ExecuteOn = src.Spec.ExecuteOn
+	dst.Spec.ChangePointDetectionConfig = convertChangePointDetectionConfigFromV1beta2(&src.Spec.ChangePointDetectionConfig)
+	dst.Spec.DataConfigMap = src.Spec.DataConfigMap
+	dst.Spec.TargetMetric = src.Spec.TargetMetric
+	dst.Spec.Provider = convertMetricProviderFromV1beta2(&src.Spec.Provider)
+
+	// keep the original spec only when some fields are lost
+	converted := &v1beta2.FittingJob{}
+	if err := dst.DeepCopy().ConvertTo(converted); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(converted.Spec, src.Spec) {
+		if err := marshalConversionData(&dst.ObjectMeta, V1beta2SpecAnnotation, &src.Spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// convertJobTemplateToJobPatchSpec extracts JobPatchSpec from the job template.
+// Only the first container is used same as the generated job.
+func convertJobTemplateToJobPatchSpec(template *batchv1beta1.JobTemplateSpec) v1beta2.JobPatchSpec {
+	jobSpec := &template.Spec
+	podSpec := &jobSpec.Template.Spec
+	jps := v1beta2.JobPatchSpec{
+		ActiveDeadlineSeconds:   jobSpec.ActiveDeadlineSeconds,
+		BackoffLimit:            jobSpec.BackoffLimit,
+		Completions:             jobSpec.Completions,
+		TTLSecondsAfterFinished: jobSpec.TTLSecondsAfterFinished,
+		Affinity:                podSpec.Affinity,
+		ImagePullSecrets:        podSpec.ImagePullSecrets,
+		NodeSelector:            podSpec.NodeSelector,
+		ServiceAccountName:      podSpec.ServiceAccountName,
+		Tolerations:             podSpec.Tolerations,
+		Volumes:                 podSpec.Volumes,
+	}
+	if len(podSpec.Containers) > 0 {
+		container := &podSpec.Containers[0]
+		jps.Args = container.Args
+		jps.Command = container.Command
+		jps.Env = container.Env
+		jps.EnvFrom = container.EnvFrom
+		jps.Image = container.Image
+		jps.ImagePullPolicy = container.ImagePullPolicy
+		jps.Resources = container.Resources
+	}
+	return jps
+}
+
+// copyCronJobFields copies the fields of JobPatchSpec for CronJob, which v1beta1 has no field for.
+func copyCronJobFields(dst, src *v1beta2.JobPatchSpec) {
+	dst.ConcurrencyPolicy = src.ConcurrencyPolicy
+	dst.SuccessfulJobsHistoryLimit = src.SuccessfulJobsHistoryLimit
+	dst.FailedJobsHistoryLimit = src.FailedJobsHistoryLimit
+	dst.StartingDeadlineSeconds = src.StartingDeadlineSeconds
+}
+
+func convertJobPatchSpecToJobTemplate(jps *v1beta2.JobPatchSpec) batchv1beta1.JobTemplateSpec {
+	return batchv1beta1.JobTemplateSpec{
+		Spec: *jps.GenerateJobSpec(),
+	}
+}
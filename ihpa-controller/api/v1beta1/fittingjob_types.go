@@ -107,6 +107,7 @@ type FittingJobStatus struct {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // FittingJob is the Schema for the fittingjobs API
 // +kubebuilder:resource:shortName=fj
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 SIA Platform Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"reflect"
+
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this IntelligentHorizontalPodAutoscaler to the Hub version (v1beta2).
+// FittingJobConfig is mapped onto FittingJobPatchSpec of each metric.
+func (src *IntelligentHorizontalPodAutoscaler) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta2.IntelligentHorizontalPodAutoscaler)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	var restored v1beta2.IntelligentHorizontalPodAutoscalerSpec
+	ok, err := unmarshalConversionData(&dst.ObjectMeta, V1beta2SpecAnnotation, &restored)
+	if err != nil {
+		return err
+	}
+
+	srcTemplate := &src.Spec.HorizontalPodAutoscalerTemplate
+	dstTemplate := &dst.Spec.HorizontalPodAutoscalerTemplate
+	dstTemplate.ObjectMeta = srcTemplate.ObjectMeta
+	dstTemplate.Spec.ScaleTargetRef = srcTemplate.Spec.ScaleTargetRef
+	dstTemplate.Spec.MinReplicas = srcTemplate.Spec.MinReplicas
+	dstTemplate.Spec.MaxReplicas = srcTemplate.Spec.MaxReplicas
+	if ok {
+		// behavior, scheduled overrides, shadow mode and pausing cannot be represented in v1beta1
+		dstTemplate.Spec.Behavior = restored.HorizontalPodAutoscalerTemplate.Spec.Behavior
+		dst.Spec.ScheduledOverrides = restored.ScheduledOverrides
+		dst.Spec.Shadow = restored.Shadow
+		dst.Spec.Paused = restored.Paused
+		dst.Spec.PausedReason = restored.PausedReason
+	}
+
+	// Per metric FittingJobPatchSpec is restored as long as FittingJobConfig is not changed.
+	// If it is changed, it overwrites the fields of all metrics.
+	var restoredMetrics []v1beta2.ExtendedMetricSpec
+	keepRestored := false
+	if ok {
+		restoredMetrics = restored.HorizontalPodAutoscalerTemplate.Spec.Metrics
+		if len(restoredMetrics) > 0 {
+			orgConfig := convertFittingJobPatchSpecToConfig(&restoredMetrics[0].FittingJobPatchSpec)
+			keepRestored = reflect.DeepEqual(orgConfig, src.Spec.FittingJobConfig)
+		}
+	}
+
+	dstTemplate.Spec.Metrics = nil
+	for i, metric := range srcTemplate.Spec.Metrics {
+		var fjps v1beta2.FittingJobPatchSpec
+		if i < len(restoredMetrics) {
+			fjps = restoredMetrics[i].FittingJobPatchSpec
+		}
+		if !keepRestored {
+			applyFittingJobConfig(&fjps, &src.Spec.FittingJobConfig)
+		}
+		dstTemplate.Spec.Metrics = append(dstTemplate.Spec.Metrics, v1beta2.ExtendedMetricSpec{
+			Type:                metric.Type,
+			Object:              metric.Object,
+			Pods:                metric.Pods,
+			Resource:            metric.Resource,
+			External:            metric.External,
+			FittingJobPatchSpec: fjps,
+		})
+	}
+
+	dst.Spec.EstimatorPatchSpec = v1beta2.EstimatorPatchSpec{
+		Mode:       convertEstimationModeToV1beta2(src.Spec.EstimationMode),
+		GapMinutes: src.Spec.EstimationGapMinutes,
+	}
+	// floor mode and its settings are restored as long as the estimator settings are not changed
+	if ok {
+		eps := &restored.EstimatorPatchSpec
+		if convertEstimationModeFromV1beta2(eps.Mode) == src.Spec.EstimationMode && eps.GapMinutes == src.Spec.EstimationGapMinutes {
+			dst.Spec.EstimatorPatchSpec = *eps
+		}
+	}
+
+	var restoredProvider *v1beta2.MetricProvider
+	if ok {
+		restoredProvider = &restored.MetricProvider
+	}
+	dst.Spec.MetricProvider = convertMetricProviderToV1beta2(&src.Spec.MetricProvider, restoredProvider)
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta2) to this version.
+// FittingJobConfig is taken from the first metric. When some fields cannot be represented in v1beta1,
+// the original spec is kept in the annotation so that the conversion back to v1beta2 is lossless.
+func (dst *IntelligentHorizontalPodAutoscaler) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta2.IntelligentHorizontalPodAutoscaler)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	srcTemplate := &src.Spec.HorizontalPodAutoscalerTemplate
+	dstTemplate := &dst.Spec.HorizontalPodAutoscalerTemplate
+	dstTemplate.ObjectMeta = srcTemplate.ObjectMeta
+	dstTemplate.Spec.ScaleTargetRef = srcTemplate.Spec.ScaleTargetRef
+	dstTemplate.Spec.MinReplicas = srcTemplate.Spec.MinReplicas
+	dstTemplate.Spec.MaxReplicas = srcTemplate.Spec.MaxReplicas
+
+	dstTemplate.Spec.Metrics = nil
+	for _, metric := range srcTemplate.Spec.Metrics {
+		dstTemplate.Spec.Metrics = append(dstTemplate.Spec.Metrics, autoscalingv2beta2.MetricSpec{
+			Type:     metric.Type,
+			Object:   metric.Object,
+			Pods:     metric.Pods,
+			Resource: metric.Resource,
+			External: metric.External,
+		})
+	}
+
+	dst.Spec.FittingJobConfig = FittingJobConfig{}
+	if len(srcTemplate.Spec.Metrics) > 0 {
+		dst.Spec.FittingJobConfig = convertFittingJobPatchSpecToConfig(&srcTemplate.Spec.Metrics[0].FittingJobPatchSpec)
+	}
+
+	dst.Spec.EstimationMode = convertEstimationModeFromV1beta2(src.Spec.EstimatorPatchSpec.Mode)
+	dst.Spec.EstimationGapMinutes = src.Spec.EstimatorPatchSpec.GapMinutes
+	dst.Spec.MetricProvider = convertMetricProviderFromV1beta2(&src.Spec.MetricProvider)
+
+	// keep the original spec only when some fields are lost
+	converted := &v1beta2.IntelligentHorizontalPodAutoscaler{}
+	if err := dst.DeepCopy().ConvertTo(converted); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(converted.Spec, src.Spec) {
+		if err := marshalConversionData(&dst.ObjectMeta, V1beta2SpecAnnotation, &src.Spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyFittingJobConfig overwrites the fields of FittingJobPatchSpec which FittingJobConfig has.
+func applyFittingJobConfig(fjps *v1beta2.FittingJobPatchSpec, config *FittingJobConfig) {
+	fjps.Seasonality = config.Seasonality
+	fjps.ExecuteOn = config.ExecuteOn
+	fjps.ChangePointDetectionConfig = convertChangePointDetectionConfigToV1beta2(&config.ChangePointDetectionConfig)
+	fjps.Image = config.Image
+	fjps.ImagePullSecrets = config.ImagePullSecrets
+	fjps.ServiceAccountName = config.ServiceAccountName
+}
+
+func convertFittingJobPatchSpecToConfig(fjps *v1beta2.FittingJobPatchSpec) FittingJobConfig {
+	return FittingJobConfig{
+		Seasonality:                fjps.Seasonality,
+		ExecuteOn:                  fjps.ExecuteOn,
+		ChangePointDetectionConfig: convertChangePointDetectionConfigFromV1beta2(&fjps.ChangePointDetectionConfig),
+		Image:                      fjps.Image,
+		ImagePullSecrets:           fjps.ImagePullSecrets,
+		ServiceAccountName:         fjps.ServiceAccountName,
+	}
+}
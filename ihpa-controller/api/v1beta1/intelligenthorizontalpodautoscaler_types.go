@@ -130,6 +130,7 @@ type IntelligentHorizontalPodAutoscalerStatus struct {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // IntelligentHorizontalPodAutoscaler is the Schema for the intelligenthorizontalpodautoscalers API
 // +kubebuilder:resource:shortName=ihpa
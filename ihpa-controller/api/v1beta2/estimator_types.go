@@ -18,6 +18,7 @@ package v1beta2
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,7 +29,8 @@ import (
 type EstimatorSpec struct {
 	// Mode is a way to adjust estimate metrics
 	// when the metrics out of line.
-	// +kubebuilder:validation:Enum=raw;adjust
+	// Floor mode sends metrics in the same way as adjust mode.
+	// +kubebuilder:validation:Enum=raw;adjust;floor
 	// +kubebuilder:default=adjust
 	Mode string `json:"mode,omitempty"`
 
@@ -54,15 +56,64 @@ type EstimatorSpec struct {
 
 	// DataConfigMap is destination of result fittingjob forecasted.
 	DataConfigMap corev1.LocalObjectReference `json:"dataConfigMap"`
+
+	// ScheduledOverrides multiply forecasted values in their windows by ForecastMultiplier.
+	// MinReplicas of them is not used by estimator.
+	ScheduledOverrides []ScheduledOverride `json:"scheduledOverrides,omitempty"`
+
+	// Paused stops sending forecasted metrics.
+	// Forecasted data is still loaded, and sending is restarted from the current time when resumed.
+	Paused bool `json:"paused,omitempty"`
 }
 
 // EstimatorStatus defines the observed state of Estimator
 type EstimatorStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// DataStartTime is the estimate time of the first forecasted data loaded.
+	DataStartTime *metav1.Time `json:"dataStartTime,omitempty"`
+
+	// DataEndTime is the estimate time of the last forecasted data loaded.
+	DataEndTime *metav1.Time `json:"dataEndTime,omitempty"`
+
+	// NextSendTime is the time when the next forecasted data will be sent.
+	NextSendTime *metav1.Time `json:"nextSendTime,omitempty"`
+
+	// LastSendTime is the latest time when forecasted data was sent successfully.
+	LastSendTime *metav1.Time `json:"lastSendTime,omitempty"`
+
+	// LastSentValue is the latest sent value adjusted by actual metric.
+	LastSentValue *resource.Quantity `json:"lastSentValue,omitempty"`
+
+	// LastSentRawValue is the latest sent value as forecasted.
+	LastSentRawValue *resource.Quantity `json:"lastSentRawValue,omitempty"`
+
+	// SendFailures is the number of failures of sending data to metric provider.
+	SendFailures int32 `json:"sendFailures,omitempty"`
+
+	// Accuracy is the rolling accuracy of forecasted data compared with actual metric.
+	// This is reported only in adjust mode because actual metric is fetched only in the mode.
+	Accuracy *ForecastAccuracy `json:"accuracy,omitempty"`
+}
+
+// ForecastAccuracy is errors between past forecasted values and actual values.
+type ForecastAccuracy struct {
+	// Samples is the number of compared datapoints.
+	Samples int32 `json:"samples"`
+
+	// MeanAbsoluteError is mean of absolute errors.
+	MeanAbsoluteError *resource.Quantity `json:"meanAbsoluteError,omitempty"`
+
+	// MeanAbsolutePercentageError is mean of absolute percentage errors (e.g. "12.5%").
+	// Datapoints whose actual value is zero are excluded.
+	MeanAbsolutePercentageError string `json:"meanAbsolutePercentageError,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Data End",type="date",JSONPath=".status.dataEndTime"
+// +kubebuilder:printcolumn:name="Next Send",type="string",JSONPath=".status.nextSendTime"
+// +kubebuilder:printcolumn:name="Send Failures",type="integer",JSONPath=".status.sendFailures"
+// +kubebuilder:printcolumn:name="MAPE",type="string",JSONPath=".status.accuracy.meanAbsolutePercentageError"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Estimator is the Schema for the estimators API
 type Estimator struct {
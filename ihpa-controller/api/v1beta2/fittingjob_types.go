@@ -43,6 +43,23 @@ type FittingJobSpec struct {
 	// +kubebuilder:default=4
 	ExecuteOn int32 `json:"executeOn,omitempty"`
 
+	// JitterMinutes is a window of the delay added to ExecuteOn in minutes.
+	// The delay is derived from the UID of the FittingJob, so the schedule is stable
+	// and jobs of many FittingJobs are spread. 60 is used if this is not specified.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1440
+	JitterMinutes *int32 `json:"jitterMinutes,omitempty"`
+
+	// Schedule is a cron expression of fitting job, which is used instead of ExecuteOn.
+	// The delay of JitterMinutes is not added to the schedule.
+	Schedule string `json:"schedule,omitempty"`
+
+	// TimeZone is a name of the time zone for ExecuteOn and Schedule (e.g. Asia/Tokyo). UTC is used if this is empty.
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Suspend suspends the CronJob of fitting job.
+	Suspend bool `json:"suspend,omitempty"`
+
 	// ChangePointDetectionConfig is configuration for fittingjob change point detection.
 	ChangePointDetectionConfig ChangePointDetectionConfig `json:"changePointDetectionConfig,omitempty"`
 
@@ -61,10 +78,27 @@ type FittingJobSpec struct {
 
 // JobPatchSpec defines some JobSpec field for patch
 type JobPatchSpec struct {
+	// related to CronJob
+	// ConcurrencyPolicy specifies how to treat concurrent executions of the job.
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty"`
+	// SuccessfulJobsHistoryLimit is the number of successful finished jobs to retain.
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// FailedJobsHistoryLimit is the number of failed finished jobs to retain.
+	// +kubebuilder:validation:Minimum=0
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+	// StartingDeadlineSeconds is the deadline in seconds for starting the job if it misses scheduled time.
+	// +kubebuilder:validation:Minimum=0
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
 	// related to Job
 	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
 	BackoffLimit          *int32 `json:"backoffLimit,omitempty"`
 	Completions           *int32 `json:"completions,omitempty"`
+	// TTLSecondsAfterFinished is the lifetime of the finished job.
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
 
 	// related to Pod
 	Affinity           *corev1.Affinity              `json:"affinity,omitempty"`
@@ -97,9 +131,10 @@ func (jps *JobPatchSpec) GenerateJobSpec() *batchv1.JobSpec {
 	}
 
 	return &batchv1.JobSpec{
-		ActiveDeadlineSeconds: jps.ActiveDeadlineSeconds,
-		BackoffLimit:          jps.BackoffLimit,
-		Completions:           jps.Completions,
+		ActiveDeadlineSeconds:   jps.ActiveDeadlineSeconds,
+		BackoffLimit:            jps.BackoffLimit,
+		Completions:             jps.Completions,
+		TTLSecondsAfterFinished: jps.TTLSecondsAfterFinished,
 		Template: corev1.PodTemplateSpec{
 			Spec: corev1.PodSpec{
 				Affinity:           jps.Affinity,
@@ -167,12 +202,75 @@ type ChangePointDetectionConfig struct {
 
 // FittingJobStatus defines the observed state of FittingJob
 type FittingJobStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// LastScheduleTime is the last time the job was scheduled by CronJob.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastJobName is a name of the latest job.
+	LastJobName string `json:"lastJobName,omitempty"`
+
+	// LastSuccessfulTime is the completion time of the latest successful job.
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// LastFailureTime is the time when the latest failed job failed.
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// LastFailureReason is the reason why the latest failed job failed.
+	LastFailureReason string `json:"lastFailureReason,omitempty"`
+
+	// LastRunDuration is running duration of the latest finished job.
+	LastRunDuration *metav1.Duration `json:"lastRunDuration,omitempty"`
+
+	// Datapoints is the number of forecasted datapoints stored in DataConfigMap.
+	Datapoints int32 `json:"datapoints,omitempty"`
+
+	// LastTrigger is the request of the latest on-demand job and its result.
+	LastTrigger *FittingJobTriggerStatus `json:"lastTrigger,omitempty"`
+}
+
+// FittingJobTriggerPhase is a phase of the on-demand job.
+type FittingJobTriggerPhase string
+
+const (
+	// TriggerPhaseRunning means the job is created and not finished yet.
+	TriggerPhaseRunning FittingJobTriggerPhase = "Running"
+	// TriggerPhaseSucceeded means the job is completed.
+	TriggerPhaseSucceeded FittingJobTriggerPhase = "Succeeded"
+	// TriggerPhaseFailed means the job failed.
+	TriggerPhaseFailed FittingJobTriggerPhase = "Failed"
+	// TriggerPhaseSkipped means no job is created because the FittingJob is suspended.
+	TriggerPhaseSkipped FittingJobTriggerPhase = "Skipped"
+)
+
+// FittingJobTriggerStatus is a request of an on-demand job and its result.
+type FittingJobTriggerStatus struct {
+	// Trigger is the value of the trigger annotation which requested the job.
+	Trigger string `json:"trigger"`
+
+	// RequestTime is the time when the request was handled.
+	RequestTime metav1.Time `json:"requestTime"`
+
+	// JobName is a name of the job created for the request.
+	JobName string `json:"jobName,omitempty"`
+
+	// Phase is the phase of the job.
+	Phase FittingJobTriggerPhase `json:"phase"`
+
+	// CompletionTime is the time when the job finished.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Message is a human readable message about the result.
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Last Schedule",type="date",JSONPath=".status.lastScheduleTime"
+// +kubebuilder:printcolumn:name="Last Success",type="date",JSONPath=".status.lastSuccessfulTime"
+// +kubebuilder:printcolumn:name="Last Failure",type="date",JSONPath=".status.lastFailureTime"
+// +kubebuilder:printcolumn:name="Datapoints",type="integer",JSONPath=".status.datapoints"
+// +kubebuilder:printcolumn:name="Trigger",type="string",JSONPath=".status.lastTrigger.phase",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // FittingJob is the Schema for the fittingjobs API
 // +kubebuilder:resource:shortName=fj
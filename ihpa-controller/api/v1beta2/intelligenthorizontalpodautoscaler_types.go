@@ -19,6 +19,7 @@ package v1beta2
 import (
 	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -35,6 +36,53 @@ type IntelligentHorizontalPodAutoscalerSpec struct {
 
 	// MetricProvider is data source and destination of metrics datapoints.
 	MetricProvider MetricProvider `json:"metricProvider"`
+
+	// ScheduledOverrides overrides scaling in time windows of known events (e.g. campaigns),
+	// which are not in historical data and cannot be forecasted.
+	ScheduledOverrides []ScheduledOverride `json:"scheduledOverrides,omitempty"`
+
+	// Shadow runs FittingJobs and Estimators without applying forecast to the HPA (dry-run).
+	// The generated HPA has only the metrics of the template, and replicas recommended by
+	// forecasted metrics are reported in status for comparison with the HPA.
+	Shadow bool `json:"shadow,omitempty"`
+
+	// Paused freezes predictive scaling without deleting the IHPA.
+	// While paused, the generated HPA has only the metrics of the template, Estimators stop sending
+	// forecasted metrics and CronJobs of FittingJobs are suspended. Forecasted data is kept for resuming.
+	Paused bool `json:"paused,omitempty"`
+
+	// PausedReason is a reason of pausing, which is shown in the Paused condition.
+	PausedReason string `json:"pausedReason,omitempty"`
+}
+
+// ScheduledOverride overrides scaling in time windows.
+// The windows are given by Schedule and DurationMinutes, or by Start and End.
+type ScheduledOverride struct {
+	// Name is a name of the override shown in status.
+	Name string `json:"name"`
+
+	// Schedule is a cron expression (minute hour day-of-month month day-of-week) of the start of windows.
+	Schedule string `json:"schedule,omitempty"`
+
+	// DurationMinutes is the length of windows started by Schedule.
+	// +kubebuilder:validation:Minimum=1
+	DurationMinutes int32 `json:"durationMinutes,omitempty"`
+
+	// Start is the start of the absolute window.
+	Start *metav1.Time `json:"start,omitempty"`
+
+	// End is the end of the absolute window.
+	End *metav1.Time `json:"end,omitempty"`
+
+	// TimeZone is a name of the time zone for Schedule (e.g. Asia/Tokyo). UTC is used if this is empty.
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// MinReplicas is the floor of minReplicas of the HPA in the windows.
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// ForecastMultiplier multiplies forecasted values whose forecasted time is in the windows (e.g. "1.5").
+	ForecastMultiplier *resource.Quantity `json:"forecastMultiplier,omitempty"`
 }
 
 // HorizontalPodAutoscalerTemplateSpec describes the data a HPA should have when created from a template
@@ -54,6 +102,70 @@ type ExtendedHorizontalPodAutoscalerSpec struct {
 	// but use ExtendedMetricSpec
 	Metrics []ExtendedMetricSpec `json:"metrics,omitempty" protobuf:"bytes,4,rep,name=metrics"`
 	// ----------------------------------------------
+
+	// Behavior configures the scaling behavior of the generated HPA.
+	// This is passed through to the HPA as it is (requires Kubernetes 1.18 or later).
+	Behavior *HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+// HorizontalPodAutoscalerBehavior is same as autoscaling.v2 definition.
+// It configures the scaling behavior in both up and down directions.
+type HorizontalPodAutoscalerBehavior struct {
+	// ScaleUp is scaling policy for scaling up.
+	ScaleUp *HPAScalingRules `json:"scaleUp,omitempty"`
+	// ScaleDown is scaling policy for scaling down.
+	ScaleDown *HPAScalingRules `json:"scaleDown,omitempty"`
+}
+
+// ScalingPolicySelect is used to specify which policy should be used while scaling in a certain direction.
+type ScalingPolicySelect string
+
+const (
+	// MaxPolicySelect selects the policy with the highest possible change.
+	MaxPolicySelect ScalingPolicySelect = "Max"
+	// MinPolicySelect selects the policy with the lowest possible change.
+	MinPolicySelect ScalingPolicySelect = "Min"
+	// DisabledPolicySelect disables the scaling in this direction.
+	DisabledPolicySelect ScalingPolicySelect = "Disabled"
+)
+
+// HPAScalingRules is same as autoscaling.v2 definition.
+type HPAScalingRules struct {
+	// StabilizationWindowSeconds is the number of seconds for which past recommendations should be
+	// considered while scaling up or scaling down.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=3600
+	StabilizationWindowSeconds *int32 `json:"stabilizationWindowSeconds,omitempty"`
+	// SelectPolicy is used to specify which policy should be used.
+	// +kubebuilder:validation:Enum=Max;Min;Disabled
+	SelectPolicy *ScalingPolicySelect `json:"selectPolicy,omitempty"`
+	// Policies is a list of potential scaling polices which can be used during scaling.
+	Policies []HPAScalingPolicy `json:"policies,omitempty"`
+}
+
+// HPAScalingPolicyType is the type of the policy which could be used while making scaling decisions.
+type HPAScalingPolicyType string
+
+const (
+	// PodsScalingPolicy is a policy used to specify a change in absolute number of pods.
+	PodsScalingPolicy HPAScalingPolicyType = "Pods"
+	// PercentScalingPolicy is a policy used to specify a relative amount of change with respect to
+	// the current number of pods.
+	PercentScalingPolicy HPAScalingPolicyType = "Percent"
+)
+
+// HPAScalingPolicy is same as autoscaling.v2 definition.
+type HPAScalingPolicy struct {
+	// Type is used to specify the scaling policy.
+	// +kubebuilder:validation:Enum=Pods;Percent
+	Type HPAScalingPolicyType `json:"type"`
+	// Value contains the amount of change which is permitted by the policy.
+	// +kubebuilder:validation:Minimum=1
+	Value int32 `json:"value"`
+	// PeriodSeconds specifies the window of time for which the policy should hold true.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=1800
+	PeriodSeconds int32 `json:"periodSeconds"`
 }
 
 // ExtendedMetricSpec is same as autoscaling.v2beta2 but including FittingJob spec
@@ -98,6 +210,20 @@ type FittingJobPatchSpec struct {
 	// +kubebuilder:default=4
 	ExecuteOn int32 `json:"executeOn,omitempty"`
 
+	// JitterMinutes is a window of the delay added to ExecuteOn in minutes.
+	// The delay is derived from the UID of the FittingJob, so the schedule is stable
+	// and jobs of many FittingJobs are spread. 60 is used if this is not specified.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1440
+	JitterMinutes *int32 `json:"jitterMinutes,omitempty"`
+
+	// Schedule is a cron expression of fitting job, which is used instead of ExecuteOn.
+	// The delay of JitterMinutes is not added to the schedule.
+	Schedule string `json:"schedule,omitempty"`
+
+	// TimeZone is a name of the time zone for ExecuteOn and Schedule (e.g. Asia/Tokyo). UTC is used if this is empty.
+	TimeZone string `json:"timeZone,omitempty"`
+
 	// ChangePointDetectionConfig is configuration for fittingjob change point detection.
 	ChangePointDetectionConfig ChangePointDetectionConfig `json:"changePointDetectionConfig,omitempty"`
 
@@ -111,6 +237,9 @@ func (fjps *FittingJobPatchSpec) GenerateFittingJobSpec() *FittingJobSpec {
 		JobPatchSpec:               fjps.JobPatchSpec,
 		Seasonality:                fjps.Seasonality,
 		ExecuteOn:                  fjps.ExecuteOn,
+		JitterMinutes:              fjps.JitterMinutes,
+		Schedule:                   fjps.Schedule,
+		TimeZone:                   fjps.TimeZone,
 		ChangePointDetectionConfig: fjps.ChangePointDetectionConfig,
 		CustomConfig:               fjps.CustomConfig,
 	}
@@ -120,7 +249,10 @@ func (fjps *FittingJobPatchSpec) GenerateFittingJobSpec() *FittingJobSpec {
 type EstimatorPatchSpec struct {
 	// Mode is a way to adjust estimate metrics
 	// when the metrics out of line.
-	// +kubebuilder:validation:Enum=raw;adjust
+	// In floor mode, forecasted metrics are adjusted in the same way as adjust mode, but they are
+	// not added to the HPA. Instead, the controller converts them into replicas by the target value
+	// and sets the replicas to minReplicas of the HPA.
+	// +kubebuilder:validation:Enum=raw;adjust;floor
 	// +kubebuilder:default=adjust
 	Mode string `json:"mode,omitempty"`
 
@@ -128,6 +260,11 @@ type EstimatorPatchSpec struct {
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:default=10
 	GapMinutes int32 `json:"gapMinutes,omitempty"`
+
+	// FloorMaxStep is the maximum change of minReplicas of the HPA at a time in floor mode.
+	// minReplicas is changed without limit if this is zero.
+	// +kubebuilder:validation:Minimum=0
+	FloorMaxStep int32 `json:"floorMaxStep,omitempty"`
 }
 
 // GenerateEstimatorSpec generate EstimatorSpec from EstimatorPatchSpec
@@ -168,16 +305,171 @@ type DatadogProviderSource struct {
 }
 
 // PrometheusProviderSource defines parameters for accessing Prometheus.
-type PrometheusProviderSource struct{}
+type PrometheusProviderSource struct {
+	// URL is base URL of Prometheus server for querying metrics.
+	// e.g.) http://prometheus.monitoring.svc:9090
+	URL string `json:"url"`
+
+	// RemoteWriteURL is endpoint of remote write protocol for sending forecasted metrics.
+	// If this is empty, "/api/v1/write" of URL is used.
+	// e.g.) http://prometheus.monitoring.svc:9090/api/v1/write
+	RemoteWriteURL string `json:"remoteWriteURL,omitempty"`
+
+	// BearerTokenSecret is the key of Secret containing the token sent as Authorization header.
+	BearerTokenSecret *corev1.SecretKeySelector `json:"bearerTokenSecret,omitempty"`
+
+	// BearerToken is the token read from BearerTokenSecret by the controller.
+	// This is not serialized, so the token is not copied to the generated resources.
+	BearerToken string `json:"-"`
+
+	// BasicAuth is credentials for basic authentication.
+	BasicAuth *PrometheusBasicAuth `json:"basicAuth,omitempty"`
+
+	// TLSConfig is configuration for connecting to Prometheus over TLS.
+	TLSConfig *PrometheusTLSConfig `json:"tlsConfig,omitempty"`
+}
+
+// PrometheusBasicAuth defines credentials for basic authentication.
+type PrometheusBasicAuth struct {
+	Username string `json:"username"`
+
+	// PasswordSecret is the key of Secret containing the password.
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret,omitempty"`
+
+	// Password is the password read from PasswordSecret by the controller.
+	// This is not serialized, so the password is not copied to the generated resources.
+	Password string `json:"-"`
+}
+
+// PrometheusTLSConfig defines TLS settings for Prometheus.
+type PrometheusTLSConfig struct {
+	// CA is PEM encoded CA certificates for verifying server certificate.
+	CA string `json:"ca,omitempty"`
+
+	// Cert is PEM encoded client certificate.
+	Cert string `json:"cert,omitempty"`
+
+	// KeySecret is the key of Secret containing PEM encoded client private key.
+	KeySecret *corev1.SecretKeySelector `json:"keySecret,omitempty"`
+
+	// Key is the private key read from KeySecret by the controller.
+	// This is not serialized, so the private key is not copied to the generated resources.
+	Key string `json:"-"`
+
+	// ServerName is used for verifying hostname of server certificate.
+	ServerName string `json:"serverName,omitempty"`
+
+	// InsecureSkipVerify disables verification of server certificate.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
 
 // IntelligentHorizontalPodAutoscalerStatus defines the observed state of IntelligentHorizontalPodAutoscaler
 type IntelligentHorizontalPodAutoscalerStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// HorizontalPodAutoscalerName is a name of HPA generated by this IHPA.
+	HorizontalPodAutoscalerName string `json:"horizontalPodAutoscalerName,omitempty"`
+
+	// LastForecastTime is the latest time when forecasted metrics were sent successfully.
+	LastForecastTime *metav1.Time `json:"lastForecastTime,omitempty"`
+
+	// ForecastHorizonEnd is the earliest end of forecasted data in all metrics.
+	ForecastHorizonEnd *metav1.Time `json:"forecastHorizonEnd,omitempty"`
+
+	// Metrics is status of each metric.
+	Metrics []MetricForecastStatus `json:"metrics,omitempty"`
+
+	// ActiveScheduledOverrides is names of scheduled overrides whose window includes the current time.
+	ActiveScheduledOverrides []string `json:"activeScheduledOverrides,omitempty"`
+
+	// Shadow is the comparison between forecast and the HPA in shadow mode.
+	Shadow *ShadowStatus `json:"shadow,omitempty"`
+
+	// LastTrigger is the latest value of the trigger annotation propagated to the FittingJobs.
+	LastTrigger string `json:"lastTrigger,omitempty"`
+
+	// Conditions is the latest observations of IHPA's state.
+	Conditions []IntelligentHorizontalPodAutoscalerCondition `json:"conditions,omitempty"`
+}
+
+// ShadowStatus compares replicas recommended by forecasted metrics with replicas chosen by the HPA.
+type ShadowStatus struct {
+	// RecommendedReplicas is replicas which forecasted metrics would recommend to the HPA.
+	// This is nil if no forecast is available.
+	RecommendedReplicas *int32 `json:"recommendedReplicas,omitempty"`
+
+	// HPADesiredReplicas is desired replicas of the HPA.
+	HPADesiredReplicas int32 `json:"hpaDesiredReplicas"`
+}
+
+// MetricForecastStatus defines the observed state of forecast for a metric.
+type MetricForecastStatus struct {
+	// Name is a metric name of forecast target.
+	Name string `json:"name"`
+
+	// FittingJobName is a name of FittingJob for this metric.
+	FittingJobName string `json:"fittingJobName,omitempty"`
+
+	// EstimatorName is a name of Estimator for this metric.
+	EstimatorName string `json:"estimatorName,omitempty"`
+
+	// LastForecastTime is the latest time when forecasted metric was sent successfully.
+	LastForecastTime *metav1.Time `json:"lastForecastTime,omitempty"`
+
+	// ForecastHorizonEnd is the timestamp of the last forecasted data.
+	ForecastHorizonEnd *metav1.Time `json:"forecastHorizonEnd,omitempty"`
+
+	// RawValue is the current forecasted value.
+	RawValue *resource.Quantity `json:"rawValue,omitempty"`
+
+	// AdjustedValue is the current forecasted value adjusted by actual metric.
+	AdjustedValue *resource.Quantity `json:"adjustedValue,omitempty"`
+}
+
+// IntelligentHorizontalPodAutoscalerConditionType is a type of condition of IHPA.
+type IntelligentHorizontalPodAutoscalerConditionType string
+
+const (
+	// ConditionReady indicates that all resources are reconciled and forecast is available.
+	ConditionReady IntelligentHorizontalPodAutoscalerConditionType = "Ready"
+	// ConditionForecastAvailable indicates that forecasted data covers current time for all metrics.
+	ConditionForecastAvailable IntelligentHorizontalPodAutoscalerConditionType = "ForecastAvailable"
+	// ConditionProviderHealthy indicates that metric provider can be accessed.
+	ConditionProviderHealthy IntelligentHorizontalPodAutoscalerConditionType = "ProviderHealthy"
+	// ConditionFittingFailed indicates that the latest fitting job failed.
+	ConditionFittingFailed IntelligentHorizontalPodAutoscalerConditionType = "FittingFailed"
+	// ConditionPaused indicates that predictive scaling is paused by the spec.
+	ConditionPaused IntelligentHorizontalPodAutoscalerConditionType = "Paused"
+)
+
+// IntelligentHorizontalPodAutoscalerCondition describes the state of IHPA at a certain point.
+type IntelligentHorizontalPodAutoscalerCondition struct {
+	// Type is a type of condition.
+	Type IntelligentHorizontalPodAutoscalerConditionType `json:"type"`
+
+	// Status is status of the condition, one of True, False, Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is the reason for the condition's last transition.
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human-readable explanation containing details about the transition.
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Forecast",type="string",JSONPath=".status.conditions[?(@.type==\"ForecastAvailable\")].status"
+// +kubebuilder:printcolumn:name="Paused",type="boolean",JSONPath=".spec.paused"
+// +kubebuilder:printcolumn:name="HPA",type="string",JSONPath=".status.horizontalPodAutoscalerName"
+// +kubebuilder:printcolumn:name="Last Forecast",type="date",JSONPath=".status.lastForecastTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // IntelligentHorizontalPodAutoscaler is the Schema for the intelligenthorizontalpodautoscalers API
 // +kubebuilder:resource:shortName=ihpa
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 SIA Platform Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/internal/webhook/admissionreview"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// IHPAMutatingWebhookPath is the path of the defaulting webhook of IntelligentHorizontalPodAutoscaler.
+const IHPAMutatingWebhookPath = "/mutate-ihpa-ake-cyberagent-co-jp-v1beta2-intelligenthorizontalpodautoscaler"
+
+// Default values which are same as the defaults of CRD schema.
+const (
+	DefaultEstimatorMode       = "adjust"
+	DefaultEstimatorGapMinutes = 10
+	DefaultSeasonality         = "auto"
+
+	DefaultPercentageThreshold = 50
+	DefaultWindowSize          = 100
+	DefaultTrajectoryRows      = 50
+	DefaultTrajectoryFeatures  = 5
+	DefaultTestRows            = 50
+	DefaultTestFeatures        = 5
+	DefaultLag                 = 288
+)
+
+// SetupWebhookWithManager registers webhooks of IntelligentHorizontalPodAutoscaler to the manager.
+// The validating webhook is registered by the controllers package because it needs the generator.
+func (r *IntelligentHorizontalPodAutoscaler) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// the defaulting webhook is registered before the builder to serve admission.k8s.io/v1,
+	// and the builder skips the registered path
+	mgr.GetWebhookServer().Register(IHPAMutatingWebhookPath, admissionreview.NewHandler(admission.DefaultingWebhookFor(r)))
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-ihpa-ake-cyberagent-co-jp-v1beta2-intelligenthorizontalpodautoscaler,mutating=true,failurePolicy=fail,groups=ihpa.ake.cyberagent.co.jp,resources=intelligenthorizontalpodautoscalers,verbs=create;update,versions=v1beta2,name=mintelligenthorizontalpodautoscaler.ake.cyberagent.co.jp,sideEffects=None,matchPolicy=Equivalent,webhookVersions=v1,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &IntelligentHorizontalPodAutoscaler{}
+
+// Default fills default values of EstimatorPatchSpec and FittingJobPatchSpec of each metric explicitly.
+func (r *IntelligentHorizontalPodAutoscaler) Default() {
+	eps := &r.Spec.EstimatorPatchSpec
+	if eps.Mode == "" {
+		eps.Mode = DefaultEstimatorMode
+	}
+	if eps.GapMinutes == 0 {
+		eps.GapMinutes = DefaultEstimatorGapMinutes
+	}
+
+	metrics := r.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics
+	for i := range metrics {
+		metrics[i].FittingJobPatchSpec.Default()
+	}
+}
+
+// Default fills default values of FittingJobPatchSpec.
+// ExecuteOn is not filled because zero is a valid hour. It is defaulted by CRD schema when omitted.
+func (fjps *FittingJobPatchSpec) Default() {
+	if fjps.Seasonality == "" {
+		fjps.Seasonality = DefaultSeasonality
+	}
+
+	cpd := &fjps.ChangePointDetectionConfig
+	if cpd.PercentageThreshold == 0 {
+		cpd.PercentageThreshold = DefaultPercentageThreshold
+	}
+	if cpd.WindowSize == 0 {
+		cpd.WindowSize = DefaultWindowSize
+	}
+	if cpd.TrajectoryRows == 0 {
+		cpd.TrajectoryRows = DefaultTrajectoryRows
+	}
+	if cpd.TrajectoryFeatures == 0 {
+		cpd.TrajectoryFeatures = DefaultTrajectoryFeatures
+	}
+	if cpd.TestRows == 0 {
+		cpd.TestRows = DefaultTestRows
+	}
+	if cpd.TestFeatures == 0 {
+		cpd.TestFeatures = DefaultTestFeatures
+	}
+	if cpd.Lag == 0 {
+		cpd.Lag = DefaultLag
+	}
+}
@@ -23,6 +23,7 @@ package v1beta2
 import (
 	"k8s.io/api/autoscaling/v2beta2"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -69,7 +70,7 @@ func (in *Estimator) DeepCopyInto(out *Estimator) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Estimator.
@@ -152,6 +153,13 @@ func (in *EstimatorSpec) DeepCopyInto(out *EstimatorSpec) {
 	}
 	in.Provider.DeepCopyInto(&out.Provider)
 	out.DataConfigMap = in.DataConfigMap
+	if in.ScheduledOverrides != nil {
+		in, out := &in.ScheduledOverrides, &out.ScheduledOverrides
+		*out = make([]ScheduledOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EstimatorSpec.
@@ -167,6 +175,37 @@ func (in *EstimatorSpec) DeepCopy() *EstimatorSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EstimatorStatus) DeepCopyInto(out *EstimatorStatus) {
 	*out = *in
+	if in.DataStartTime != nil {
+		in, out := &in.DataStartTime, &out.DataStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.DataEndTime != nil {
+		in, out := &in.DataEndTime, &out.DataEndTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextSendTime != nil {
+		in, out := &in.NextSendTime, &out.NextSendTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSendTime != nil {
+		in, out := &in.LastSendTime, &out.LastSendTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSentValue != nil {
+		in, out := &in.LastSentValue, &out.LastSentValue
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.LastSentRawValue != nil {
+		in, out := &in.LastSentRawValue, &out.LastSentRawValue
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Accuracy != nil {
+		in, out := &in.Accuracy, &out.Accuracy
+		*out = new(ForecastAccuracy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EstimatorStatus.
@@ -195,6 +234,11 @@ func (in *ExtendedHorizontalPodAutoscalerSpec) DeepCopyInto(out *ExtendedHorizon
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Behavior != nil {
+		in, out := &in.Behavior, &out.Behavior
+		*out = new(HorizontalPodAutoscalerBehavior)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtendedHorizontalPodAutoscalerSpec.
@@ -266,7 +310,7 @@ func (in *FittingJob) DeepCopyInto(out *FittingJob) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FittingJob.
@@ -323,6 +367,11 @@ func (in *FittingJobList) DeepCopyObject() runtime.Object {
 func (in *FittingJobPatchSpec) DeepCopyInto(out *FittingJobPatchSpec) {
 	*out = *in
 	in.JobPatchSpec.DeepCopyInto(&out.JobPatchSpec)
+	if in.JitterMinutes != nil {
+		in, out := &in.JitterMinutes, &out.JitterMinutes
+		*out = new(int32)
+		**out = **in
+	}
 	out.ChangePointDetectionConfig = in.ChangePointDetectionConfig
 }
 
@@ -340,6 +389,11 @@ func (in *FittingJobPatchSpec) DeepCopy() *FittingJobPatchSpec {
 func (in *FittingJobSpec) DeepCopyInto(out *FittingJobSpec) {
 	*out = *in
 	in.JobPatchSpec.DeepCopyInto(&out.JobPatchSpec)
+	if in.JitterMinutes != nil {
+		in, out := &in.JitterMinutes, &out.JitterMinutes
+		*out = new(int32)
+		**out = **in
+	}
 	out.ChangePointDetectionConfig = in.ChangePointDetectionConfig
 	out.DataConfigMap = in.DataConfigMap
 	in.TargetMetric.DeepCopyInto(&out.TargetMetric)
@@ -359,6 +413,28 @@ func (in *FittingJobSpec) DeepCopy() *FittingJobSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FittingJobStatus) DeepCopyInto(out *FittingJobStatus) {
 	*out = *in
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRunDuration != nil {
+		in, out := &in.LastRunDuration, &out.LastRunDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.LastTrigger != nil {
+		in, out := &in.LastTrigger, &out.LastTrigger
+		*out = new(FittingJobTriggerStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FittingJobStatus.
@@ -371,13 +447,123 @@ func (in *FittingJobStatus) DeepCopy() *FittingJobStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FittingJobTriggerStatus) DeepCopyInto(out *FittingJobTriggerStatus) {
+	*out = *in
+	in.RequestTime.DeepCopyInto(&out.RequestTime)
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FittingJobTriggerStatus.
+func (in *FittingJobTriggerStatus) DeepCopy() *FittingJobTriggerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FittingJobTriggerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForecastAccuracy) DeepCopyInto(out *ForecastAccuracy) {
+	*out = *in
+	if in.MeanAbsoluteError != nil {
+		in, out := &in.MeanAbsoluteError, &out.MeanAbsoluteError
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForecastAccuracy.
+func (in *ForecastAccuracy) DeepCopy() *ForecastAccuracy {
+	if in == nil {
+		return nil
+	}
+	out := new(ForecastAccuracy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HPAScalingPolicy) DeepCopyInto(out *HPAScalingPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HPAScalingPolicy.
+func (in *HPAScalingPolicy) DeepCopy() *HPAScalingPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(HPAScalingPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HPAScalingRules) DeepCopyInto(out *HPAScalingRules) {
+	*out = *in
+	if in.StabilizationWindowSeconds != nil {
+		in, out := &in.StabilizationWindowSeconds, &out.StabilizationWindowSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SelectPolicy != nil {
+		in, out := &in.SelectPolicy, &out.SelectPolicy
+		*out = new(ScalingPolicySelect)
+		**out = **in
+	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]HPAScalingPolicy, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HPAScalingRules.
+func (in *HPAScalingRules) DeepCopy() *HPAScalingRules {
+	if in == nil {
+		return nil
+	}
+	out := new(HPAScalingRules)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HorizontalPodAutoscalerBehavior) DeepCopyInto(out *HorizontalPodAutoscalerBehavior) {
+	*out = *in
+	if in.ScaleUp != nil {
+		in, out := &in.ScaleUp, &out.ScaleUp
+		*out = new(HPAScalingRules)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ScaleDown != nil {
+		in, out := &in.ScaleDown, &out.ScaleDown
+		*out = new(HPAScalingRules)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HorizontalPodAutoscalerBehavior.
+func (in *HorizontalPodAutoscalerBehavior) DeepCopy() *HorizontalPodAutoscalerBehavior {
+	if in == nil {
+		return nil
+	}
+	out := new(HorizontalPodAutoscalerBehavior)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IntelligentHorizontalPodAutoscaler) DeepCopyInto(out *IntelligentHorizontalPodAutoscaler) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntelligentHorizontalPodAutoscaler.
@@ -398,6 +584,22 @@ func (in *IntelligentHorizontalPodAutoscaler) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntelligentHorizontalPodAutoscalerCondition) DeepCopyInto(out *IntelligentHorizontalPodAutoscalerCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntelligentHorizontalPodAutoscalerCondition.
+func (in *IntelligentHorizontalPodAutoscalerCondition) DeepCopy() *IntelligentHorizontalPodAutoscalerCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(IntelligentHorizontalPodAutoscalerCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IntelligentHorizontalPodAutoscalerList) DeepCopyInto(out *IntelligentHorizontalPodAutoscalerList) {
 	*out = *in
@@ -436,6 +638,13 @@ func (in *IntelligentHorizontalPodAutoscalerSpec) DeepCopyInto(out *IntelligentH
 	in.HorizontalPodAutoscalerTemplate.DeepCopyInto(&out.HorizontalPodAutoscalerTemplate)
 	out.EstimatorPatchSpec = in.EstimatorPatchSpec
 	in.MetricProvider.DeepCopyInto(&out.MetricProvider)
+	if in.ScheduledOverrides != nil {
+		in, out := &in.ScheduledOverrides, &out.ScheduledOverrides
+		*out = make([]ScheduledOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntelligentHorizontalPodAutoscalerSpec.
@@ -451,6 +660,38 @@ func (in *IntelligentHorizontalPodAutoscalerSpec) DeepCopy() *IntelligentHorizon
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IntelligentHorizontalPodAutoscalerStatus) DeepCopyInto(out *IntelligentHorizontalPodAutoscalerStatus) {
 	*out = *in
+	if in.LastForecastTime != nil {
+		in, out := &in.LastForecastTime, &out.LastForecastTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ForecastHorizonEnd != nil {
+		in, out := &in.ForecastHorizonEnd, &out.ForecastHorizonEnd
+		*out = (*in).DeepCopy()
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]MetricForecastStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ActiveScheduledOverrides != nil {
+		in, out := &in.ActiveScheduledOverrides, &out.ActiveScheduledOverrides
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Shadow != nil {
+		in, out := &in.Shadow, &out.Shadow
+		*out = new(ShadowStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]IntelligentHorizontalPodAutoscalerCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntelligentHorizontalPodAutoscalerStatus.
@@ -466,6 +707,21 @@ func (in *IntelligentHorizontalPodAutoscalerStatus) DeepCopy() *IntelligentHoriz
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobPatchSpec) DeepCopyInto(out *JobPatchSpec) {
 	*out = *in
+	if in.SuccessfulJobsHistoryLimit != nil {
+		in, out := &in.SuccessfulJobsHistoryLimit, &out.SuccessfulJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedJobsHistoryLimit != nil {
+		in, out := &in.FailedJobsHistoryLimit, &out.FailedJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.StartingDeadlineSeconds != nil {
+		in, out := &in.StartingDeadlineSeconds, &out.StartingDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
 	if in.ActiveDeadlineSeconds != nil {
 		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
 		*out = new(int64)
@@ -481,6 +737,11 @@ func (in *JobPatchSpec) DeepCopyInto(out *JobPatchSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
 	if in.Affinity != nil {
 		in, out := &in.Affinity, &out.Affinity
 		*out = new(v1.Affinity)
@@ -549,6 +810,39 @@ func (in *JobPatchSpec) DeepCopy() *JobPatchSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricForecastStatus) DeepCopyInto(out *MetricForecastStatus) {
+	*out = *in
+	if in.LastForecastTime != nil {
+		in, out := &in.LastForecastTime, &out.LastForecastTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ForecastHorizonEnd != nil {
+		in, out := &in.ForecastHorizonEnd, &out.ForecastHorizonEnd
+		*out = (*in).DeepCopy()
+	}
+	if in.RawValue != nil {
+		in, out := &in.RawValue, &out.RawValue
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.AdjustedValue != nil {
+		in, out := &in.AdjustedValue, &out.AdjustedValue
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricForecastStatus.
+func (in *MetricForecastStatus) DeepCopy() *MetricForecastStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricForecastStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricProvider) DeepCopyInto(out *MetricProvider) {
 	*out = *in
@@ -565,9 +859,44 @@ func (in *MetricProvider) DeepCopy() *MetricProvider {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusBasicAuth) DeepCopyInto(out *PrometheusBasicAuth) {
+	*out = *in
+	if in.PasswordSecret != nil {
+		in, out := &in.PasswordSecret, &out.PasswordSecret
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusBasicAuth.
+func (in *PrometheusBasicAuth) DeepCopy() *PrometheusBasicAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusBasicAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PrometheusProviderSource) DeepCopyInto(out *PrometheusProviderSource) {
 	*out = *in
+	if in.BearerTokenSecret != nil {
+		in, out := &in.BearerTokenSecret, &out.BearerTokenSecret
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BasicAuth != nil {
+		in, out := &in.BasicAuth, &out.BasicAuth
+		*out = new(PrometheusBasicAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLSConfig != nil {
+		in, out := &in.TLSConfig, &out.TLSConfig
+		*out = new(PrometheusTLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusProviderSource.
@@ -580,6 +909,26 @@ func (in *PrometheusProviderSource) DeepCopy() *PrometheusProviderSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusTLSConfig) DeepCopyInto(out *PrometheusTLSConfig) {
+	*out = *in
+	if in.KeySecret != nil {
+		in, out := &in.KeySecret, &out.KeySecret
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusTLSConfig.
+func (in *PrometheusTLSConfig) DeepCopy() *PrometheusTLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusTLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProviderSource) DeepCopyInto(out *ProviderSource) {
 	*out = *in
@@ -591,7 +940,7 @@ func (in *ProviderSource) DeepCopyInto(out *ProviderSource) {
 	if in.Prometheus != nil {
 		in, out := &in.Prometheus, &out.Prometheus
 		*out = new(PrometheusProviderSource)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -604,3 +953,56 @@ func (in *ProviderSource) DeepCopy() *ProviderSource {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduledOverride) DeepCopyInto(out *ScheduledOverride) {
+	*out = *in
+	if in.Start != nil {
+		in, out := &in.Start, &out.Start
+		*out = (*in).DeepCopy()
+	}
+	if in.End != nil {
+		in, out := &in.End, &out.End
+		*out = (*in).DeepCopy()
+	}
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ForecastMultiplier != nil {
+		in, out := &in.ForecastMultiplier, &out.ForecastMultiplier
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduledOverride.
+func (in *ScheduledOverride) DeepCopy() *ScheduledOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduledOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShadowStatus) DeepCopyInto(out *ShadowStatus) {
+	*out = *in
+	if in.RecommendedReplicas != nil {
+		in, out := &in.RecommendedReplicas, &out.RecommendedReplicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShadowStatus.
+func (in *ShadowStatus) DeepCopy() *ShadowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ShadowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// FieldManager is a name of the field manager used for server-side apply of generated resources.
+	FieldManager = "ihpa-controller"
+
+	// appliedHashAnnotation records a hash of the last applied configuration.
+	// Fields removed from the generated resource are not found by comparing with the existing one,
+	// so the hash is also compared to decide whether the resource is unchanged.
+	appliedHashAnnotation = annotationPrefix + "/applied-hash"
+)
+
+// applyChild creates or updates obj with server-side apply.
+// Only fields set in obj are owned by the controller, so fields set by other actors are kept.
+// Nothing is written if the existing resource already has the fields of obj.
+// obj is overwritten by the resource on the cluster.
+func applyChild(ctx context.Context, c client.Client, scheme *runtime.Scheme, obj runtime.Object) (ctrlutil.OperationResult, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return ctrlutil.OperationResultNone, err
+	}
+	desired, err := applyConfiguration(obj)
+	if err != nil {
+		return ctrlutil.OperationResultNone, fmt.Errorf("failed to generate apply configuration: %w", err)
+	}
+	desired.SetGroupVersionKind(gvk)
+
+	// typed objects are read from the cache
+	var existing runtime.Object
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		existing = u
+	} else if existing, err = scheme.New(gvk); err != nil {
+		return ctrlutil.OperationResultNone, err
+	}
+	key := types.NamespacedName{Namespace: desired.GetNamespace(), Name: desired.GetName()}
+	result := ctrlutil.OperationResultUpdated
+	if err := c.Get(ctx, key, existing); apierrors.IsNotFound(err) {
+		result = ctrlutil.OperationResultCreated
+	} else if err != nil {
+		return ctrlutil.OperationResultNone, err
+	} else {
+		current, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+		if err != nil {
+			return ctrlutil.OperationResultNone, err
+		}
+		if appliedConfigurationUnchanged(desired, current) {
+			return ctrlutil.OperationResultNone, copyObject(existing, obj)
+		}
+	}
+
+	if err := c.Patch(ctx, desired, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return ctrlutil.OperationResultNone, err
+	}
+	return result, copyObject(desired, obj)
+}
+
+// applyConfiguration converts obj to the configuration for server-side apply.
+// The status and the fields managed by the API server are dropped,
+// and a hash of the configuration is added to the annotations.
+func applyConfiguration(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: runtime.DeepCopyJSON(content)}
+	delete(u.Object, "status")
+	for _, field := range []string{"creationTimestamp", "resourceVersion", "uid", "generation", "managedFields", "selfLink"} {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(u.Object, "metadata", "annotations", appliedHashAnnotation)
+
+	hash, err := configurationHash(u.Object)
+	if err != nil {
+		return nil, err
+	}
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[appliedHashAnnotation] = hash
+	u.SetAnnotations(annotations)
+	return u, nil
+}
+
+// appliedConfigurationUnchanged returns true if current is last applied with desired
+// and every field of desired has the same value in current.
+func appliedConfigurationUnchanged(desired *unstructured.Unstructured, current map[string]interface{}) bool {
+	u := &unstructured.Unstructured{Object: current}
+	if u.GetAnnotations()[appliedHashAnnotation] != desired.GetAnnotations()[appliedHashAnnotation] {
+		return false
+	}
+	// apiVersion and kind are not filled in typed objects read from the cache
+	spec := desired.DeepCopy().Object
+	delete(spec, "apiVersion")
+	delete(spec, "kind")
+	return equality.Semantic.DeepDerivative(spec, current)
+}
+
+// configurationHash returns a hash of the JSON representation of the configuration.
+// Keys of maps are sorted by the encoder, so the hash is stable.
+func configurationHash(content map[string]interface{}) (string, error) {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// copyObject copies src into dst through the unstructured representation.
+func copyObject(src, dst runtime.Object) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(src)
+	if err != nil {
+		return err
+	}
+	if u, ok := dst.(*unstructured.Unstructured); ok {
+		u.Object = runtime.DeepCopyJSON(content)
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, dst)
+}
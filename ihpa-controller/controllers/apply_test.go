@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestAppliedConfigurationUnchanged(t *testing.T) {
+	suspend := true
+	desired := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default", Labels: map[string]string{ihpaNameLabel: "nginx"}},
+		Spec:       batchv1beta1.CronJobSpec{Schedule: "10 4 * * *", Suspend: &suspend},
+	}
+	applied, err := applyConfiguration(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := applied.Object["status"]; ok {
+		t.Fatalf("status is included in the apply configuration (got=%v)", applied.Object)
+	}
+	// the object which is applied and then changed by the API server and other actors
+	current := func(mutate func(cj *batchv1beta1.CronJob)) map[string]interface{} {
+		cj := desired.DeepCopy()
+		cj.Annotations = applied.GetAnnotations()
+		cj.ResourceVersion = "100"
+		cj.Labels["app"] = "nginx"
+		cj.Spec.ConcurrencyPolicy = batchv1beta1.AllowConcurrent
+		if mutate != nil {
+			mutate(cj)
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+	resumed := desired.DeepCopy()
+	resumed.Spec.Suspend = nil
+	resumedApplied, err := applyConfiguration(resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		desired  map[string]interface{}
+		current  map[string]interface{}
+		expected bool
+	}{
+		{name: "unchanged", desired: applied.Object, current: current(nil), expected: true},
+		{name: "changed by others", desired: applied.Object, current: current(func(cj *batchv1beta1.CronJob) { cj.Spec.Schedule = "0 0 * * *" }), expected: false},
+		{name: "not applied", desired: applied.Object, current: current(func(cj *batchv1beta1.CronJob) { cj.Annotations = nil }), expected: false},
+		// the removed field is found by the hash
+		{name: "field removed", desired: resumedApplied.Object, current: current(nil), expected: false},
+	}
+	for _, tt := range tests {
+		u := applied.DeepCopy()
+		u.Object = tt.desired
+		if got := appliedConfigurationUnchanged(u, tt.current); got != tt.expected {
+			t.Fatalf("%s: unchanged is not match (got=%v, exp=%v)", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestApplyChildUnchanged(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	desired := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu-config", Namespace: "default"},
+		Data:       map[string]string{"config.json": "{}"},
+	}
+	applied, err := applyConfiguration(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := desired.DeepCopy()
+	existing.Annotations = applied.GetAnnotations()
+	existing.Data["extra"] = "set by others"
+	c := fake.NewFakeClientWithScheme(scheme, existing)
+
+	// the fake client does not support server-side apply, so this fails if anything is written
+	obj := desired.DeepCopy()
+	result, err := applyChild(context.Background(), c, scheme, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != ctrlutil.OperationResultNone {
+		t.Fatalf("result is not match (got=%s, exp=%s)", result, ctrlutil.OperationResultNone)
+	}
+	if obj.Data["extra"] != "set by others" {
+		t.Fatalf("object is not overwritten by the existing one (got=%v)", obj)
+	}
+}
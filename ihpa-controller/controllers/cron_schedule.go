@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronSchedule is a parsed cron expression of 5 fields (minute hour day-of-month month day-of-week).
+// The expression is parsed by robfig/cron as with CronJob, so names ("MON", "JAN") and
+// descriptors ("@daily", "@hourly") are also supported.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are true if the field is "*", for the rule of day matching.
+	domStar, dowStar bool
+}
+
+// cronField is the range of a field of cron expression.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 6},
+}
+
+// cronStarBit is set by robfig/cron in the bits of a field written as "*".
+const cronStarBit = 1 << 63
+
+// parseCronSchedule parses a cron expression of 5 fields or a descriptor.
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	parsed, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := parsed.(*cron.SpecSchedule)
+	if !ok {
+		return nil, fmt.Errorf("unsupported schedule, use a cron expression instead: %s", spec)
+	}
+	if s.Location != time.Local {
+		return nil, fmt.Errorf("time zone in schedule is not supported, use timeZone instead: %s", spec)
+	}
+
+	return &cronSchedule{
+		minute:  s.Minute &^ cronStarBit,
+		hour:    s.Hour &^ cronStarBit,
+		dom:     s.Dom &^ cronStarBit,
+		month:   s.Month &^ cronStarBit,
+		dow:     s.Dow &^ cronStarBit,
+		domStar: s.Dom&cronStarBit != 0,
+		dowStar: s.Dow&cronStarBit != 0,
+	}, nil
+}
+
+// next returns the first time matched with the schedule after t in the location of t.
+// This returns zero time if no time is matched within 5 years.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	spec := &cron.SpecSchedule{
+		Second:   1,
+		Minute:   s.minute,
+		Hour:     s.hour,
+		Dom:      s.dom,
+		Month:    s.month,
+		Dow:      s.dow,
+		Location: time.Local,
+	}
+	if s.domStar {
+		spec.Dom |= cronStarBit
+	}
+	if s.dowStar {
+		spec.Dow |= cronStarBit
+	}
+	return spec.Next(t)
+}
+
+// String returns the cron expression of the schedule.
+// Consecutive values are written as ranges, and steps are expanded.
+func (s *cronSchedule) String() string {
+	fields := []string{
+		formatCronField(s.minute, cronFields[0], true),
+		formatCronField(s.hour, cronFields[1], true),
+		// day of month and day of week are "*" only if they are, for the rule of day matching
+		"*",
+		formatCronField(s.month, cronFields[3], true),
+		"*",
+	}
+	if !s.domStar {
+		fields[2] = formatCronField(s.dom, cronFields[2], false)
+	}
+	if !s.dowStar {
+		fields[4] = formatCronField(s.dow, cronFields[4], false)
+	}
+	return strings.Join(fields, " ")
+}
+
+// formatCronField formats bits of matched values to a field of cron expression.
+// If star is true, the field matched with all values is written as "*".
+func formatCronField(set uint64, f cronField, star bool) string {
+	full := true
+	for v := f.min; v <= f.max; v++ {
+		full = full && set&(1<<uint(v)) != 0
+	}
+	if star && full {
+		return "*"
+	}
+
+	var exprs []string
+	for v := f.min; v <= f.max; v++ {
+		if set&(1<<uint(v)) == 0 {
+			continue
+		}
+		end := v
+		for end+1 <= f.max && set&(1<<uint(end+1)) != 0 {
+			end++
+		}
+		switch {
+		case end == v:
+			exprs = append(exprs, strconv.Itoa(v))
+		case end == v+1:
+			exprs = append(exprs, strconv.Itoa(v), strconv.Itoa(end))
+		default:
+			exprs = append(exprs, fmt.Sprintf("%d-%d", v, end))
+		}
+		v = end
+	}
+	return strings.Join(exprs, ",")
+}
+
+// inUTC converts the schedule in loc to UTC with the offset of loc at now.
+// The converted schedule follows changes of the offset (e.g. daylight saving time) only when this is called again.
+// An error is returned if the converted times cannot be written in a cron expression,
+// e.g. the day of month is restricted and some times are moved to another day.
+func (s *cronSchedule) inUTC(loc *time.Location, now time.Time) (*cronSchedule, error) {
+	_, offset := now.In(loc).Zone()
+	shift := -offset / 60
+	converted := *s
+	if shift == 0 {
+		return &converted, nil
+	}
+
+	const minutesOfDay = 24 * 60
+	converted.minute, converted.hour = 0, 0
+	var count int
+	dayShifts := make(map[int]struct{})
+	for h := 0; h < 24; h++ {
+		if s.hour&(1<<uint(h)) == 0 {
+			continue
+		}
+		for m := 0; m < 60; m++ {
+			if s.minute&(1<<uint(m)) == 0 {
+				continue
+			}
+			t := h*60 + m + shift
+			day := 0
+			if t < 0 {
+				day = -1
+			} else if t >= minutesOfDay {
+				day = 1
+			}
+			t -= day * minutesOfDay
+			converted.minute |= 1 << uint(t%60)
+			converted.hour |= 1 << uint(t/60)
+			dayShifts[day] = struct{}{}
+			count++
+		}
+	}
+	// the times must be the product of minutes and hours
+	if bits.OnesCount64(converted.minute)*bits.OnesCount64(converted.hour) != count {
+		return nil, fmt.Errorf("minutes and hours cannot be written in UTC")
+	}
+
+	allMonths := s.month == (1<<13)-2
+	switch {
+	case len(dayShifts) > 1:
+		if !s.domStar || !s.dowStar || !allMonths {
+			return nil, fmt.Errorf("times are moved to different days in UTC with restricted days")
+		}
+	case len(dayShifts) == 1:
+		var day int
+		for d := range dayShifts {
+			day = d
+		}
+		if day == 0 {
+			break
+		}
+		if !s.domStar || !allMonths {
+			return nil, fmt.Errorf("times are moved to another day in UTC with restricted day of month or month")
+		}
+		if !s.dowStar {
+			converted.dow = 0
+			for w := 0; w < 7; w++ {
+				if s.dow&(1<<uint(w)) != 0 {
+					converted.dow |= 1 << uint((w+day+7)%7)
+				}
+			}
+		}
+	}
+	return &converted, nil
+}
+
+// nextZoneTransition returns the first time after now when the offset of loc is changed.
+// This returns zero time if the offset is not changed within a year.
+func nextZoneTransition(loc *time.Location, now time.Time) time.Time {
+	_, offset := now.In(loc).Zone()
+	changed := func(t time.Time) bool {
+		_, o := t.In(loc).Zone()
+		return o != offset
+	}
+
+	// offsets are not changed twice in a day
+	lo, hi := now, now
+	for {
+		hi = lo.Add(24 * time.Hour)
+		if changed(hi) {
+			break
+		}
+		if hi.After(now.AddDate(1, 0, 0)) {
+			return time.Time{}
+		}
+		lo = hi
+	}
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if changed(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi.Truncate(time.Second)
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		spec      string
+		expectErr bool
+	}{
+		{spec: "0 20 * * 5"},
+		{spec: "*/15 9-18 1,15 * 1-5"},
+		{spec: "0 20 * * MON"},
+		{spec: "0 0 1 JAN-MAR *"},
+		{spec: "@daily"},
+		{spec: "@hourly"},
+		{spec: "0 20 * *", expectErr: true},
+		{spec: "60 20 * * *", expectErr: true},
+		// as with CronJob, Sunday is only 0
+		{spec: "0 0 * * 7", expectErr: true},
+		{spec: "@every 1h", expectErr: true},
+		{spec: "CRON_TZ=Asia/Tokyo 0 20 * * *", expectErr: true},
+		{spec: "0 20-10 * * *", expectErr: true},
+		{spec: "*/0 * * * *", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseCronSchedule(tt.spec)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("error is not match (spec=%s, err=%v, expectErr=%v)", tt.spec, err, tt.expectErr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	// 2020-01-01 is Wednesday
+	base := time.Date(2020, 1, 1, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		from     time.Time
+		expected time.Time
+	}{
+		{
+			spec:     "*/15 * * * *",
+			from:     base,
+			expected: time.Date(2020, 1, 1, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			// strictly after the given time
+			spec:     "30 10 * * *",
+			from:     time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC),
+			expected: time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			// Friday
+			spec:     "0 20 * * 5",
+			from:     base,
+			expected: time.Date(2020, 1, 3, 20, 0, 0, 0, time.UTC),
+		},
+		{
+			// Sunday by name
+			spec:     "0 0 * * SUN",
+			from:     base,
+			expected: time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// day of month or day of week
+			spec:     "0 0 10 * 5",
+			from:     base,
+			expected: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			spec:     "0 0 29 2 *",
+			from:     base,
+			expected: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// in the location of the given time
+			spec:     "0 9 * * *",
+			from:     base.In(jst),
+			expected: time.Date(2020, 1, 2, 9, 0, 0, 0, jst),
+		},
+		{
+			spec:     "0 0 31 2 *",
+			from:     base,
+			expected: time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		s, err := parseCronSchedule(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.next(tt.from); !got.Equal(tt.expected) {
+			t.Fatalf("next time is not match (spec=%s, got=%v, exp=%v)", tt.spec, got, tt.expected)
+		}
+	}
+}
+
+func TestCronScheduleString(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{spec: "0 20 * * 5", expected: "0 20 * * 5"},
+		{spec: "*/15 9-18 1,15 * 1-5", expected: "0,15,30,45 9-18 1,15 * 1-5"},
+		{spec: "0 0 * * SUN", expected: "0 0 * * 0"},
+		{spec: "0 9 * JAN-MAR MON-FRI", expected: "0 9 * 1-3 1-5"},
+		{spec: "@daily", expected: "0 0 * * *"},
+		{spec: "@hourly", expected: "0 * * * *"},
+		{spec: "0-59 */1 * 1-12 *", expected: "* * * * *"},
+		// restricted days are kept for the rule of day matching
+		{spec: "0 0 1 * 0-6", expected: "0 0 1 * 0-6"},
+	}
+
+	for _, tt := range tests {
+		s, err := parseCronSchedule(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.String(); got != tt.expected {
+			t.Fatalf("cron expression is not match (spec=%s, got=%s, exp=%s)", tt.spec, got, tt.expected)
+		}
+	}
+}
+
+func TestCronScheduleInUTC(t *testing.T) {
+	loadLocation := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loc
+	}
+	tokyo := loadLocation("Asia/Tokyo")
+	newYork := loadLocation("America/New_York")
+	kolkata := loadLocation("Asia/Kolkata")
+	winter := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+	summer := time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec      string
+		loc       *time.Location
+		now       time.Time
+		expected  string
+		expectErr bool
+	}{
+		{spec: "0 12 * * *", loc: tokyo, now: winter, expected: "0 3 * * *"},
+		{spec: "*/15 9-18 1,15 * 1-5", loc: time.UTC, now: winter, expected: "0,15,30,45 9-18 1,15 * 1-5"},
+		// weekdays are moved to the previous day
+		{spec: "30 2 * * 1-5", loc: tokyo, now: winter, expected: "30 17 * * 0-4"},
+		{spec: "0 8-10 * * *", loc: tokyo, now: winter, expected: "0 0,1,23 * * *"},
+		// daylight saving time
+		{spec: "0 4 * * *", loc: newYork, now: winter, expected: "0 9 * * *"},
+		{spec: "0 4 * * *", loc: newYork, now: summer, expected: "0 8 * * *"},
+		{spec: "0 4 * * *", loc: kolkata, now: winter, expected: "30 22 * * *"},
+		// 4:00 and 4:30 in Kolkata are 22:30 and 23:00 in UTC
+		{spec: "0,30 4 * * *", loc: kolkata, now: winter, expectErr: true},
+		{spec: "0 2 1 * *", loc: tokyo, now: winter, expectErr: true},
+		{spec: "0 2 * 1 *", loc: tokyo, now: winter, expectErr: true},
+		{spec: "0 8-10 * * 1", loc: tokyo, now: winter, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		s, err := parseCronSchedule(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.inUTC(tt.loc, tt.now)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("error is not match (spec=%s, loc=%s, err=%v, expectErr=%v)", tt.spec, tt.loc, err, tt.expectErr)
+		}
+		if err == nil && got.String() != tt.expected {
+			t.Fatalf("cron expression is not match (spec=%s, loc=%s, got=%s, exp=%s)", tt.spec, tt.loc, got, tt.expected)
+		}
+	}
+}
+
+func TestNextZoneTransition(t *testing.T) {
+	loadLocation := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loc
+	}
+	now := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		loc      *time.Location
+		now      time.Time
+		expected time.Time
+	}{
+		// daylight saving time starts at 2:00 EST and ends at 2:00 EDT
+		{loc: loadLocation("America/New_York"), now: now, expected: time.Date(2020, 3, 8, 7, 0, 0, 0, time.UTC)},
+		{loc: loadLocation("America/New_York"), now: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC), expected: time.Date(2020, 11, 1, 6, 0, 0, 0, time.UTC)},
+		{loc: loadLocation("Europe/London"), now: now, expected: time.Date(2020, 3, 29, 1, 0, 0, 0, time.UTC)},
+		{loc: loadLocation("Asia/Tokyo"), now: now, expected: time.Time{}},
+		{loc: time.UTC, now: now, expected: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if got := nextZoneTransition(tt.loc, tt.now); !got.Equal(tt.expected) {
+			t.Fatalf("next transition is not match (loc=%s, got=%v, exp=%v)", tt.loc, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"fmt"
+
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	CronJobAPIVersionV1      = "batch/v1"
+	CronJobAPIVersionV1beta1 = "batch/v1beta1"
+
+	cronJobKind     = "CronJob"
+	cronJobResource = "cronjobs"
+)
+
+// DiscoverCronJobAPIVersion returns the newest version of CronJob API served by the cluster.
+// batch/v1 is preferred because batch/v1beta1 is removed in Kubernetes 1.25.
+// batch/v1 is served for Job also, so the resources of the version are checked.
+func DiscoverCronJobAPIVersion(dc discovery.DiscoveryInterface) (string, error) {
+	groups, err := dc.ServerGroups()
+	if err != nil {
+		return "", fmt.Errorf("failed to discover api groups: %w", err)
+	}
+
+	served := make(map[string]struct{})
+	for _, g := range groups.Groups {
+		if g.Name != batchv1beta1.GroupName {
+			continue
+		}
+		for _, v := range g.Versions {
+			served[v.GroupVersion] = struct{}{}
+		}
+	}
+	for _, v := range []string{CronJobAPIVersionV1, CronJobAPIVersionV1beta1} {
+		if _, ok := served[v]; !ok {
+			continue
+		}
+		resources, err := dc.ServerResourcesForGroupVersion(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to discover resources of %s: %w", v, err)
+		}
+		for _, r := range resources.APIResources {
+			if r.Name == cronJobResource {
+				return v, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cronjobs are served in neither %s nor %s", CronJobAPIVersionV1, CronJobAPIVersionV1beta1)
+}
+
+// cronJobTimeZoneVersion is the first version of Kubernetes which enables spec.timeZone of CronJob by default.
+var cronJobTimeZoneVersion = utilversion.MustParseGeneric("1.25")
+
+// DiscoverCronJobTimeZone returns true if CronJobs of apiVersion support spec.timeZone.
+// spec.timeZone is only in batch/v1, and it is dropped by the API server before Kubernetes 1.25.
+func DiscoverCronJobTimeZone(dc discovery.ServerVersionInterface, apiVersion string) (bool, error) {
+	if apiVersion != CronJobAPIVersionV1 {
+		return false, nil
+	}
+	info, err := dc.ServerVersion()
+	if err != nil {
+		return false, fmt.Errorf("failed to discover server version: %w", err)
+	}
+	v, err := utilversion.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse server version: %w", err)
+	}
+	return v.AtLeast(cronJobTimeZoneVersion), nil
+}
+
+// cronJobGroupVersionKind returns GVK of CronJob for apiVersion.
+// batch/v1beta1 is used if apiVersion is empty.
+func cronJobGroupVersionKind(apiVersion string) schema.GroupVersionKind {
+	if apiVersion == "" {
+		apiVersion = CronJobAPIVersionV1beta1
+	}
+	return schema.FromAPIVersionAndKind(apiVersion, cronJobKind)
+}
+
+// newCronJobObject returns an empty CronJob of apiVersion to be watched.
+func newCronJobObject(apiVersion string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(cronJobGroupVersionKind(apiVersion))
+	return u
+}
+
+// newUnstructuredCronJob converts the generated CronJob to apiVersion.
+// The spec of batch/v1beta1 is compatible with batch/v1, which is not defined in the client library of this controller.
+// timeZone is set to spec.timeZone of batch/v1 if it is not empty.
+func newUnstructuredCronJob(cj *batchv1beta1.CronJob, apiVersion, timeZone string) (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert cronjob: %w", err)
+	}
+	// status is owned by kube-controller-manager
+	delete(obj, "status")
+	if timeZone != "" {
+		if err := unstructured.SetNestedField(obj, timeZone, "spec", "timeZone"); err != nil {
+			return nil, fmt.Errorf("failed to set time zone of cronjob: %w", err)
+		}
+	}
+
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetGroupVersionKind(cronJobGroupVersionKind(apiVersion))
+	return u, nil
+}
+
+// typedCronJob converts the CronJob of any version to batch/v1beta1.
+// Fields which are only in batch/v1 are dropped.
+func typedCronJob(u *unstructured.Unstructured) (*batchv1beta1.CronJob, error) {
+	cj := &batchv1beta1.CronJob{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, cj); err != nil {
+		return nil, fmt.Errorf("failed to convert cronjob: %w", err)
+	}
+	return cj, nil
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"testing"
+
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDiscoverCronJobAPIVersion(t *testing.T) {
+	tests := []struct {
+		resources map[string][]string
+		expected  string
+		expectErr bool
+	}{
+		{
+			resources: map[string][]string{"batch/v1": {"jobs", "cronjobs"}, "batch/v1beta1": {"cronjobs"}},
+			expected:  CronJobAPIVersionV1,
+		},
+		{
+			resources: map[string][]string{"batch/v1": {"jobs"}, "batch/v1beta1": {"cronjobs"}},
+			expected:  CronJobAPIVersionV1beta1,
+		},
+		{
+			resources: map[string][]string{"batch/v1": {"jobs"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		dc := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+		for gv, names := range tt.resources {
+			list := &metav1.APIResourceList{GroupVersion: gv}
+			for _, name := range names {
+				list.APIResources = append(list.APIResources, metav1.APIResource{Name: name})
+			}
+			dc.Resources = append(dc.Resources, list)
+		}
+		got, err := DiscoverCronJobAPIVersion(dc)
+		if tt.expectErr {
+			if err == nil {
+				t.Fatalf("error is expected (got=%s)", got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Fatalf("cronjob api version is not match (got=%s, exp=%s)", got, tt.expected)
+		}
+	}
+}
+
+func TestDiscoverCronJobTimeZone(t *testing.T) {
+	tests := []struct {
+		apiVersion    string
+		serverVersion string
+		expected      bool
+	}{
+		{apiVersion: CronJobAPIVersionV1, serverVersion: "v1.25.0", expected: true},
+		{apiVersion: CronJobAPIVersionV1, serverVersion: "v1.27.3-gke.100", expected: true},
+		{apiVersion: CronJobAPIVersionV1, serverVersion: "v1.24.9", expected: false},
+		{apiVersion: CronJobAPIVersionV1beta1, serverVersion: "v1.25.0", expected: false},
+	}
+
+	for _, tt := range tests {
+		dc := &fakediscovery.FakeDiscovery{
+			Fake:               &clienttesting.Fake{},
+			FakedServerVersion: &version.Info{GitVersion: tt.serverVersion},
+		}
+		got, err := DiscoverCronJobTimeZone(dc, tt.apiVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Fatalf("time zone support is not match (apiVersion=%s, serverVersion=%s, got=%v, exp=%v)", tt.apiVersion, tt.serverVersion, got, tt.expected)
+		}
+	}
+}
+
+func TestNewUnstructuredCronJob(t *testing.T) {
+	cj := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default"},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:                   "57 4 * * *",
+			ConcurrencyPolicy:          batchv1beta1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: func(i int32) *int32 { return &i }(1),
+		},
+	}
+
+	tests := []struct {
+		apiVersion      string
+		timeZone        string
+		expectedVersion string
+	}{
+		{apiVersion: CronJobAPIVersionV1, expectedVersion: "batch/v1"},
+		{apiVersion: CronJobAPIVersionV1, timeZone: "Asia/Tokyo", expectedVersion: "batch/v1"},
+		{apiVersion: "", expectedVersion: "batch/v1beta1"},
+	}
+
+	for _, tt := range tests {
+		got, err := newUnstructuredCronJob(cj, tt.apiVersion, tt.timeZone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.GetAPIVersion() != tt.expectedVersion || got.GetKind() != cronJobKind {
+			t.Fatalf("apiVersion/kind is not match (got=%s/%s, exp=%s/%s)", got.GetAPIVersion(), got.GetKind(), tt.expectedVersion, cronJobKind)
+		}
+		if schedule, _, _ := unstructured.NestedString(got.Object, "spec", "schedule"); schedule != "57 4 * * *" {
+			t.Fatalf("schedule is not match (got=%s, exp=%s)", schedule, "57 4 * * *")
+		}
+		if _, ok := got.Object["status"]; ok {
+			t.Fatalf("status should be removed")
+		}
+		if timeZone, _, _ := unstructured.NestedString(got.Object, "spec", "timeZone"); timeZone != tt.timeZone {
+			t.Fatalf("time zone is not match (got=%s, exp=%s)", timeZone, tt.timeZone)
+		}
+	}
+}
+
+func TestTypedCronJob(t *testing.T) {
+	// fields only in batch/v1 are dropped
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "CronJob",
+		"metadata":   map[string]interface{}{"name": "ihpa-nginx-cpu", "uid": "uid"},
+		"spec":       map[string]interface{}{"schedule": "57 4 * * *", "timeZone": "Etc/UTC"},
+		"status": map[string]interface{}{
+			"lastScheduleTime":   "2020-01-01T04:57:00Z",
+			"lastSuccessfulTime": "2020-01-01T05:00:00Z",
+		},
+	}}
+
+	got, err := typedCronJob(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.APIVersion != "batch/v1" || got.GetUID() != "uid" || got.Spec.Schedule != "57 4 * * *" {
+		t.Fatalf("cronjob is not match (got=%v)", got)
+	}
+	if got.Status.LastScheduleTime == nil || got.Status.LastScheduleTime.Unix() != 1577854620 {
+		t.Fatalf("last schedule time is not match (got=%v)", got.Status.LastScheduleTime)
+	}
+
+	// the owner reference of on-demand jobs points the version on the cluster
+	job := manualJobResource(got, "1")
+	if job.OwnerReferences[0].APIVersion != "batch/v1" {
+		t.Fatalf("apiVersion of owner is not match (got=%s, exp=%s)", job.OwnerReferences[0].APIVersion, "batch/v1")
+	}
+}
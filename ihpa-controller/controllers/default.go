@@ -2,4 +2,7 @@ package controllers
 
 const (
 	DefaultImage = "cyberagentoss/intelligent-hpa-fittingjob:latest"
+
+	// DefaultJitterMinutes is the window of the delay added to executeOn of fitting job.
+	DefaultJitterMinutes = 60
 )
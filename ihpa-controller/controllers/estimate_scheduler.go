@@ -0,0 +1,698 @@
+package controllers
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/externalmetrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultEstimateWorkers is the default number of workers which send forecasted metrics.
+	DefaultEstimateWorkers = 10
+
+	// DefaultEstimatorStateSaveInterval is the default interval of saving the state of targets.
+	// Targets update their state at every send, so the state is saved at this rate at most.
+	DefaultEstimatorStateSaveInterval = 30 * time.Second
+
+	// idleWaitTime is the wait time of the scheduler when no target is scheduled.
+	// The scheduler wakes up immediately when a target is scheduled, so this is only a safety net.
+	idleWaitTime = time.Minute
+)
+
+var (
+	ErrEstimateTargetExists   = errors.New("estimate target already exists")
+	ErrEstimateTargetNotFound = errors.New("estimate target is not found")
+)
+
+// EstimateScheduler sends forecasted metrics of all EstimateTargets.
+// It keeps a min-heap of the next send time of the targets, and dispatches due targets to a bounded worker pool.
+// Targets which have no data to send are not scheduled, so idle targets cost nothing.
+type EstimateScheduler struct {
+	// Workers is the number of concurrent sends.
+	Workers int
+	// StateSaveInterval is the interval of saving the state of targets to their StateStore.
+	StateSaveInterval time.Duration
+	Log               logr.Logger
+
+	mu      sync.Mutex
+	targets map[string]*scheduledTarget
+	queue   estimateQueue
+	wakeCh  chan struct{}
+
+	// dirtyMu guards dirty, which is IDs of targets whose state is changed after the last save.
+	// This may be acquired while holding scheduledTarget.mu.
+	dirtyMu sync.Mutex
+	dirty   map[string]struct{}
+	// saveMu serializes saving and deleting the state, so that the state of a removed target is not saved again.
+	saveMu sync.Mutex
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// scheduledTarget is an EstimateTarget and its data managed by EstimateScheduler.
+type scheduledTarget struct {
+	// mu guards the fields below except the ones guarded by EstimateScheduler.mu.
+	mu     sync.Mutex
+	target EstimateTarget
+	// data is forecasted data sorted by EstimateUnixTime, and position is the index of the next datum to send.
+	data     []EstimateDatum
+	position int
+	// dataVersion is incremented when data is replaced, to detect replacement during a send.
+	dataVersion int
+	// dataHash is a hash of the last loaded payload, to ignore the same payload loaded again on reconcile.
+	dataHash       string
+	loaded         bool
+	pastDatumQueue PastEstimateDatumQueue
+	removed        bool
+	// sendFailing is true while the latest send failed.
+	sendFailing bool
+	// ctx is canceled when the target is removed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// guarded by EstimateScheduler.mu
+	running   bool
+	heapIndex int
+	nextTime  time.Time
+}
+
+func NewEstimateScheduler(workers int, log logr.Logger) *EstimateScheduler {
+	if workers <= 0 {
+		workers = DefaultEstimateWorkers
+	}
+	return &EstimateScheduler{
+		Workers:           workers,
+		StateSaveInterval: DefaultEstimatorStateSaveInterval,
+		Log:               log,
+		targets:           make(map[string]*scheduledTarget),
+		wakeCh:            make(chan struct{}, 1),
+		now:               time.Now,
+	}
+}
+
+// Has returns true if the target of id is managed by the scheduler.
+func (s *EstimateScheduler) Has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.targets[id]
+	return ok
+}
+
+// Add starts estimating the target.
+// The state saved in StateStore of the target is restored if it exists.
+func (s *EstimateScheduler) Add(target EstimateTarget) error {
+	st := &scheduledTarget{
+		target:         target,
+		pastDatumQueue: PastEstimateDatumQueue(make([]EstimateDatum, 0, 288)), // 5 minutes interval 1 day capacity
+		heapIndex:      -1,
+	}
+	st.target.Logger = s.Log
+	st.ctx, st.cancel = context.WithCancel(context.Background())
+
+	// restore the state saved before restart of controller.
+	// data is loaded again by reconcile, and the past data is kept for adjusting the first datum.
+	if h, q, ok := st.target.loadState(); ok {
+		st.dataHash, st.pastDatumQueue = h, q
+		st.target.V(LogicMessageLogLevel).Info("restore estimator state", "id", target.ID, "past_queue_size", len(q))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.targets[target.ID]; ok {
+		st.cancel()
+		return ErrEstimateTargetExists
+	}
+	s.Log.V(LogicMessageLogLevel).Info("create estimator", "id", target.ID)
+	s.targets[target.ID] = st
+	s.scheduleLocked(st)
+	st.target.event(corev1.EventTypeNormal, EventReasonEstimatorStarted, "Started estimator %s (mode=%s)", target.Name, target.EstimateMode)
+	return nil
+}
+
+// Update overwrites the configuration of the target by non-zero fields of patch.
+// Data and the position of the target are kept.
+func (s *EstimateScheduler) Update(patch EstimateTarget) error {
+	st, ok := s.get(patch.ID)
+	if !ok {
+		return ErrEstimateTargetNotFound
+	}
+	s.Log.V(LogicMessageLogLevel).Info("update estimator", "id", patch.ID)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.target.updateEstimateTarget(&patch)
+}
+
+// Remove stops estimating the target and cleans up the values published by the target.
+// A send in progress is canceled before publishing the result.
+func (s *EstimateScheduler) Remove(id string) {
+	s.mu.Lock()
+	st, ok := s.targets[id]
+	if ok {
+		delete(s.targets, id)
+		if st.heapIndex >= 0 {
+			heap.Remove(&s.queue, st.heapIndex)
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.Log.V(LogicMessageLogLevel).Info("stop estimating", "id", id)
+	st.cancel()
+	st.mu.Lock()
+	st.removed = true
+	et := st.target
+	st.mu.Unlock()
+
+	if et.ExternalMetricStore != nil {
+		et.ExternalMetricStore.Delete(et.ID)
+	}
+	et.deleteEstimatorMetrics()
+	et.event(corev1.EventTypeNormal, EventReasonEstimatorStopped, "Stopped estimator %s", et.Name)
+	if et.ForecastSnapshots != nil {
+		et.ForecastSnapshots.Delete(et.ID)
+	}
+	if et.StateStore != nil {
+		// wait for the state being saved, which is not saved again because the target is marked as removed
+		s.saveMu.Lock()
+		err := et.StateStore.Delete(et.ID)
+		s.saveMu.Unlock()
+		if err != nil {
+			s.Log.V(LogicMessageLogLevel).Info("failed to delete estimator state", "id", et.ID, "error_msg", err)
+		}
+	}
+}
+
+// Load parses forecasted data as csv and merges it to the data of the target.
+// Data older than now are dropped, and the target is rescheduled to the first datum.
+// Nothing is changed if raw is the same as the last loaded one, because it is loaded again on every reconcile.
+func (s *EstimateScheduler) Load(id string, raw []byte) error {
+	st, ok := s.get(id)
+	if !ok {
+		return ErrEstimateTargetNotFound
+	}
+	hash := estimateDataHash(raw)
+	st.mu.Lock()
+	unchanged := st.loaded && st.dataHash == hash
+	st.mu.Unlock()
+	if unchanged {
+		st.target.V(LogicMessageLogLevel).Info("skip loading unchanged data", "id", id)
+		return nil
+	}
+	newData, err := readEstimateDataAsCSV(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	st.target.V(LogicMessageLogLevel).Info("receive data", "id", id)
+	// the hash is restored from the state when the controller restarts
+	prevHash := st.dataHash
+	st.dataHash, st.loaded = hash, true
+	// shift by gap
+	for i := range newData {
+		newData[i].EstimateUnixTime = newData[i].UnixTime - int64(st.target.GapMinutes)*60
+	}
+	tmpData := joinEstimateData(newData, st.data)
+
+	// cut down old data
+	now := s.now().Unix()
+	st.data, st.position = nil, 0
+	for i, ed := range tmpData {
+		if ed.EstimateUnixTime > now {
+			st.data = tmpData[i:]
+			break
+		}
+	}
+	st.dataVersion++
+	st.updateDataSnapshot()
+	if len(st.data) > 0 && hash != prevHash {
+		st.target.event(corev1.EventTypeNormal, EventReasonForecastDataLoaded, "Loaded forecasted data of estimator %s until %s",
+			st.target.Name, time.Unix(st.data[len(st.data)-1].UnixTime, 0).UTC().Format(time.RFC3339))
+	}
+	st.mu.Unlock()
+	s.markStateDirty(id)
+
+	s.mu.Lock()
+	s.scheduleLocked(st)
+	s.mu.Unlock()
+	s.wake()
+	return nil
+}
+
+// Start runs the scheduler until stop is closed. This implements manager.Runnable.
+func (s *EstimateScheduler) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	s.Run(ctx)
+	return nil
+}
+
+// Run dispatches due targets to workers until ctx is canceled.
+func (s *EstimateScheduler) Run(ctx context.Context) {
+	s.Log.V(LogicMessageLogLevel).Info("start estimate scheduler", "workers", s.Workers)
+
+	workCh := make(chan *scheduledTarget)
+	var wg sync.WaitGroup
+	for i := 0; i < s.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for st := range workCh {
+				s.process(st)
+			}
+		}()
+	}
+	saverDone := make(chan struct{})
+	go func() {
+		defer close(saverDone)
+		s.runStateSaver(ctx)
+	}()
+	defer func() {
+		close(workCh)
+		wg.Wait()
+		<-saverDone
+		// save the state changed after the last save before stopping
+		s.saveStates()
+		s.Log.V(LogicMessageLogLevel).Info("stop estimate scheduler")
+	}()
+
+	timer := time.NewTimer(idleWaitTime)
+	defer timer.Stop()
+	for {
+		due, wait := s.popDue(s.now())
+		for _, st := range due {
+			select {
+			case workCh <- st:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wakeCh:
+		}
+	}
+}
+
+// popDue pops targets whose next send time is not after now, and marks them as running.
+// This also returns the wait time until the next target.
+func (s *EstimateScheduler) popDue(now time.Time) ([]*scheduledTarget, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*scheduledTarget
+	for len(s.queue) > 0 && !s.queue[0].nextTime.After(now) {
+		st := heap.Pop(&s.queue).(*scheduledTarget)
+		st.running = true
+		due = append(due, st)
+	}
+	if len(s.queue) == 0 {
+		return due, idleWaitTime
+	}
+	return due, s.queue[0].nextTime.Sub(now)
+}
+
+// runStateSaver saves the state of targets at StateSaveInterval until ctx is canceled.
+func (s *EstimateScheduler) runStateSaver(ctx context.Context) {
+	interval := s.StateSaveInterval
+	if interval <= 0 {
+		interval = DefaultEstimatorStateSaveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.saveStates()
+		}
+	}
+}
+
+// markStateDirty marks the state of the target of id as changed. This is safe for concurrent use.
+func (s *EstimateScheduler) markStateDirty(id string) {
+	s.dirtyMu.Lock()
+	defer s.dirtyMu.Unlock()
+	if s.dirty == nil {
+		s.dirty = make(map[string]struct{})
+	}
+	s.dirty[id] = struct{}{}
+}
+
+// saveStates saves the state of all targets marked by markStateDirty.
+// The state is copied under the lock of the target, and saved after releasing it.
+func (s *EstimateScheduler) saveStates() {
+	s.dirtyMu.Lock()
+	ids := s.dirty
+	s.dirty = nil
+	s.dirtyMu.Unlock()
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	for id := range ids {
+		st, ok := s.get(id)
+		if !ok {
+			continue
+		}
+		st.mu.Lock()
+		if st.removed {
+			st.mu.Unlock()
+			continue
+		}
+		et := st.target
+		dataHash := st.dataHash
+		pastDatumQueue := append(PastEstimateDatumQueue(nil), st.pastDatumQueue...)
+		st.mu.Unlock()
+
+		if err := et.saveState(dataHash, pastDatumQueue); err != nil {
+			s.Log.V(LogicMessageLogLevel).Info("failed to save estimator state", "id", id, "error_msg", err)
+			// retry at next save
+			s.markStateDirty(id)
+		}
+	}
+}
+
+// process sends a datum of the target and reschedules it.
+func (s *EstimateScheduler) process(st *scheduledTarget) {
+	if st.send(s.now) {
+		s.markStateDirty(st.target.ID)
+	}
+
+	s.mu.Lock()
+	st.running = false
+	s.scheduleLocked(st)
+	s.mu.Unlock()
+	s.wake()
+}
+
+// scheduleLocked pushes or moves the target in the queue by its next send time.
+// The target is not scheduled while it is running, because the worker reschedules it after the send.
+// s.mu must be held.
+func (s *EstimateScheduler) scheduleLocked(st *scheduledTarget) {
+	if st.running || s.targets[st.target.ID] != st {
+		return
+	}
+
+	st.mu.Lock()
+	next, ok := st.nextSendTime()
+	st.mu.Unlock()
+
+	switch {
+	case !ok && st.heapIndex >= 0:
+		heap.Remove(&s.queue, st.heapIndex)
+	case !ok:
+	case st.heapIndex >= 0:
+		st.nextTime = next
+		heap.Fix(&s.queue, st.heapIndex)
+	default:
+		st.nextTime = next
+		heap.Push(&s.queue, st)
+	}
+}
+
+func (s *EstimateScheduler) get(id string) (*scheduledTarget, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.targets[id]
+	return st, ok
+}
+
+// wake makes the scheduler loop recalculate the wait time.
+func (s *EstimateScheduler) wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// nextSendTime returns the estimate time of the next datum. st.mu must be held.
+func (st *scheduledTarget) nextSendTime() (time.Time, bool) {
+	if st.position >= len(st.data) {
+		return time.Time{}, false
+	}
+	return time.Unix(st.data[st.position].EstimateUnixTime, 0), true
+}
+
+// updateDataSnapshot publishes the range of data and the next send time. st.mu must be held.
+func (st *scheduledTarget) updateDataSnapshot() {
+	var horizonStart, horizonEnd time.Time
+	if len(st.data) > 0 {
+		horizonStart = time.Unix(st.data[0].EstimateUnixTime, 0)
+		horizonEnd = time.Unix(st.data[len(st.data)-1].EstimateUnixTime, 0)
+	}
+	nextSendTime, _ := st.nextSendTime()
+	st.target.updateSnapshot(func(s *ForecastSnapshot) {
+		if !horizonEnd.IsZero() {
+			s.HorizonStart = horizonStart
+			s.HorizonEnd = horizonEnd
+		}
+		s.NextSendTime = nextSendTime
+	})
+}
+
+// send sends the datum at the position to metric provider.
+// In adjust mode, the datum is adjusted based on the actual value of the previous datum.
+// The lock is released while accessing metric provider, so data can be replaced during the send.
+// This returns true if the state to be saved is changed.
+func (st *scheduledTarget) send(now func() time.Time) bool {
+	st.mu.Lock()
+	if st.removed || st.position >= len(st.data) {
+		st.mu.Unlock()
+		return false
+	}
+	et := st.target
+	ctx := st.ctx
+	version := st.dataVersion
+	currData := st.data[st.position]
+
+	// the datum is skipped while paused so that sending is restarted from the current time when resumed.
+	// it is still kept as past datum for adjusting the data after resuming.
+	if et.Paused {
+		et.V(LogicMessageLogLevel).Info("skip sending metrics while paused", "metricName", et.MetricName,
+			"timestamp", time.Unix(currData.EstimateUnixTime, 0).String())
+		st.pastDatumQueue.enqueue(&currData)
+		st.position++
+		st.updateDataSnapshot()
+		st.mu.Unlock()
+		return true
+	}
+
+	// ignore predictions until a datum is sent because we cannot see before data.
+	// past data are kept when new data is loaded, so adjusting continues across uploads.
+	adjust := len(st.pastDatumQueue) != 0 && EstimateMode(et.EstimateMode).adjusts()
+	var prevData *EstimateDatum
+	if adjust {
+		// look up previous datum which has actual value
+		et.V(LogicMessageLogLevel).Info("search data", "time", now())
+		if prevData = st.pastDatumQueue.seekByUnixTime(now().Unix()); prevData == nil {
+			et.V(LogicMessageLogLevel).Info("valid previous datum is not found", "past_queue", st.pastDatumQueue.String())
+		}
+	}
+	st.mu.Unlock()
+
+	adjustedYHat := currData.YHat
+	var providerErr error
+	var actualY float64
+	fetched := false
+	if adjust {
+		prev := currData
+		var prevY float64
+		if prevData != nil {
+			prev = *prevData
+			var err error
+			start := time.Now()
+			prevY, err = et.MetricProvider.Fetch(
+				et.MetricProvider.AddSumAggregator(et.BaseMetricName),
+				prev.UnixTime,
+				et.BaseMetricTags,
+				nil,
+			)
+			et.observeProviderRequest(providerOperationFetch, start, err)
+			if err != nil {
+				et.V(LogicMessageLogLevel).Info("failed to fetch previous data", "error_msg", err)
+				prevY = prev.YHat
+				providerErr = err
+			} else {
+				actualY = prevY
+				fetched = true
+			}
+			et.V(2).Info("match data", "prevY", prevY, "d", prev.String())
+		}
+		// adopt only upper adjust
+		if yhat := currData.adjustYHat(&prev, prevY); yhat > adjustedYHat {
+			adjustedYHat = yhat
+		}
+	}
+
+	// known events which cannot be forecasted
+	active := activeScheduledOverrides(et.ScheduledOverrides, time.Unix(currData.UnixTime, 0))
+	if multiplier := overrideForecastMultiplier(active); multiplier != 1 {
+		et.V(LogicMessageLogLevel).Info("multiply forecasted value by scheduled override",
+			"multiplier", multiplier, "yhat", adjustedYHat)
+		adjustedYHat *= multiplier
+	}
+
+	// the target is removed while fetching
+	if ctx.Err() != nil {
+		return false
+	}
+
+	et.V(LogicMessageLogLevel).Info(
+		"send metrics",
+		"metricName", et.MetricName,
+		"timestamp", time.Unix(currData.EstimateUnixTime, 0).String(),
+		"yhat", currData.YHat,
+		"adjusted_yhat", adjustedYHat,
+		"upper_yhat", currData.UpperYHat,
+		"lower_yhat", currData.LowerYHat,
+		"tags", et.MetricTags,
+	)
+
+	sendMap := map[string]float64{
+		et.MetricName:            adjustedYHat,
+		et.MetricName + ".raw":   currData.YHat,
+		et.MetricName + ".upper": currData.UpperYHat,
+		et.MetricName + ".lower": currData.LowerYHat,
+	}
+	var sendFailures int32
+	for metricName, datapoint := range sendMap {
+		start := time.Now()
+		err := et.MetricProvider.Send(
+			metricName,
+			currData.EstimateUnixTime,
+			datapoint,
+			et.MetricTags,
+			map[string]interface{}{"metricUnitReference": et.BaseMetricName},
+		)
+		et.observeProviderRequest(providerOperationSend, start, err)
+		if err != nil {
+			et.V(LogicMessageLogLevel).Info("failed to send metric data", "metric_name", metricName, "error_msg", err)
+			providerErr = err
+			sendFailures++
+		}
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.removed {
+		return false
+	}
+	if fetched {
+		forecastY := prevData.YHat
+		st.target.updateSnapshot(func(s *ForecastSnapshot) {
+			s.Accuracy.add(forecastY, actualY)
+		})
+	}
+	st.target.updateSnapshot(func(s *ForecastSnapshot) {
+		s.RawValue = currData.YHat
+		s.AdjustedValue = adjustedYHat
+		s.ProviderAccessed = true
+		s.ProviderError = ""
+		if providerErr != nil {
+			s.ProviderError = providerErr.Error()
+		}
+		s.SendFailures += sendFailures
+		if sendFailures == 0 {
+			s.LastForecastTime = now()
+		}
+	})
+	st.target.recordForecastMetrics(&currData, adjustedYHat, adjust)
+	// events are recorded only when sending starts failing or recovers
+	if sendFailures != 0 && !st.sendFailing {
+		st.target.event(corev1.EventTypeWarning, EventReasonSendFailed, "Failed to send forecasted metrics of estimator %s to %s: %v",
+			st.target.Name, st.target.ProviderName, providerErr)
+	} else if sendFailures == 0 && st.sendFailing {
+		st.target.event(corev1.EventTypeNormal, EventReasonSendRecovered, "Sent forecasted metrics of estimator %s to %s again",
+			st.target.Name, st.target.ProviderName)
+	}
+	st.sendFailing = sendFailures != 0
+	if st.target.ExternalMetricStore != nil {
+		st.target.ExternalMetricStore.Set(
+			st.target.ID,
+			st.target.Namespace,
+			st.target.MetricName,
+			externalmetrics.ParseTags(st.target.MetricTags),
+			adjustedYHat,
+			now(),
+		)
+	}
+	st.pastDatumQueue.enqueue(&currData)
+
+	// the position is reset if data is replaced during the send
+	if st.dataVersion == version {
+		st.position++
+	}
+	st.updateDataSnapshot()
+
+	if next, ok := st.nextSendTime(); ok {
+		st.target.V(LogicMessageLogLevel).Info(
+			"next time to send metric",
+			"metric_name", st.target.MetricName,
+			"remain_time", next.Sub(now()),
+			"next_time", next.String(),
+		)
+	}
+	return true
+}
+
+// estimateDataHash returns a hash of the payload of forecasted data.
+func estimateDataHash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// estimateQueue is a min-heap of scheduledTarget ordered by the next send time.
+type estimateQueue []*scheduledTarget
+
+func (q estimateQueue) Len() int           { return len(q) }
+func (q estimateQueue) Less(i, j int) bool { return q[i].nextTime.Before(q[j].nextTime) }
+func (q estimateQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].heapIndex = i
+	q[j].heapIndex = j
+}
+func (q *estimateQueue) Push(x interface{}) {
+	st := x.(*scheduledTarget)
+	st.heapIndex = len(*q)
+	*q = append(*q, st)
+}
+func (q *estimateQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	st := old[n-1]
+	old[n-1] = nil
+	st.heapIndex = -1
+	*q = old[:n-1]
+	return st
+}
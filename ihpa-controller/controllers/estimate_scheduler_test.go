@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// recordingProvider is a MetricProvider which records sent metrics.
+type recordingProvider struct {
+	mu    sync.Mutex
+	sent  map[string]float64
+	fetch float64
+}
+
+func (p *recordingProvider) Send(metricName string, timestamp int64, point float64, tags []string, opts map[string]interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sent == nil {
+		p.sent = make(map[string]float64)
+	}
+	p.sent[metricName] = point
+	return nil
+}
+func (p *recordingProvider) Fetch(metricName string, timestamp int64, tags []string, opts map[string]interface{}) (float64, error) {
+	return p.fetch, nil
+}
+func (p *recordingProvider) ConvertResourceMetricName(metricName string, reverse bool) metricprovider.MetricIdentifier {
+	return nil
+}
+func (p *recordingProvider) ConvertObjectMetricName(metricName string, reverse bool) metricprovider.MetricIdentifier {
+	return nil
+}
+func (p *recordingProvider) ConvertPodsMetricName(metricName string, reverse bool) metricprovider.MetricIdentifier {
+	return nil
+}
+func (p *recordingProvider) AddSumAggregator(metricName string) string { return metricName }
+func (p *recordingProvider) sentCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sent)
+}
+
+func testEstimateCSV(timestamps ...int64) []byte {
+	s := "timestamp,yhat,yhat_upper,yhat_lower\n"
+	for _, ts := range timestamps {
+		s += fmt.Sprintf("%d,10.0,20.0,5.0\n", ts)
+	}
+	return []byte(s)
+}
+
+func TestEstimateSchedulerQueue(t *testing.T) {
+	base := time.Unix(1583020800, 0)
+	s := NewEstimateScheduler(1, logf.Log.WithName("test"))
+	s.now = func() time.Time { return base }
+
+	for _, id := range []string{"default/a", "default/b", "default/c", "default/idle"} {
+		if err := s.Add(EstimateTarget{ID: id, EstimateMode: string(RawMode), MetricProvider: &recordingProvider{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Add(EstimateTarget{ID: "default/a"}); err != ErrEstimateTargetExists {
+		t.Fatalf("error is not match (got=%v, exp=%v)", err, ErrEstimateTargetExists)
+	}
+	if err := s.Load("default/none", testEstimateCSV(base.Unix()+60)); err != ErrEstimateTargetNotFound {
+		t.Fatalf("error is not match (got=%v, exp=%v)", err, ErrEstimateTargetNotFound)
+	}
+
+	// old data is dropped
+	loads := map[string][]int64{
+		"default/a": {base.Unix() - 60, base.Unix() + 300, base.Unix() + 600},
+		"default/b": {base.Unix() + 120},
+		"default/c": {base.Unix() + 180},
+	}
+	for id, ts := range loads {
+		if err := s.Load(id, testEstimateCSV(ts...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// new data for c is earlier than the scheduled one
+	if err := s.Load("default/c", testEstimateCSV(base.Unix()+60, base.Unix()+180)); err != nil {
+		t.Fatal(err)
+	}
+	s.Remove("default/b")
+
+	tests := []struct {
+		now      time.Time
+		expected []string
+		wait     time.Duration
+	}{
+		{now: base, expected: nil, wait: 60 * time.Second},
+		{now: base.Add(60 * time.Second), expected: []string{"default/c"}, wait: 240 * time.Second},
+		{now: base.Add(600 * time.Second), expected: []string{"default/a"}, wait: idleWaitTime},
+	}
+	for _, tt := range tests {
+		due, wait := s.popDue(tt.now)
+		var got []string
+		for _, st := range due {
+			got = append(got, st.target.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+			t.Fatalf("due targets are not match (got=%v, exp=%v)", got, tt.expected)
+		}
+		if wait != tt.wait {
+			t.Fatalf("wait time is not match (got=%v, exp=%v)", wait, tt.wait)
+		}
+	}
+}
+
+func TestEstimateSchedulerRun(t *testing.T) {
+	snapshots := NewForecastSnapshotStore()
+	provider := &recordingProvider{}
+	s := NewEstimateScheduler(2, logf.Log.WithName("test"))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := s.Add(EstimateTarget{
+		ID:                "default/nginx",
+		EstimateMode:      string(RawMode),
+		MetricName:        "ake.ihpa.forecasted_nginx",
+		MetricProvider:    provider,
+		ForecastSnapshots: snapshots,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	if err := s.Load("default/nginx", testEstimateCSV(now+1, now+3600)); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for provider.sentCount() < 4 {
+		select {
+		case <-timeout:
+			t.Fatalf("forecasted metrics are not sent (sent=%v)", provider.sent)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if provider.sent["ake.ihpa.forecasted_nginx"] != 10 || provider.sent["ake.ihpa.forecasted_nginx.upper"] != 20 {
+		t.Fatalf("sent metrics are not match (got=%v)", provider.sent)
+	}
+
+	// wait until the worker reschedules the target
+	for {
+		snapshot, _ := snapshots.Get("default/nginx")
+		if snapshot.NextSendTime.Unix() == now+3600 {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("next send time is not match (got=%v, exp=%v)", snapshot.NextSendTime, time.Unix(now+3600, 0))
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	s.mu.Lock()
+	queued := len(s.queue)
+	s.mu.Unlock()
+	if queued != 1 {
+		t.Fatalf("queued targets is not match (got=%d, exp=%d)", queued, 1)
+	}
+
+	s.Remove("default/nginx")
+	if _, ok := snapshots.Get("default/nginx"); ok {
+		t.Fatalf("snapshot should be deleted")
+	}
+	if s.Has("default/nginx") || len(s.queue) != 0 {
+		t.Fatalf("target should be removed")
+	}
+}
+
+func TestScheduledTargetSendWithOverride(t *testing.T) {
+	now := time.Date(2020, 1, 1, 11, 50, 0, 0, time.UTC)
+	start := metav1.NewTime(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC))
+	overrides, err := newScheduledOverrides([]ihpav1beta2.ScheduledOverride{
+		{
+			Name:               "campaign",
+			Start:              &start,
+			End:                &end,
+			ForecastMultiplier: func(q resource.Quantity) *resource.Quantity { return &q }(resource.MustParse("1.5")),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		forecastTime time.Time
+		expected     float64
+	}{
+		// forecasted time is in the window, though the send time is not
+		{forecastTime: start.Time, expected: 15},
+		{forecastTime: end.Time, expected: 10},
+	}
+
+	for _, tt := range tests {
+		provider := &recordingProvider{}
+		st := &scheduledTarget{
+			target: EstimateTarget{
+				ID:                 "default/nginx",
+				EstimateMode:       string(RawMode),
+				MetricName:         "ake.ihpa.forecasted_nginx",
+				MetricProvider:     provider,
+				ScheduledOverrides: overrides,
+				Logger:             logf.Log.WithName("test"),
+			},
+			data: []EstimateDatum{
+				{UnixTime: tt.forecastTime.Unix(), EstimateUnixTime: now.Unix(), YHat: 10, UpperYHat: 20, LowerYHat: 5},
+			},
+			ctx: context.Background(),
+		}
+		st.send(func() time.Time { return now })
+
+		if provider.sent["ake.ihpa.forecasted_nginx"] != tt.expected || provider.sent["ake.ihpa.forecasted_nginx.raw"] != 10 {
+			t.Fatalf("sent metrics are not match (got=%v, exp=%v)", provider.sent, tt.expected)
+		}
+	}
+}
+
+func TestScheduledTargetSendWhilePaused(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	provider := &recordingProvider{}
+	st := &scheduledTarget{
+		target: EstimateTarget{
+			ID:             "default/nginx",
+			EstimateMode:   string(RawMode),
+			MetricName:     "ake.ihpa.forecasted_nginx",
+			MetricProvider: provider,
+			Paused:         true,
+			Logger:         logf.Log.WithName("test"),
+		},
+		data: []EstimateDatum{
+			{UnixTime: now.Add(10 * time.Minute).Unix(), EstimateUnixTime: now.Unix(), YHat: 10, UpperYHat: 20, LowerYHat: 5},
+			{UnixTime: now.Add(11 * time.Minute).Unix(), EstimateUnixTime: now.Add(time.Minute).Unix(), YHat: 10, UpperYHat: 20, LowerYHat: 5},
+		},
+		ctx: context.Background(),
+	}
+
+	// data is skipped without sending while paused
+	st.send(func() time.Time { return now })
+	if provider.sentCount() != 0 || st.position != 1 || len(st.pastDatumQueue) != 1 {
+		t.Fatalf("datum is not skipped (sent=%v, position=%d, past=%d)", provider.sent, st.position, len(st.pastDatumQueue))
+	}
+
+	// sending is restarted from the current datum when resumed
+	if err := st.target.updateEstimateTarget(&EstimateTarget{ID: "default/nginx"}); err != nil {
+		t.Fatal(err)
+	}
+	st.send(func() time.Time { return now.Add(time.Minute) })
+	if provider.sentCount() == 0 || st.position != 2 {
+		t.Fatalf("datum is not sent after resuming (sent=%v, position=%d)", provider.sent, st.position)
+	}
+}
+
+func TestEstimateSchedulerLoadKeepsAdjusting(t *testing.T) {
+	base := time.Unix(1583020800, 0)
+	now := base
+	provider := &recordingProvider{fetch: 20}
+	s := NewEstimateScheduler(1, logf.Log.WithName("test"))
+	s.now = func() time.Time { return now }
+	if err := s.Add(EstimateTarget{
+		ID:             "default/nginx",
+		EstimateMode:   string(AdjustMode),
+		MetricName:     "ake.ihpa.forecasted_nginx",
+		MetricProvider: provider,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := s.get("default/nginx")
+	send := func(at time.Time) float64 {
+		now = at
+		st.send(s.now)
+		return provider.sent["ake.ihpa.forecasted_nginx"]
+	}
+
+	data := testEstimateCSV(base.Unix()+60, base.Unix()+120, base.Unix()+180)
+	if err := s.Load("default/nginx", data); err != nil {
+		t.Fatal(err)
+	}
+	// the first datum is not adjusted because no datum is sent before
+	if got := send(base.Add(60 * time.Second)); got != 10 {
+		t.Fatalf("sent value is not match (got=%v, exp=%v)", got, 10)
+	}
+
+	// the same data loaded on reconcile does not reset the position
+	if err := s.Load("default/nginx", data); err != nil {
+		t.Fatal(err)
+	}
+	if st.position != 1 {
+		t.Fatalf("position is not match (got=%d, exp=%d)", st.position, 1)
+	}
+	if got := send(base.Add(120 * time.Second)); got != 20 {
+		t.Fatalf("sent value is not match (got=%v, exp=%v)", got, 20)
+	}
+
+	// new data is adjusted from the first datum with the past data sent before
+	now = base.Add(150 * time.Second)
+	if err := s.Load("default/nginx", testEstimateCSV(base.Unix()+180, base.Unix()+240)); err != nil {
+		t.Fatal(err)
+	}
+	if st.position != 0 {
+		t.Fatalf("position is not match (got=%d, exp=%d)", st.position, 0)
+	}
+	provider.sent = nil
+	if got := send(base.Add(180 * time.Second)); got != 20 {
+		t.Fatalf("sent value is not match (got=%v, exp=%v)", got, 20)
+	}
+}
@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"bytes"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -11,20 +10,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/estimatorstate"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/externalmetrics"
 	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider"
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
-	EstimateUnknown = EstimateOperator(iota)
-	EstimateAdd
-	EstimateRemove
-	EstimateUpdate
-
 	AdjustMode = EstimateMode("adjust")
 	RawMode    = EstimateMode("raw")
-
-	EstimateTargetsBuffer = 20
+	// FloorMode adjusts forecasted metrics same as AdjustMode.
+	// The adjusted value is used for minReplicas of HPA by IntelligentHorizontalPodAutoscalerReconciler.
+	FloorMode = EstimateMode("floor")
 
 	TimeStampLabel = "timestamp"
 	YHatLabel      = "yhat"
@@ -32,28 +32,60 @@ const (
 	YHatLowerLabel = "yhat_lower"
 )
 
-type EstimateOperator int
-
 type EstimateMode string
 
+// adjusts returns true if forecasted metrics are adjusted by actual metrics in the mode.
+func (m EstimateMode) adjusts() bool {
+	return m == AdjustMode || m == FloorMode
+}
+
 type EstimateTarget struct {
 	ID             string
+	Namespace      string
+	Name           string
 	EstimateMode   string
 	GapMinutes     int
-	DataCh         <-chan []byte
 	MetricProvider metricprovider.MetricProvider
 	MetricName     string
 	MetricTags     []string
 	BaseMetricName string
 	BaseMetricTags []string
 
-	estimatorStopCh chan struct{}
-	logr.Logger
-}
+	// IHPAName and ProviderName are used for labels of exported metrics.
+	IHPAName     string
+	ProviderName string
+
+	// ScheduledOverrides multiply forecasted values whose forecasted time is in their windows.
+	ScheduledOverrides []*scheduledOverride
 
-type EstimateOperation struct {
-	Operator EstimateOperator
-	Target   EstimateTarget
+	// Paused skips sending forecasted values while keeping the data.
+	Paused bool
+
+	// ExternalMetricStore holds forecasted value for built-in external metrics server.
+	// If this is nil, the value is served only through MetricProvider.
+	ExternalMetricStore *externalmetrics.Store
+
+	// ForecastSnapshots receives the latest state of this target for status.
+	// If this is nil, the state is not published.
+	ForecastSnapshots *ForecastSnapshotStore
+
+	// StatusReporter is notified when ForecastSnapshot of this target is updated.
+	// If this is nil, the state is not written to Estimator status.
+	StatusReporter *EstimatorStatusReporter
+
+	// StateStore checkpoints the hash of loaded data and past data of this target,
+	// and the state is restored when the estimator starts.
+	// If this is nil, the state is kept only in memory.
+	StateStore estimatorstate.Store
+	// UID is the UID of the estimator, which owns the saved state.
+	UID types.UID
+
+	// Recorder records events of this target on Owner, which is the IHPA generating the estimator.
+	// If either of them is nil, events are not recorded.
+	Recorder record.EventRecorder
+	Owner    runtime.Object
+
+	logr.Logger
 }
 
 type EstimateDatum struct {
@@ -140,201 +172,15 @@ func (currEd *EstimateDatum) adjustYHat(prevEd *EstimateDatum, actualValue float
 	return adjusted
 }
 
-// estimatorHandler handle estimate request
-func estimatorHandler(opeCh <-chan *EstimateOperation, log logr.Logger) {
-	log.V(LogicMessageLogLevel).Info("start estimator handler")
-	estimateTargets := make([]EstimateTarget, 0, EstimateTargetsBuffer)
-	for {
-		select {
-		case ope := <-opeCh:
-			switch ope.Operator {
-			case EstimateAdd:
-				et := ope.Target
-				log.V(LogicMessageLogLevel).Info("create estimator", "id", et.ID)
-				et.estimatorStopCh = make(chan struct{})
-				et.Logger = log
-				go et.estimator()
-				estimateTargets = append(estimateTargets, et)
-
-			case EstimateUpdate:
-				patch := ope.Target
-				log.V(LogicMessageLogLevel).Info("update estimator", "id", patch.ID)
-				for i, et := range estimateTargets {
-					if et.ID == patch.ID {
-						if err := et.updateEstimateTarget(&patch); err != nil {
-							log.V(LogicMessageLogLevel).Info("update estimator error", "error_msg", err)
-						}
-
-						close(et.estimatorStopCh)
-						et.estimatorStopCh = make(chan struct{})
-						go et.estimator()
-						estimateTargets[i] = et
-
-						// break search loop, not handler loop
-						break
-					}
-				}
-
-			case EstimateRemove:
-				for i, et := range estimateTargets {
-					if et.ID == ope.Target.ID {
-						log.V(LogicMessageLogLevel).Info("stop estimating", "id", et.ID)
-						close(et.estimatorStopCh)
-						estimateTargets = append(estimateTargets[:i], estimateTargets[i+1:]...)
-						// break search loop, not handler loop
-						break
-					}
-				}
-			}
-		}
+// updateSnapshot applies f to ForecastSnapshot of this target if the store is given.
+func (et *EstimateTarget) updateSnapshot(f func(*ForecastSnapshot)) {
+	if et.ForecastSnapshots == nil {
+		return
 	}
-}
-
-// flow
-//    receive data (time series metrics)
-// -> shift data time stamp by gap
-// -> cut down data until now
-// -> see first elements of current data
-// -> wait time to send data to provider
-// -> adjust yhat based on previous actual metric
-// -> send data to provider
-func (et *EstimateTarget) estimator() {
-	et.V(LogicMessageLogLevel).Info("start estimator", "id", et.ID)
-
-	waitTime := time.Duration(5)
-	position := 0
-	// this should be sorted
-	data := make([]EstimateDatum, 0)
-	pastDatumQueue := PastEstimateDatumQueue(make([]EstimateDatum, 0, 288)) // 5 minutes interval 1 day capacity
-
-estimatorLoop:
-	for {
-		select {
-		case <-et.estimatorStopCh:
-			et.V(LogicMessageLogLevel).Info("receive stop request", "id", et.ID)
-			break estimatorLoop
-		case <-time.After(waitTime * time.Second):
-			// have no data or reach end of data
-			if len(data) == 0 || position > len(data)-1 {
-				// fall through to check watcherDataCh
-				break
-			}
-
-			adjustedYHat := data[position].YHat
-			// ignore first prediction because we cannot see before data.
-			if position != 0 && et.EstimateMode == string(AdjustMode) {
-				currData := data[position]
-				// look up previous datum which has actual value
-				var prevData EstimateDatum
-				var prevY float64
-				et.V(LogicMessageLogLevel).Info("search data", "time", time.Now())
-				if d := pastDatumQueue.seekByUnixTime(time.Now().Unix()); d != nil {
-					prevData = *d
-					var err error
-					prevY, err = et.MetricProvider.Fetch(
-						et.MetricProvider.AddSumAggregator(et.BaseMetricName),
-						prevData.UnixTime,
-						et.BaseMetricTags,
-						nil,
-					)
-					if err != nil {
-						et.V(LogicMessageLogLevel).Info("failed to fetch previous data", "error_msg", err)
-						prevY = prevData.YHat
-					}
-					et.V(2).Info("match data", "prevY", prevY, "d", d.String())
-				} else {
-					et.V(LogicMessageLogLevel).Info("valid previous datum is not found", "past_queue", pastDatumQueue.String())
-					prevData = currData
-				}
-				// adopt only upper adjust
-				if yhat := currData.adjustYHat(&prevData, prevY); yhat > adjustedYHat {
-					adjustedYHat = yhat
-				}
-			}
-
-			et.V(LogicMessageLogLevel).Info(
-				"send metrics",
-				"metricName", et.MetricName,
-				"timestamp", time.Unix(data[position].EstimateUnixTime, 0).String(),
-				"yhat", data[position].YHat,
-				"adjusted_yhat", adjustedYHat,
-				"upper_yhat", data[position].UpperYHat,
-				"lower_yhat", data[position].LowerYHat,
-				"tags", et.MetricTags,
-			)
-
-			sendMap := map[string]float64{
-				et.MetricName:            adjustedYHat,
-				et.MetricName + ".raw":   data[position].YHat,
-				et.MetricName + ".upper": data[position].UpperYHat,
-				et.MetricName + ".lower": data[position].LowerYHat,
-			}
-			for metricName, datapoint := range sendMap {
-				if err := et.MetricProvider.Send(
-					metricName,
-					data[position].EstimateUnixTime,
-					datapoint,
-					et.MetricTags,
-					map[string]interface{}{"metricUnitReference": et.BaseMetricName},
-				); err != nil {
-					et.V(LogicMessageLogLevel).Info("failed to send metric data", "metric_name", metricName, "error_msg", err)
-				}
-			}
-			pastDatumQueue.enqueue(&data[position])
-
-			position++
-			if len(data) > position {
-				now := time.Now().Unix()
-				waitTime = time.Duration(data[position].EstimateUnixTime - now)
-			} else {
-				// completed to reading all data
-				waitTime = time.Duration(5)
-			}
-		}
-
-		// data input check is separated from sending metrics
-		// because if proceed to watcherDataCh case while waiting time.After(),
-		// the wait time until now becomes meaningless and new wait time is set.
-		select {
-		case d := <-et.DataCh:
-			et.V(LogicMessageLogLevel).Info("receive data", "id", et.ID)
-			newData, err := readEstimateDataAsCSV(bytes.NewReader(d))
-			if err != nil {
-				et.V(LogicMessageLogLevel).Info("failed to read data", "error_msg", err)
-				continue
-			}
-
-			// shift by gap
-			for i := range newData {
-				newData[i].EstimateUnixTime = newData[i].UnixTime - int64(et.GapMinutes)*60
-			}
-
-			tmpData := joinEstimateData(newData, data)
-			now := time.Now().Unix()
-
-			// cut down old data
-			for i, ed := range tmpData {
-				if ed.EstimateUnixTime > now {
-					data = tmpData[i:]
-					position = 0
-					break
-				}
-			}
-			waitTime = time.Duration(data[position].EstimateUnixTime - now)
-		default:
-		}
-
-		if len(data) > position {
-			et.V(LogicMessageLogLevel).Info(
-				"next time to send metric",
-				"metric_name", et.MetricName,
-				"remain_time", waitTime*time.Second,
-				"next_time", time.Unix(data[position].EstimateUnixTime, 0).String(),
-			)
-		}
+	et.ForecastSnapshots.Update(et.ID, f)
+	if et.StatusReporter != nil {
+		et.StatusReporter.Notify(et.ID)
 	}
-
-	et.V(LogicMessageLogLevel).Info("stop estimator", "id", et.ID)
 }
 
 func (base *EstimateTarget) updateEstimateTarget(patch *EstimateTarget) error {
@@ -364,6 +210,15 @@ func (base *EstimateTarget) updateEstimateTarget(patch *EstimateTarget) error {
 	if patch.BaseMetricTags != nil {
 		base.BaseMetricTags = patch.BaseMetricTags
 	}
+	if patch.IHPAName != "" {
+		base.IHPAName = patch.IHPAName
+	}
+	if patch.ProviderName != "" {
+		base.ProviderName = patch.ProviderName
+	}
+	// overrides and pausing are always overwritten because their zero values are also valid
+	base.ScheduledOverrides = patch.ScheduledOverrides
+	base.Paused = patch.Paused
 
 	return nil
 }
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/estimatorstate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// saveState checkpoints the state of estimator if the store is given.
+func (et *EstimateTarget) saveState(dataHash string, pastDatumQueue PastEstimateDatumQueue) error {
+	if et.StateStore == nil {
+		return nil
+	}
+	state := &estimatorstate.State{
+		DataHash:  dataHash,
+		PastData:  toStateData(pastDatumQueue),
+		UpdatedAt: time.Now(),
+	}
+	return et.StateStore.Save(et.ID, et.stateOwner(), state)
+}
+
+// loadState restores the state of estimator saved by saveState.
+// ok is false if the store is not given or no state is saved.
+func (et *EstimateTarget) loadState() (dataHash string, pastDatumQueue PastEstimateDatumQueue, ok bool) {
+	if et.StateStore == nil {
+		return "", nil, false
+	}
+	state, err := et.StateStore.Load(et.ID)
+	if err != nil {
+		et.V(LogicMessageLogLevel).Info("failed to load estimator state", "id", et.ID, "error_msg", err)
+		return "", nil, false
+	}
+	if state == nil {
+		return "", nil, false
+	}
+	return state.DataHash, PastEstimateDatumQueue(fromStateData(state.PastData)), true
+}
+
+// stateOwner returns the owner reference of the saved state, which is the estimator.
+// It is not a controller reference, so saving the state does not trigger reconcile of the estimator.
+func (et *EstimateTarget) stateOwner() *metav1.OwnerReference {
+	if et.UID == "" {
+		return nil
+	}
+	return &metav1.OwnerReference{
+		APIVersion: ihpav1beta2.GroupVersion.String(),
+		Kind:       "Estimator",
+		Name:       et.Name,
+		UID:        et.UID,
+	}
+}
+
+func toStateData(eds []EstimateDatum) []estimatorstate.Datum {
+	data := make([]estimatorstate.Datum, 0, len(eds))
+	for _, ed := range eds {
+		data = append(data, estimatorstate.Datum(ed))
+	}
+	return data
+}
+
+func fromStateData(data []estimatorstate.Datum) []EstimateDatum {
+	eds := make([]EstimateDatum, 0, len(data))
+	for _, d := range data {
+		eds = append(eds, EstimateDatum(d))
+	}
+	return eds
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/estimatorstate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestEstimateSchedulerRestoreState(t *testing.T) {
+	base := time.Unix(1583020800, 0)
+	now := base
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme)
+	store := estimatorstate.NewConfigMapStore(c)
+	data := testEstimateCSV(base.Unix()+60, base.Unix()+120, base.Unix()+180)
+
+	start := func(provider *recordingProvider, recorder record.EventRecorder) (*EstimateScheduler, *scheduledTarget) {
+		s := NewEstimateScheduler(1, logf.Log.WithName("test"))
+		s.now = func() time.Time { return now }
+		if err := s.Add(EstimateTarget{
+			ID:             "default/ihpa-nginx-cpu",
+			Name:           "ihpa-nginx-cpu",
+			UID:            "uid",
+			EstimateMode:   string(AdjustMode),
+			MetricName:     "ake.ihpa.forecasted_nginx",
+			MetricProvider: provider,
+			StateStore:     store,
+			Recorder:       recorder,
+			Owner:          &ihpav1beta2.IntelligentHorizontalPodAutoscaler{},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		st, _ := s.get("default/ihpa-nginx-cpu")
+		return s, st
+	}
+
+	s, st := start(&recordingProvider{fetch: 20}, record.NewFakeRecorder(10))
+	if err := s.Load("default/ihpa-nginx-cpu", data); err != nil {
+		t.Fatal(err)
+	}
+	now = base.Add(60 * time.Second)
+	s.process(st)
+	s.saveStates()
+
+	// the state has no forecasted data, and is deleted with the estimator
+	var cm corev1.ConfigMap
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "ihpa-nginx-cpu" + estimatorstate.ConfigMapSuffix}, &cm); err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].Kind != "Estimator" || refs[0].UID != "uid" {
+		t.Fatalf("owner references are not match (got=%v)", refs)
+	}
+
+	// restart of the controller
+	now = base.Add(90 * time.Second)
+	provider := &recordingProvider{fetch: 20}
+	recorder := record.NewFakeRecorder(10)
+	s, st = start(provider, recorder)
+	if len(st.pastDatumQueue) != 1 {
+		t.Fatalf("past data is not restored (got=%v)", st.pastDatumQueue)
+	}
+	if err := s.Load("default/ihpa-nginx-cpu", data); err != nil {
+		t.Fatal(err)
+	}
+	// the first send after restart is adjusted
+	now = base.Add(120 * time.Second)
+	st.send(s.now)
+	if got := provider.sent["ake.ihpa.forecasted_nginx"]; got != 20 {
+		t.Fatalf("sent value is not match (got=%v, exp=%v)", got, 20)
+	}
+	// the same data is not reported as new data
+	for _, reason := range recordedReasons(recorder) {
+		if reason == EventReasonForecastDataLoaded {
+			t.Fatalf("unexpected event is recorded (got=%s)", reason)
+		}
+	}
+}
+
+// countingStateStore counts saves of each state.
+type countingStateStore struct {
+	mu     sync.Mutex
+	states map[string]*estimatorstate.State
+	saves  map[string]int
+}
+
+func (c *countingStateStore) Load(id string) (*estimatorstate.State, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.states[id], nil
+}
+
+func (c *countingStateStore) Save(id string, owner *metav1.OwnerReference, state *estimatorstate.State) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.states == nil {
+		c.states = make(map[string]*estimatorstate.State)
+		c.saves = make(map[string]int)
+	}
+	c.states[id] = state
+	c.saves[id]++
+	return nil
+}
+
+func (c *countingStateStore) Delete(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.states, id)
+	return nil
+}
+
+func (c *countingStateStore) count(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saves[id]
+}
+
+func TestEstimateSchedulerSaveStates(t *testing.T) {
+	base := time.Unix(1583020800, 0)
+	now := base
+	store := &countingStateStore{}
+	s := NewEstimateScheduler(1, logf.Log.WithName("test"))
+	s.now = func() time.Time { return now }
+	for _, id := range []string{"default/a", "default/b"} {
+		if err := s.Add(EstimateTarget{
+			ID:             id,
+			EstimateMode:   string(AdjustMode),
+			MetricName:     "ake.ihpa.forecasted_nginx",
+			MetricProvider: &recordingProvider{fetch: 20},
+			StateStore:     store,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Load(id, testEstimateCSV(base.Unix()+60, base.Unix()+120, base.Unix()+180)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ := s.get("default/a")
+
+	// the state is not saved by sends, but saved once for all changes
+	for i := 1; i <= 2; i++ {
+		now = base.Add(time.Duration(i*60) * time.Second)
+		s.process(a)
+	}
+	if got := store.count("default/a"); got != 0 {
+		t.Fatalf("state is saved by send (got=%d)", got)
+	}
+	s.saveStates()
+	if got := store.count("default/a"); got != 1 {
+		t.Fatalf("number of saves is not match (got=%d, exp=%d)", got, 1)
+	}
+	if state, _ := store.Load("default/a"); len(state.PastData) == 0 {
+		t.Fatalf("past data is not match (got=%v)", state.PastData)
+	}
+	// unchanged state is not saved again
+	s.saveStates()
+	if got := store.count("default/a"); got != 1 {
+		t.Fatalf("number of saves is not match (got=%d, exp=%d)", got, 1)
+	}
+
+	// the state of removed target is not saved
+	b, _ := s.get("default/b")
+	now = base.Add(60 * time.Second)
+	s.process(b)
+	s.Remove("default/b")
+	s.saveStates()
+	if state, _ := store.Load("default/b"); state != nil {
+		t.Fatalf("state of removed target is saved (got=%v)", state)
+	}
+}
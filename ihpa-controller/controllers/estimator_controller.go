@@ -25,10 +25,18 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/estimatorstate"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/externalmetrics"
 	mpconfig "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider/config"
 )
 
@@ -38,8 +46,28 @@ type EstimatorReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 
-	opeCh        chan<- *EstimateOperation
-	estimatorChs map[string]chan<- []byte
+	// ExternalMetricStore is shared with built-in external metrics server.
+	// This is nil when the server is disabled.
+	ExternalMetricStore *externalmetrics.Store
+
+	// ForecastSnapshots is shared with IntelligentHorizontalPodAutoscalerReconciler for status.
+	ForecastSnapshots *ForecastSnapshotStore
+
+	// StatusReporter writes the state of estimators to Estimator status.
+	StatusReporter *EstimatorStatusReporter
+
+	// StateStore checkpoints the state of estimators to restore it after restart.
+	// This is nil when the checkpoint is disabled.
+	StateStore estimatorstate.Store
+
+	// Recorder records events of estimators on the IHPA generating them.
+	Recorder record.EventRecorder
+
+	// Workers is the number of workers which send forecasted metrics.
+	// DefaultEstimateWorkers is used if this is zero.
+	Workers int
+
+	scheduler *EstimateScheduler
 }
 
 // +kubebuilder:rbac:groups=ihpa.ake.cyberagent.co.jp,resources=estimators,verbs=get;list;watch;create;update;patch;delete
@@ -54,12 +82,7 @@ func (r *EstimatorReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		// clean up
 		if apierrors.IsNotFound(err) {
 			log.V(LogicMessageLogLevel).Info("cleanup estimator", "target", req.String())
-			delete(r.estimatorChs, req.String())
-			r.opeCh <- &EstimateOperation{
-				Operator: EstimateRemove,
-				Target:   EstimateTarget{ID: req.String()},
-			}
-
+			r.scheduler.Remove(req.String())
 		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
@@ -70,67 +93,78 @@ func (r *EstimatorReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 
 	// * create configmap resource for receive forecasted data
-	cmResource, err := g.ConfigMapResource()
+	cm, err := g.ConfigMapResource()
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to generate configmap resource: %w", err)
 	}
-	cm := &corev1.ConfigMap{}
-	// if the configmap already exists, skip create/update
+	// the data is not included in the applied fields
 	// because this is changed by fittingjob.
-	if err := r.Get(ctx, types.NamespacedName{Namespace: cmResource.GetNamespace(), Name: cmResource.GetName()}, cm); err != nil {
-		if apierrors.IsNotFound(err) {
-			log.V(ResourceMessageLogLevel).Info("initialize configmap", "name", cmResource.GetName())
-			cm = cmResource.DeepCopy()
-			if err := r.Create(ctx, cm); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to create configmap: %w", err)
-			}
-			log.V(ResourceMessageLogLevel).Info("successed to create configmap for forecasted data", "name", cm.GetName())
-		} else {
-			return ctrl.Result{}, err
-		}
-	} else {
-		log.V(ResourceMessageLogLevel).Info("configmap is already exists", "name", cm.GetName())
+	result, err := applyChild(ctx, r, r.Scheme, cm)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to apply configmap: %w", err)
 	}
+	log.V(ResourceMessageLogLevel).Info("successed to create/update configmap for forecasted data", "name", cm.GetName(), "result", result)
 
-	// * start estimate
-	if _, ok := r.estimatorChs[req.String()]; !ok {
-		// capacity is set to 5 but usually pick the data by estimator immediately
-		dataCh := make(chan []byte, 5)
+	// * resolve keys of metric provider
+	provider, err := resolveMetricProvider(ctx, r, est.GetNamespace(), &est.Spec.Provider)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to resolve metric provider keys: %w", err)
+	}
 
+	overrides, err := newScheduledOverrides(est.Spec.ScheduledOverrides)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to parse scheduled overrides: %w", err)
+	}
+
+	// * start estimate
+	if !r.scheduler.Has(req.String()) {
 		log.V(LogicMessageLogLevel).Info("estimator added", "id", req.String(), "mode", est.Spec.Mode,
 			"gapMinutes", est.Spec.GapMinutes, "metricName", est.Spec.MetricName, "metricTags", est.Spec.MetricTags,
-			"baseMetricName", est.Spec.BaseMetricName, "baseMetricTags", est.Spec.BaseMetricTags)
-		r.opeCh <- &EstimateOperation{
-			Operator: EstimateAdd,
-			Target: EstimateTarget{
-				ID:             req.String(),
-				EstimateMode:   est.Spec.Mode,
-				GapMinutes:     int(est.Spec.GapMinutes),
-				DataCh:         dataCh,
-				MetricName:     est.Spec.MetricName,
-				MetricTags:     est.Spec.MetricTags,
-				BaseMetricName: est.Spec.BaseMetricName,
-				BaseMetricTags: est.Spec.BaseMetricTags,
-				MetricProvider: mpconfig.ConvertMetricProvider(est.Spec.Provider.DeepCopy()).ActiveProvider(),
-			},
+			"baseMetricName", est.Spec.BaseMetricName, "baseMetricTags", est.Spec.BaseMetricTags, "paused", est.Spec.Paused)
+		if err := r.scheduler.Add(EstimateTarget{
+			ID:                  req.String(),
+			Namespace:           req.Namespace,
+			Name:                req.Name,
+			IHPAName:            est.GetLabels()[ihpaNameLabel],
+			ProviderName:        metricProviderName(&est.Spec.Provider),
+			EstimateMode:        est.Spec.Mode,
+			GapMinutes:          int(est.Spec.GapMinutes),
+			MetricName:          est.Spec.MetricName,
+			MetricTags:          est.Spec.MetricTags,
+			BaseMetricName:      est.Spec.BaseMetricName,
+			BaseMetricTags:      est.Spec.BaseMetricTags,
+			ScheduledOverrides:  overrides,
+			Paused:              est.Spec.Paused,
+			MetricProvider:      mpconfig.ConvertMetricProvider(provider).ActiveProvider(),
+			ExternalMetricStore: r.ExternalMetricStore,
+			ForecastSnapshots:   r.ForecastSnapshots,
+			StatusReporter:      r.StatusReporter,
+			StateStore:          r.StateStore,
+			UID:                 est.GetUID(),
+			Recorder:            r.Recorder,
+			Owner:               ownerIHPA(&est),
+		}); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to add estimator: %w", err)
 		}
-		r.estimatorChs[req.String()] = dataCh
 	} else {
 		log.V(LogicMessageLogLevel).Info("estimator updated", "id", req.String(), "mode", est.Spec.Mode,
 			"gapMinutes", est.Spec.GapMinutes, "metricName", est.Spec.MetricName, "metricTags", est.Spec.MetricTags,
-			"baseMetricName", est.Spec.BaseMetricName, "baseMetricTags", est.Spec.BaseMetricTags)
-		r.opeCh <- &EstimateOperation{
-			Operator: EstimateUpdate,
-			Target: EstimateTarget{
-				ID:             req.String(),
-				EstimateMode:   est.Spec.Mode,
-				GapMinutes:     int(est.Spec.GapMinutes),
-				MetricName:     est.Spec.MetricName,
-				MetricTags:     est.Spec.MetricTags,
-				BaseMetricName: est.Spec.BaseMetricName,
-				BaseMetricTags: est.Spec.BaseMetricTags,
-				MetricProvider: mpconfig.ConvertMetricProvider(est.Spec.Provider.DeepCopy()).ActiveProvider(),
-			},
+			"baseMetricName", est.Spec.BaseMetricName, "baseMetricTags", est.Spec.BaseMetricTags, "paused", est.Spec.Paused)
+		if err := r.scheduler.Update(EstimateTarget{
+			ID:                 req.String(),
+			IHPAName:           est.GetLabels()[ihpaNameLabel],
+			ProviderName:       metricProviderName(&est.Spec.Provider),
+			EstimateMode:       est.Spec.Mode,
+			GapMinutes:         int(est.Spec.GapMinutes),
+			MetricName:         est.Spec.MetricName,
+			MetricTags:         est.Spec.MetricTags,
+			BaseMetricName:     est.Spec.BaseMetricName,
+			BaseMetricTags:     est.Spec.BaseMetricTags,
+			ScheduledOverrides: overrides,
+			Paused:             est.Spec.Paused,
+			MetricProvider:     mpconfig.ConvertMetricProvider(provider).ActiveProvider(),
+		}); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update estimator: %w", err)
 		}
 	}
 
@@ -150,8 +184,9 @@ func (r *EstimatorReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 	if data != nil {
 		log.V(LogicMessageLogLevel).Info("new data stored", "name", req.String(), "key", key)
-		dataCh := r.estimatorChs[req.String()]
-		dataCh <- data
+		if err := r.scheduler.Load(req.String(), data); err != nil {
+			log.V(LogicMessageLogLevel).Info("failed to read data", "error_msg", err)
+		}
 	}
 
 	return ctrl.Result{}, nil
@@ -160,15 +195,67 @@ func (r *EstimatorReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 func (r *EstimatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	log := r.Log.WithName("Initializer")
 
-	r.estimatorChs = make(map[string]chan<- []byte)
+	r.scheduler = NewEstimateScheduler(r.Workers, r.Log.WithName("Estimator"))
+	if err := mgr.Add(r.scheduler); err != nil {
+		return fmt.Errorf("failed to add estimate scheduler: %w", err)
+	}
+	log.V(LogicMessageLogLevel).Info("add estimate scheduler", "workers", r.scheduler.Workers)
 
-	opeCh := make(chan *EstimateOperation)
-	r.opeCh = opeCh
-	go estimatorHandler(opeCh, r.Log.WithName("Estimator"))
-	log.V(LogicMessageLogLevel).Info("start estimate handler")
+	// only Estimators referring Secrets and ConfigMaps in the provider are mapped from them
+	if err := mgr.GetFieldIndexer().IndexField(&ihpav1beta2.Estimator{}, referredSourcesIndexField, func(obj runtime.Object) []string {
+		est, ok := obj.(*ihpav1beta2.Estimator)
+		if !ok {
+			return nil
+		}
+		return referredSources(&est.Spec.Provider)
+	}); err != nil {
+		return fmt.Errorf("failed to index estimators by referred sources: %w", err)
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ihpav1beta2.Estimator{}).
+		WithEventFilter(estimatorGenerationChangedPredicate).
 		Owns(&corev1.ConfigMap{}).
+		// re-resolve keys of metric provider when the source is changed
+		Watches(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.estimatorsReferringSources),
+		}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.estimatorsReferringSources),
+		}).
 		Complete(r)
 }
+
+// estimatorGenerationChangedPredicate ignores updates of Estimator which do not change the generation,
+// e.g. the status written by EstimatorStatusReporter after every send.
+// Events of other kinds are passed, because ConfigMaps and Secrets have no generation.
+var estimatorGenerationChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if _, ok := e.ObjectNew.(*ihpav1beta2.Estimator); !ok {
+			return true
+		}
+		return predicate.GenerationChangedPredicate{}.Update(e)
+	},
+}
+
+// estimatorsReferringSources returns requests of Estimators which refer the object in the provider.
+func (r *EstimatorReconciler) estimatorsReferringSources(obj handler.MapObject) []reconcile.Request {
+	source := referredSource(obj.Object, obj.Meta.GetName())
+	if source == "" {
+		return nil
+	}
+	var estList ihpav1beta2.EstimatorList
+	if err := r.List(context.Background(), &estList,
+		client.InNamespace(obj.Meta.GetNamespace()), client.MatchingFields{referredSourcesIndexField: source}); err != nil {
+		r.Log.Error(err, "failed to list estimators", "namespace", obj.Meta.GetNamespace())
+		return nil
+	}
+
+	reqs := make([]reconcile.Request, 0, len(estList.Items))
+	for _, est := range estList.Items {
+		reqs = append(reqs, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: est.GetNamespace(), Name: est.GetName()},
+		})
+	}
+	return reqs
+}
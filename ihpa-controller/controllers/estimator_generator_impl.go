@@ -30,6 +30,11 @@ func (g *estimatorGeneratorImpl) ConfigMapResource() (*corev1.ConfigMap, error)
 		},
 	}
 
+	// the data is cleaned up with the IHPA which generates the estimator
+	if name, ok := g.est.GetLabels()[ihpaNameLabel]; ok {
+		addIHPALabel(name, &cm)
+	}
+
 	if err := ctrlutil.SetControllerReference(g.est, &cm, g.scheme); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EstimatorStatusReportInterval is minimum interval of writing Estimator status.
+	// Estimators update their state at every send, so the status is written at this rate at most.
+	EstimatorStatusReportInterval = 30 * time.Second
+)
+
+// EstimatorStatusReporter writes the state of estimators to Estimator status at a throttled rate.
+// Estimators notify their update by Notify, and the reporter flushes the notified ones periodically.
+type EstimatorStatusReporter struct {
+	client.Client
+	Log       logr.Logger
+	Snapshots *ForecastSnapshotStore
+	Interval  time.Duration
+
+	mu    sync.Mutex
+	dirty map[string]struct{}
+}
+
+// Notify marks the estimator of id as updated. This is safe for concurrent use.
+func (r *EstimatorStatusReporter) Notify(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dirty == nil {
+		r.dirty = make(map[string]struct{})
+	}
+	r.dirty[id] = struct{}{}
+}
+
+// Start runs the reporter until stop is closed. This implements manager.Runnable.
+func (r *EstimatorStatusReporter) Start(stop <-chan struct{}) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = EstimatorStatusReportInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	r.Log.V(LogicMessageLogLevel).Info("start estimator status reporter", "interval", interval)
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			r.flush(context.Background())
+		}
+	}
+}
+
+// flush writes status of all notified estimators.
+func (r *EstimatorStatusReporter) flush(ctx context.Context) {
+	r.mu.Lock()
+	ids := r.dirty
+	r.dirty = nil
+	r.mu.Unlock()
+
+	for id := range ids {
+		if err := r.report(ctx, id); err != nil {
+			r.Log.V(LogicMessageLogLevel).Info("failed to report estimator status", "id", id, "error_msg", err)
+			// retry at next flush
+			r.Notify(id)
+		}
+	}
+}
+
+// report writes status of the estimator of id from its ForecastSnapshot.
+func (r *EstimatorStatusReporter) report(ctx context.Context, id string) error {
+	snapshot, ok := r.Snapshots.Get(id)
+	if !ok {
+		// the estimator has been removed
+		return nil
+	}
+	key, err := parseEstimateTargetID(id)
+	if err != nil {
+		return err
+	}
+
+	var est ihpav1beta2.Estimator
+	if err := r.Get(ctx, key, &est); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	status := buildEstimatorStatus(&snapshot)
+	if equality.Semantic.DeepEqual(&est.Status, status) {
+		return nil
+	}
+	est.Status = *status
+	if err := r.Status().Update(ctx, &est); err != nil {
+		return fmt.Errorf("failed to update estimator status: %w", err)
+	}
+	r.Log.V(ResourceMessageLogLevel).Info("estimator status updated", "id", id)
+	return nil
+}
+
+// parseEstimateTargetID parses EstimateTarget.ID which is formatted as "namespace/name".
+func parseEstimateTargetID(id string) (types.NamespacedName, error) {
+	s := strings.SplitN(id, string(types.Separator), 2)
+	if len(s) != 2 {
+		return types.NamespacedName{}, fmt.Errorf("invalid estimate target id: %s", id)
+	}
+	return types.NamespacedName{Namespace: s[0], Name: s[1]}, nil
+}
+
+// buildEstimatorStatus builds Estimator status from the snapshot.
+func buildEstimatorStatus(snapshot *ForecastSnapshot) *ihpav1beta2.EstimatorStatus {
+	status := &ihpav1beta2.EstimatorStatus{
+		SendFailures: snapshot.SendFailures,
+	}
+	if !snapshot.HorizonStart.IsZero() {
+		status.DataStartTime = newTruncatedTime(snapshot.HorizonStart)
+	}
+	if !snapshot.HorizonEnd.IsZero() {
+		status.DataEndTime = newTruncatedTime(snapshot.HorizonEnd)
+	}
+	if !snapshot.NextSendTime.IsZero() {
+		status.NextSendTime = newTruncatedTime(snapshot.NextSendTime)
+	}
+	if !snapshot.LastForecastTime.IsZero() {
+		status.LastSendTime = newTruncatedTime(snapshot.LastForecastTime)
+	}
+	if snapshot.ProviderAccessed {
+		status.LastSentValue = newMilliQuantity(snapshot.AdjustedValue)
+		status.LastSentRawValue = newMilliQuantity(snapshot.RawValue)
+	}
+
+	if n := snapshot.Accuracy.samples(); n != 0 {
+		accuracy := &ihpav1beta2.ForecastAccuracy{Samples: int32(n)}
+		if mae, ok := snapshot.Accuracy.meanAbsoluteError(); ok {
+			accuracy.MeanAbsoluteError = newMilliQuantity(mae)
+		}
+		if mape, ok := snapshot.Accuracy.meanAbsolutePercentageError(); ok {
+			accuracy.MeanAbsolutePercentageError = fmt.Sprintf("%.1f%%", mape)
+		}
+		status.Accuracy = accuracy
+	}
+
+	return status
+}
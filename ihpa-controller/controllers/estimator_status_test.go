@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestForecastAccuracy(t *testing.T) {
+	tests := []struct {
+		forecasts    []float64
+		actuals      []float64
+		expectedN    int
+		expectedMAE  float64
+		expectedMAPE float64
+		validMAPE    bool
+	}{
+		{
+			forecasts:    []float64{110, 90, 50},
+			actuals:      []float64{100, 100, 50},
+			expectedN:    3,
+			expectedMAE:  20.0 / 3,
+			expectedMAPE: 20.0 / 3,
+			validMAPE:    true,
+		},
+		{
+			// zero actual value is excluded from MAPE
+			forecasts:    []float64{10, 120},
+			actuals:      []float64{0, 100},
+			expectedN:    2,
+			expectedMAE:  15,
+			expectedMAPE: 20,
+			validMAPE:    true,
+		},
+		{
+			forecasts: []float64{10},
+			actuals:   []float64{0},
+			expectedN: 1,
+			// MAE only
+			expectedMAE: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		var a forecastAccuracy
+		for i := range tt.forecasts {
+			a.add(tt.forecasts[i], tt.actuals[i])
+		}
+		if a.samples() != tt.expectedN {
+			t.Fatalf("samples is not match (got=%d, exp=%d)", a.samples(), tt.expectedN)
+		}
+		if mae, _ := a.meanAbsoluteError(); mae != tt.expectedMAE {
+			t.Fatalf("mean absolute error is not match (got=%v, exp=%v)", mae, tt.expectedMAE)
+		}
+		mape, ok := a.meanAbsolutePercentageError()
+		if ok != tt.validMAPE || mape != tt.expectedMAPE {
+			t.Fatalf("mean absolute percentage error is not match (got=%v/%v, exp=%v/%v)", mape, ok, tt.expectedMAPE, tt.validMAPE)
+		}
+	}
+
+	// old samples are dropped
+	var a forecastAccuracy
+	for i := 0; i < ForecastAccuracyWindow+10; i++ {
+		a.add(1, 1)
+	}
+	if a.samples() != ForecastAccuracyWindow {
+		t.Fatalf("samples is not match (got=%d, exp=%d)", a.samples(), ForecastAccuracyWindow)
+	}
+}
+
+func TestBuildEstimatorStatus(t *testing.T) {
+	base := time.Date(2020, 3, 1, 4, 0, 0, 0, time.UTC)
+	snapshot := &ForecastSnapshot{
+		LastForecastTime: base.Add(500 * time.Millisecond),
+		HorizonStart:     base.Add(-5 * time.Minute),
+		HorizonEnd:       base.Add(24 * time.Hour),
+		NextSendTime:     base.Add(5 * time.Minute),
+		RawValue:         12.5,
+		AdjustedValue:    15,
+		ProviderAccessed: true,
+		SendFailures:     2,
+	}
+	snapshot.Accuracy.add(110, 100)
+	snapshot.Accuracy.add(90, 100)
+
+	got := buildEstimatorStatus(snapshot)
+	if !got.LastSendTime.Time.Equal(base) {
+		t.Fatalf("last send time is not match (got=%v, exp=%v)", got.LastSendTime, base)
+	}
+	if !got.DataStartTime.Time.Equal(snapshot.HorizonStart) || !got.DataEndTime.Time.Equal(snapshot.HorizonEnd) {
+		t.Fatalf("data range is not match (got=%v-%v, exp=%v-%v)",
+			got.DataStartTime, got.DataEndTime, snapshot.HorizonStart, snapshot.HorizonEnd)
+	}
+	if !got.NextSendTime.Time.Equal(snapshot.NextSendTime) {
+		t.Fatalf("next send time is not match (got=%v, exp=%v)", got.NextSendTime, snapshot.NextSendTime)
+	}
+	if got.LastSentValue.String() != "15" || got.LastSentRawValue.String() != "12500m" {
+		t.Fatalf("last sent value is not match (got=%s/%s, exp=%s/%s)",
+			got.LastSentValue.String(), got.LastSentRawValue.String(), "15", "12500m")
+	}
+	if got.SendFailures != 2 {
+		t.Fatalf("send failures is not match (got=%d, exp=%d)", got.SendFailures, 2)
+	}
+	if got.Accuracy == nil || got.Accuracy.Samples != 2 ||
+		got.Accuracy.MeanAbsoluteError.String() != "10" || got.Accuracy.MeanAbsolutePercentageError != "10.0%" {
+		t.Fatalf("accuracy is not match (got=%+v)", got.Accuracy)
+	}
+
+	// nothing is reported before the estimator runs
+	got = buildEstimatorStatus(&ForecastSnapshot{})
+	if got.LastSentValue != nil || got.Accuracy != nil || got.DataEndTime != nil {
+		t.Fatalf("empty status is expected (got=%+v)", got)
+	}
+}
+
+func TestEstimatorStatusReporter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ihpav1beta2.AddToScheme(scheme)
+	c := fake.NewFakeClientWithScheme(scheme,
+		&ihpav1beta2.Estimator{ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default"}},
+	)
+
+	snapshots := NewForecastSnapshotStore()
+	r := &EstimatorStatusReporter{
+		Client:    c,
+		Log:       logf.Log.WithName("test"),
+		Snapshots: snapshots,
+	}
+	snapshots.Update("default/ihpa-nginx-cpu", func(s *ForecastSnapshot) {
+		s.SendFailures = 3
+	})
+	r.Notify("default/ihpa-nginx-cpu")
+	// removed estimator is ignored
+	r.Notify("default/removed")
+	r.flush(context.Background())
+
+	var est ihpav1beta2.Estimator
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "ihpa-nginx-cpu"}, &est); err != nil {
+		t.Fatal(err)
+	}
+	if est.Status.SendFailures != 3 {
+		t.Fatalf("send failures is not match (got=%d, exp=%d)", est.Status.SendFailures, 3)
+	}
+	if len(r.dirty) != 0 {
+		t.Fatalf("all notified estimators should be flushed (got=%v)", r.dirty)
+	}
+}
+
+func TestEstimatorStatusUpdateKeepsAdjusting(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ihpav1beta2.AddToScheme(scheme)
+	key := types.NamespacedName{Namespace: "default", Name: "ihpa-nginx-cpu"}
+	c := fake.NewFakeClientWithScheme(scheme,
+		&ihpav1beta2.Estimator{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, Generation: 1}},
+	)
+
+	base := time.Unix(1583020800, 0)
+	now := base
+	snapshots := NewForecastSnapshotStore()
+	reporter := &EstimatorStatusReporter{Client: c, Log: logf.Log.WithName("test"), Snapshots: snapshots}
+	provider := &recordingProvider{fetch: 20}
+	s := NewEstimateScheduler(1, logf.Log.WithName("test"))
+	s.now = func() time.Time { return now }
+	if err := s.Add(EstimateTarget{
+		ID:                key.String(),
+		EstimateMode:      string(AdjustMode),
+		MetricName:        "ake.ihpa.forecasted_nginx",
+		MetricProvider:    provider,
+		ForecastSnapshots: snapshots,
+		StatusReporter:    reporter,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := s.get(key.String())
+	data := testEstimateCSV(base.Unix()+60, base.Unix()+120)
+	if err := s.Load(key.String(), data); err != nil {
+		t.Fatal(err)
+	}
+	now = base.Add(60 * time.Second)
+	st.send(s.now)
+
+	// the status written after the send does not trigger reconcile
+	var old, updated ihpav1beta2.Estimator
+	if err := c.Get(context.Background(), key, &old); err != nil {
+		t.Fatal(err)
+	}
+	reporter.flush(context.Background())
+	if err := c.Get(context.Background(), key, &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.LastSendTime == nil {
+		t.Fatalf("status is not updated (got=%+v)", updated.Status)
+	}
+	if estimatorGenerationChangedPredicate.Update(event.UpdateEvent{MetaOld: &old, ObjectOld: &old, MetaNew: &updated, ObjectNew: &updated}) {
+		t.Fatalf("status update should be filtered")
+	}
+
+	// reconcile by other events loads the same data again, and adjusting continues
+	if err := s.Load(key.String(), data); err != nil {
+		t.Fatal(err)
+	}
+	now = base.Add(120 * time.Second)
+	st.send(s.now)
+	if got := provider.sent["ake.ihpa.forecasted_nginx"]; got != 20 {
+		t.Fatalf("sent value is not match (got=%v, exp=%v)", got, 20)
+	}
+	snapshot, _ := snapshots.Get(key.String())
+	if status := buildEstimatorStatus(&snapshot); status.Accuracy == nil {
+		t.Fatalf("accuracy is not recorded (got=%+v)", status)
+	}
+}
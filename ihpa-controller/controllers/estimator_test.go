@@ -198,12 +198,6 @@ func TestAdjustYHat(t *testing.T) {
 }
 
 func TestUpdateEstimateTarget(t *testing.T) {
-	dummyByteCh1 := make(chan []byte)
-	dummyByteCh2 := make(chan []byte)
-
-	dummyStructCh1 := make(chan struct{})
-	dummyStructCh2 := make(chan struct{})
-
 	dummyProvider1 := &datadog.Datadog{
 		APIKey: "xxx",
 		APPKey: "yyy",
@@ -221,16 +215,14 @@ func TestUpdateEstimateTarget(t *testing.T) {
 	}{
 		{
 			base: EstimateTarget{
-				ID:              "a",
-				EstimateMode:    "raw",
-				GapMinutes:      10,
-				MetricName:      "metric1",
-				MetricTags:      []string{"hello", "world"},
-				BaseMetricName:  "base-metric1",
-				BaseMetricTags:  []string{"hello", "world", "foo"},
-				MetricProvider:  dummyProvider1,
-				DataCh:          dummyByteCh1,
-				estimatorStopCh: dummyStructCh1,
+				ID:             "a",
+				EstimateMode:   "raw",
+				GapMinutes:     10,
+				MetricName:     "metric1",
+				MetricTags:     []string{"hello", "world"},
+				BaseMetricName: "base-metric1",
+				BaseMetricTags: []string{"hello", "world", "foo"},
+				MetricProvider: dummyProvider1,
 			},
 			patch: EstimateTarget{
 				ID:             "a",
@@ -243,31 +235,27 @@ func TestUpdateEstimateTarget(t *testing.T) {
 				MetricProvider: dummyProvider2,
 			},
 			expected: EstimateTarget{
-				ID:              "a",
-				EstimateMode:    "adjust",
-				GapMinutes:      5,
-				MetricName:      "metric2",
-				MetricTags:      []string{"hello"},
-				BaseMetricName:  "base-metric2",
-				BaseMetricTags:  []string{"hello", "foo"},
-				MetricProvider:  dummyProvider2,
-				DataCh:          dummyByteCh1,
-				estimatorStopCh: dummyStructCh1,
+				ID:             "a",
+				EstimateMode:   "adjust",
+				GapMinutes:     5,
+				MetricName:     "metric2",
+				MetricTags:     []string{"hello"},
+				BaseMetricName: "base-metric2",
+				BaseMetricTags: []string{"hello", "foo"},
+				MetricProvider: dummyProvider2,
 			},
 			hasError: false,
 		},
 		{
 			base: EstimateTarget{
-				ID:              "a",
-				EstimateMode:    "raw",
-				GapMinutes:      10,
-				MetricName:      "metric1",
-				MetricTags:      []string{"hello", "world"},
-				BaseMetricName:  "base-metric1",
-				BaseMetricTags:  []string{"hello", "world", "foo"},
-				MetricProvider:  dummyProvider1,
-				DataCh:          dummyByteCh1,
-				estimatorStopCh: dummyStructCh1,
+				ID:             "a",
+				EstimateMode:   "raw",
+				GapMinutes:     10,
+				MetricName:     "metric1",
+				MetricTags:     []string{"hello", "world"},
+				BaseMetricName: "base-metric1",
+				BaseMetricTags: []string{"hello", "world", "foo"},
+				MetricProvider: dummyProvider1,
 			},
 			patch: EstimateTarget{
 				ID:             "a",
@@ -275,63 +263,53 @@ func TestUpdateEstimateTarget(t *testing.T) {
 				BaseMetricTags: []string{"hello", "foo"},
 			},
 			expected: EstimateTarget{
-				ID:              "a",
-				EstimateMode:    "adjust",
-				GapMinutes:      10,
-				MetricName:      "metric1",
-				MetricTags:      []string{"hello", "world"},
-				BaseMetricName:  "base-metric1",
-				BaseMetricTags:  []string{"hello", "foo"},
-				MetricProvider:  dummyProvider1,
-				DataCh:          dummyByteCh1,
-				estimatorStopCh: dummyStructCh1,
+				ID:             "a",
+				EstimateMode:   "adjust",
+				GapMinutes:     10,
+				MetricName:     "metric1",
+				MetricTags:     []string{"hello", "world"},
+				BaseMetricName: "base-metric1",
+				BaseMetricTags: []string{"hello", "foo"},
+				MetricProvider: dummyProvider1,
 			},
 			hasError: false,
 		},
 		{
 			base: EstimateTarget{
-				ID:              "a",
-				EstimateMode:    "raw",
-				GapMinutes:      10,
-				MetricName:      "metric1",
-				MetricTags:      []string{"hello", "world"},
-				BaseMetricName:  "base-metric1",
-				BaseMetricTags:  []string{"hello", "world", "foo"},
-				MetricProvider:  dummyProvider1,
-				DataCh:          dummyByteCh1,
-				estimatorStopCh: dummyStructCh1,
+				ID:             "a",
+				EstimateMode:   "raw",
+				GapMinutes:     10,
+				MetricName:     "metric1",
+				MetricTags:     []string{"hello", "world"},
+				BaseMetricName: "base-metric1",
+				BaseMetricTags: []string{"hello", "world", "foo"},
+				MetricProvider: dummyProvider1,
 			},
 			patch: EstimateTarget{
-				ID:              "a",
-				DataCh:          dummyByteCh2,
-				estimatorStopCh: dummyStructCh2,
+				ID: "a",
 			},
 			expected: EstimateTarget{
-				ID:              "a",
-				EstimateMode:    "raw",
-				GapMinutes:      10,
-				MetricName:      "metric1",
-				MetricTags:      []string{"hello", "world"},
-				BaseMetricName:  "base-metric1",
-				BaseMetricTags:  []string{"hello", "world", "foo"},
-				MetricProvider:  dummyProvider1,
-				DataCh:          dummyByteCh1,
-				estimatorStopCh: dummyStructCh1,
+				ID:             "a",
+				EstimateMode:   "raw",
+				GapMinutes:     10,
+				MetricName:     "metric1",
+				MetricTags:     []string{"hello", "world"},
+				BaseMetricName: "base-metric1",
+				BaseMetricTags: []string{"hello", "world", "foo"},
+				MetricProvider: dummyProvider1,
 			},
 			hasError: false,
 		},
 		{
 			base: EstimateTarget{
-				ID:              "a",
-				EstimateMode:    "raw",
-				GapMinutes:      10,
-				MetricName:      "metric1",
-				MetricTags:      []string{"hello", "world"},
-				BaseMetricName:  "base-metric1",
-				BaseMetricTags:  []string{"hello", "world", "foo"},
-				MetricProvider:  dummyProvider1,
-				DataCh:          dummyByteCh1,
-				estimatorStopCh: dummyStructCh1,
+				ID:             "a",
+				EstimateMode:   "raw",
+				GapMinutes:     10,
+				MetricName:     "metric1",
+				MetricTags:     []string{"hello", "world"},
+				BaseMetricName: "base-metric1",
+				BaseMetricTags: []string{"hello", "world", "foo"},
+				MetricProvider: dummyProvider1,
 			},
 			patch: EstimateTarget{
 				ID:           "b",
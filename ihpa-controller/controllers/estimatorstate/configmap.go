@@ -0,0 +1,128 @@
+package estimatorstate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ConfigMapSuffix is appended to the estimator name for the name of ConfigMap.
+	ConfigMapSuffix = "-estimator-state"
+	// ConfigMapKey is a key of the state in ConfigMap.
+	ConfigMapKey = "state.json"
+	// EstimatorLabel is a label to find the estimator of the state.
+	EstimatorLabel = "ihpa.ake.cyberagent.co.jp/estimator"
+)
+
+// ConfigMapStore saves State in a ConfigMap per estimator.
+// The ConfigMap is created in the namespace of the estimator, and it is deleted with the estimator by the owner reference.
+type ConfigMapStore struct {
+	Client client.Client
+}
+
+func NewConfigMapStore(c client.Client) *ConfigMapStore {
+	return &ConfigMapStore{Client: c}
+}
+
+func (s *ConfigMapStore) Load(id string) (*State, error) {
+	key, err := configMapKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var cm corev1.ConfigMap
+	if err := s.Client.Get(context.Background(), key, &cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s: %w", key, err)
+	}
+	data, ok := cm.Data[ConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+	var state State
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state in configmap %s: %w", key, err)
+	}
+	return &state, nil
+}
+
+// Save writes the state with a merge patch, so it does not read the ConfigMap nor conflict with other writers.
+// The ConfigMap is created if it does not exist.
+func (s *ConfigMapStore) Save(id string, owner *metav1.OwnerReference, state *State) error {
+	key, err := configMapKey(id)
+	if err != nil {
+		return err
+	}
+	_, name, _ := splitID(id)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": map[string]string{ConfigMapKey: string(data)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode patch: %w", err)
+	}
+
+	ctx := context.Background()
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	err = s.Client.Patch(ctx, cm, client.RawPatch(types.MergePatchType, patch))
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to patch configmap %s: %w", key, err)
+	}
+
+	cm = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels:    map[string]string{EstimatorLabel: name},
+		},
+		Data: map[string]string{ConfigMapKey: string(data)},
+	}
+	if owner != nil {
+		cm.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	if err := s.Client.Create(ctx, cm); apierrors.IsAlreadyExists(err) {
+		// created by another save after the patch
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		if err := s.Client.Patch(ctx, cm, client.RawPatch(types.MergePatchType, patch)); err != nil {
+			return fmt.Errorf("failed to patch configmap %s: %w", key, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to create configmap %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *ConfigMapStore) Delete(id string) error {
+	key, err := configMapKey(id)
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	if err := s.Client.Delete(context.Background(), cm); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete configmap %s: %w", key, err)
+	}
+	return nil
+}
+
+func configMapKey(id string) (types.NamespacedName, error) {
+	namespace, name, err := splitID(id)
+	if err != nil {
+		return types.NamespacedName{}, err
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name + ConfigMapSuffix}, nil
+}
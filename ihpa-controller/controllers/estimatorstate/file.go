@@ -0,0 +1,96 @@
+package estimatorstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FileStore saves State in a JSON file per estimator under Dir.
+// Dir should be a persistent volume to keep the state across restarts of the controller.
+type FileStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) Load(id string) (*State, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state in %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+func (s *FileStore) Save(id string, _ *metav1.OwnerReference, state *State) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// write to temporary file and rename it to avoid leaving a broken file
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// path returns the file path of id.
+// "_" is not allowed in namespace and name, so it is used as a separator.
+func (s *FileStore) path(id string) (string, error) {
+	namespace, name, err := splitID(id)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, namespace+"_"+name+".json"), nil
+}
@@ -0,0 +1,50 @@
+package estimatorstate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Datum is a forecasted datum of estimator.
+type Datum struct {
+	UnixTime         int64   `json:"unixTime"`
+	EstimateUnixTime int64   `json:"estimateUnixTime"`
+	YHat             float64 `json:"yhat"`
+	UpperYHat        float64 `json:"yhatUpper"`
+	LowerYHat        float64 `json:"yhatLower"`
+}
+
+// State is a checkpoint of estimator.
+// Forecasted data is not saved because it is loaded again from the data ConfigMap of the estimator,
+// and the position to send is derived from the data and the current time.
+type State struct {
+	// DataHash is a hash of the forecasted data loaded by estimator.
+	DataHash string `json:"dataHash,omitempty"`
+	// PastData is sent data which are waiting for comparison with actual metric.
+	PastData []Datum `json:"pastData"`
+	// UpdatedAt is the time when this state is saved.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Store saves and restores State of estimators identified by id ("namespace/name").
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Load returns the saved state. nil is returned if the state does not exist.
+	Load(id string) (*State, error)
+	// Save overwrites the state. owner is the estimator, which is used to delete the state with the estimator.
+	Save(id string, owner *metav1.OwnerReference, state *State) error
+	// Delete removes the state. This does not return error if the state does not exist.
+	Delete(id string) error
+}
+
+// splitID splits id of estimator into namespace and name.
+func splitID(id string) (string, string, error) {
+	s := strings.SplitN(id, "/", 2)
+	if len(s) != 2 || s[0] == "" || s[1] == "" {
+		return "", "", fmt.Errorf("invalid estimator id: %s", id)
+	}
+	return s[0], s[1], nil
+}
@@ -0,0 +1,101 @@
+package estimatorstate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testStore(t *testing.T, s Store) {
+	state := &State{
+		DataHash: "0123456789abcdef",
+		PastData: []Datum{
+			{UnixTime: 1583020500, EstimateUnixTime: 1583019900, YHat: 0.5, UpperYHat: 1.0, LowerYHat: 0.0},
+		},
+		UpdatedAt: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	owner := &metav1.OwnerReference{APIVersion: "ihpa.ake.cyberagent.co.jp/v1beta2", Kind: "Estimator", Name: "nginx", UID: "uid"}
+
+	got, err := s.Load("default/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Fatalf("state should not exist (got=%v)", got)
+	}
+
+	if err := s.Save("default/nginx", owner, state); err != nil {
+		t.Fatal(err)
+	}
+	// overwrite
+	state.DataHash = "fedcba9876543210"
+	if err := s.Save("default/nginx", owner, state); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.Load("default/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Fatalf("state is not match (got=%v, exp=%v)", got, state)
+	}
+
+	if err := s.Delete("default/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("default/nginx"); err != nil {
+		t.Fatalf("deleting not existing state should not fail: %v", err)
+	}
+	if got, _ := s.Load("default/nginx"); got != nil {
+		t.Fatalf("state should be deleted (got=%v)", got)
+	}
+
+	if err := s.Save("invalid", owner, state); err == nil {
+		t.Fatalf("error is expected for invalid id")
+	}
+}
+
+func TestConfigMapStore(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme)
+	testStore(t, NewConfigMapStore(c))
+
+	// the configmap is labeled with estimator name, and owned by the estimator
+	s := NewConfigMapStore(c)
+	owner := &metav1.OwnerReference{APIVersion: "ihpa.ake.cyberagent.co.jp/v1beta2", Kind: "Estimator", Name: "nginx", UID: "uid"}
+	if err := s.Save("default/nginx", owner, &State{}); err != nil {
+		t.Fatal(err)
+	}
+	var cm corev1.ConfigMap
+	key, _ := configMapKey("default/nginx")
+	if err := c.Get(context.Background(), key, &cm); err != nil {
+		t.Fatal(err)
+	}
+	if cm.GetName() != "nginx-estimator-state" || cm.GetLabels()[EstimatorLabel] != "nginx" {
+		t.Fatalf("configmap is not match (got=%s/%v)", cm.GetName(), cm.GetLabels())
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].UID != "uid" || refs[0].Controller != nil {
+		t.Fatalf("owner references are not match (got=%v)", refs)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "estimatorstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
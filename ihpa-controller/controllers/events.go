@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of events recorded on IHPA.
+// Events are recorded only on transitions so that the same event is not repeated every reconciliation.
+const (
+	EventReasonDeleted            = "Deleted"
+	EventReasonHPACreated         = "HPACreated"
+	EventReasonHPAUpdated         = "HPAUpdated"
+	EventReasonFittingJobCreated  = "FittingJobCreated"
+	EventReasonEstimatorCreated   = "EstimatorCreated"
+	EventReasonCronJobCreated     = "CronJobCreated"
+	EventReasonFittingJobFailed   = "FittingJobFailed"
+	EventReasonTriggered          = "Triggered"
+	EventReasonTriggerSkipped     = "TriggerSkipped"
+	EventReasonEstimatorStarted   = "EstimatorStarted"
+	EventReasonEstimatorStopped   = "EstimatorStopped"
+	EventReasonForecastDataLoaded = "ForecastDataLoaded"
+	EventReasonSendFailed         = "SendFailed"
+	EventReasonSendRecovered      = "SendRecovered"
+)
+
+// ownerIHPA returns the IHPA which owns the generated resource as an object for recording events.
+// Only the identity of the IHPA is filled. nil is returned if the resource is not generated from an IHPA.
+func ownerIHPA(obj metav1.Object) runtime.Object {
+	name, ok := obj.GetLabels()[ihpaNameLabel]
+	if !ok {
+		return nil
+	}
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Name != name || ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		ihpa := &ihpav1beta2.IntelligentHorizontalPodAutoscaler{}
+		ihpa.SetNamespace(obj.GetNamespace())
+		ihpa.SetName(name)
+		ihpa.SetUID(ref.UID)
+		return ihpa
+	}
+	return nil
+}
+
+// recordOwnerEvent records an event on the IHPA which owns the generated resource.
+// Nothing is recorded if recorder is nil or the resource is not generated from an IHPA.
+func recordOwnerEvent(recorder record.EventRecorder, obj metav1.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	if owner := ownerIHPA(obj); owner != nil {
+		recorder.Eventf(owner, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// event records an event of the estimator on the owning IHPA.
+func (et *EstimateTarget) event(eventtype, reason, messageFmt string, args ...interface{}) {
+	if et.Recorder == nil || et.Owner == nil {
+		return
+	}
+	et.Recorder.Eventf(et.Owner, eventtype, reason, messageFmt, args...)
+}
+
+// conditionEventType returns the type of event for a transition of the IHPA condition.
+func conditionEventType(cond *ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition) string {
+	healthy := corev1.ConditionTrue
+	if cond.Type == ihpav1beta2.ConditionFittingFailed || cond.Type == ihpav1beta2.ConditionPaused {
+		healthy = corev1.ConditionFalse
+	}
+	if cond.Status == healthy || cond.Reason == "Paused" {
+		return corev1.EventTypeNormal
+	}
+	return corev1.EventTypeWarning
+}
+
+// conditionTransitions returns conditions of status whose status changed from prev.
+// Conditions which are not in prev are not returned, because they are initialized.
+func conditionTransitions(prev, status *ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus) []ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition {
+	var transitions []ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition
+	for _, cond := range status.Conditions {
+		for _, p := range prev.Conditions {
+			if p.Type == cond.Type && p.Status != cond.Status {
+				transitions = append(transitions, cond)
+			}
+		}
+	}
+	return transitions
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// failingProvider is a MetricProvider whose Send returns err.
+type failingProvider struct {
+	recordingProvider
+	err error
+}
+
+func (p *failingProvider) Send(metricName string, timestamp int64, point float64, tags []string, opts map[string]interface{}) error {
+	return p.err
+}
+
+// recordedReasons drains events of the fake recorder and returns their reasons.
+func recordedReasons(r *record.FakeRecorder) []string {
+	var reasons []string
+	for {
+		select {
+		case e := <-r.Events:
+			// the format is "<type> <reason> <message>"
+			reasons = append(reasons, strings.SplitN(e, " ", 3)[1])
+		default:
+			return reasons
+		}
+	}
+}
+
+func TestOwnerIHPA(t *testing.T) {
+	est := &ihpav1beta2.Estimator{ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default"}}
+	if owner := ownerIHPA(est); owner != nil {
+		t.Fatalf("owner is found for estimator without the label (got=%v)", owner)
+	}
+
+	addIHPALabel("nginx", est)
+	est.OwnerReferences = []metav1.OwnerReference{
+		{Name: "nginx", UID: "uid", Controller: func(b bool) *bool { return &b }(true)},
+	}
+	owner, ok := ownerIHPA(est).(*ihpav1beta2.IntelligentHorizontalPodAutoscaler)
+	if !ok || owner.GetName() != "nginx" || owner.GetNamespace() != "default" || owner.GetUID() != "uid" {
+		t.Fatalf("owner is not match (got=%v)", owner)
+	}
+}
+
+func TestConditionTransitions(t *testing.T) {
+	prev := &ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{
+		Conditions: []ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{
+			{Type: ihpav1beta2.ConditionReady, Status: corev1.ConditionTrue},
+			{Type: ihpav1beta2.ConditionForecastAvailable, Status: corev1.ConditionTrue},
+		},
+	}
+	status := &ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{
+		Conditions: []ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{
+			{Type: ihpav1beta2.ConditionReady, Status: corev1.ConditionTrue},
+			{Type: ihpav1beta2.ConditionForecastAvailable, Status: corev1.ConditionFalse, Reason: "ForecastExpired"},
+			// initialized conditions are not transitions
+			{Type: ihpav1beta2.ConditionFittingFailed, Status: corev1.ConditionTrue, Reason: "JobFailed"},
+		},
+	}
+
+	got := conditionTransitions(prev, status)
+	if len(got) != 1 || got[0].Type != ihpav1beta2.ConditionForecastAvailable {
+		t.Fatalf("transitions are not match (got=%v)", got)
+	}
+	if typ := conditionEventType(&got[0]); typ != corev1.EventTypeWarning {
+		t.Fatalf("event type is not match (got=%s, exp=%s)", typ, corev1.EventTypeWarning)
+	}
+
+	tests := []struct {
+		cond     ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition
+		expected string
+	}{
+		{cond: ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{Type: ihpav1beta2.ConditionFittingFailed, Status: corev1.ConditionTrue}, expected: corev1.EventTypeWarning},
+		{cond: ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{Type: ihpav1beta2.ConditionFittingFailed, Status: corev1.ConditionFalse}, expected: corev1.EventTypeNormal},
+		{cond: ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{Type: ihpav1beta2.ConditionPaused, Status: corev1.ConditionTrue, Reason: "Paused"}, expected: corev1.EventTypeNormal},
+		{cond: ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{Type: ihpav1beta2.ConditionReady, Status: corev1.ConditionFalse, Reason: "Paused"}, expected: corev1.EventTypeNormal},
+		{cond: ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{Type: ihpav1beta2.ConditionReady, Status: corev1.ConditionFalse, Reason: "ReconcileFailed"}, expected: corev1.EventTypeWarning},
+	}
+	for _, tt := range tests {
+		if got := conditionEventType(&tt.cond); got != tt.expected {
+			t.Fatalf("event type is not match (cond=%v, got=%s, exp=%s)", tt.cond, got, tt.expected)
+		}
+	}
+}
+
+func TestEstimatorEvents(t *testing.T) {
+	base := time.Unix(1583020800, 0)
+	recorder := record.NewFakeRecorder(10)
+	s := NewEstimateScheduler(1, logf.Log.WithName("test"))
+	s.now = func() time.Time { return base }
+
+	if err := s.Add(EstimateTarget{
+		ID:             "default/ihpa-nginx-cpu",
+		Name:           "ihpa-nginx-cpu",
+		EstimateMode:   string(RawMode),
+		MetricProvider: &recordingProvider{},
+		Recorder:       recorder,
+		Owner:          &ihpav1beta2.IntelligentHorizontalPodAutoscaler{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the same data is loaded twice
+	for i := 0; i < 2; i++ {
+		if err := s.Load("default/ihpa-nginx-cpu", testEstimateCSV(base.Unix()+60, base.Unix()+120)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Remove("default/ihpa-nginx-cpu")
+
+	expected := []string{EventReasonEstimatorStarted, EventReasonForecastDataLoaded, EventReasonEstimatorStopped}
+	if got := recordedReasons(recorder); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("events are not match (got=%v, exp=%v)", got, expected)
+	}
+}
+
+func TestScheduledTargetSendEvents(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	recorder := record.NewFakeRecorder(10)
+	provider := &failingProvider{err: fmt.Errorf("connection refused")}
+	st := &scheduledTarget{
+		target: EstimateTarget{
+			ID:             "default/ihpa-nginx-cpu",
+			EstimateMode:   string(RawMode),
+			MetricName:     "ake.ihpa.forecasted_nginx",
+			MetricProvider: provider,
+			Recorder:       recorder,
+			Owner:          &ihpav1beta2.IntelligentHorizontalPodAutoscaler{},
+			Logger:         logf.Log.WithName("test"),
+		},
+		ctx: context.Background(),
+	}
+	for i := 0; i < 3; i++ {
+		st.data = append(st.data, EstimateDatum{UnixTime: now.Unix() + int64(i)*60, EstimateUnixTime: now.Unix() + int64(i)*60, YHat: 10})
+	}
+
+	// failures are recorded only once until recovery
+	st.send(func() time.Time { return now })
+	st.send(func() time.Time { return now.Add(time.Minute) })
+	provider.err = nil
+	st.send(func() time.Time { return now.Add(2 * time.Minute) })
+
+	expected := []string{EventReasonSendFailed, EventReasonSendRecovered}
+	if got := recordedReasons(recorder); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("events are not match (got=%v, exp=%v)", got, expected)
+	}
+}
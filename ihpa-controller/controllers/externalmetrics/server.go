@@ -0,0 +1,362 @@
+package externalmetrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	APIPath = "/apis/" + GroupVersion
+
+	DefaultCertDir  = "/tmp/k8s-external-metrics-server/serving-certs"
+	DefaultCertName = "tls.crt"
+	DefaultKeyName  = "tls.key"
+
+	// kube-apiserver publishes CA for verifying client certificate of aggregator to this configmap.
+	authenticationConfigMapNamespace = "kube-system"
+	authenticationConfigMapName      = "extension-apiserver-authentication"
+	requestHeaderClientCAKey         = "requestheader-client-ca-file"
+	requestHeaderAllowedNamesKey     = "requestheader-allowed-names"
+	requestHeaderUsernameHeadersKey  = "requestheader-username-headers"
+	requestHeaderGroupHeadersKey     = "requestheader-group-headers"
+	requestHeaderExtraPrefixesKey    = "requestheader-extra-headers-prefix"
+)
+
+// requestHeader is the configuration of request header authentication by the aggregator.
+// The aggregator authenticates the user and passes it in the headers.
+type requestHeader struct {
+	// allowedNames are common names of the client certificate of the aggregator.
+	// Any common name is allowed if this is empty.
+	allowedNames    []string
+	usernameHeaders []string
+	groupHeaders    []string
+	extraPrefixes   []string
+}
+
+// defaultRequestHeader is used if the headers are not published by kube-apiserver.
+var defaultRequestHeader = requestHeader{
+	usernameHeaders: []string{"X-Remote-User"},
+	groupHeaders:    []string{"X-Remote-Group"},
+	extraPrefixes:   []string{"X-Remote-Extra-"},
+}
+
+// Server serves external.metrics.k8s.io api with values in Store.
+// This implements manager.Runnable.
+type Server struct {
+	// Store is source of metric values.
+	Store *Store
+
+	// BindAddress is the address the server binds to.
+	BindAddress string
+
+	// CertDir is the directory that contains the server key and certificate.
+	CertDir string
+
+	// CertName is the server certificate name. Defaults to tls.crt.
+	CertName string
+
+	// KeyName is the server key name. Defaults to tls.key.
+	KeyName string
+
+	// APIReader is used for loading client CA and request headers of kube-apiserver.
+	APIReader client.Reader
+
+	// SubjectAccessReviews authorizes the users passed by the aggregator.
+	SubjectAccessReviews authorizationv1client.SubjectAccessReviewInterface
+
+	Log logr.Logger
+
+	requestHeader requestHeader
+}
+
+// Start starts serving until stop channel is closed.
+func (s *Server) Start(stop <-chan struct{}) error {
+	if s.CertDir == "" {
+		s.CertDir = DefaultCertDir
+	}
+	if s.CertName == "" {
+		s.CertName = DefaultCertName
+	}
+	if s.KeyName == "" {
+		s.KeyName = DefaultKeyName
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(s.CertDir, s.CertName), filepath.Join(s.CertDir, s.KeyName))
+	if err != nil {
+		return fmt.Errorf("failed to load serving certificate: %w", err)
+	}
+	if s.APIReader == nil || s.SubjectAccessReviews == nil {
+		return fmt.Errorf("APIReader and SubjectAccessReviews are required for authentication and authorization")
+	}
+	pool, err := s.loadAuthentication(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to load authentication configuration: %w", err)
+	}
+	// only the aggregator is trusted, so the users in the request headers are authenticated
+	cfg := &tls.Config{
+		Certificates:          []tls.Certificate{cert},
+		ClientCAs:             pool,
+		ClientAuth:            tls.RequireAndVerifyClientCert,
+		VerifyPeerCertificate: s.verifyAllowedName,
+	}
+
+	listener, err := tls.Listen("tcp", s.BindAddress, cfg)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: s.Handler()}
+
+	idleConnsClosed := make(chan struct{})
+	go func() {
+		<-stop
+		s.Log.Info("shutting down external metrics server")
+		if err := srv.Shutdown(context.Background()); err != nil {
+			s.Log.Error(err, "error shutting down the HTTP server")
+		}
+		close(idleConnsClosed)
+	}()
+
+	s.Log.Info("serving external metrics server", "addr", s.BindAddress)
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	<-idleConnsClosed
+	return nil
+}
+
+// Handler returns http.Handler serving discovery and metric values.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(APIPath, s.authorize(s.serveAPIResourceList))
+	mux.HandleFunc(APIPath+"/", s.authorize(s.serveExternalMetric))
+	return mux
+}
+
+// authorize wraps h with authorization of the user passed by the aggregator with SubjectAccessReview.
+func (s *Server) authorize(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sar, ok := s.subjectAccessReview(r)
+		if !ok {
+			writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "the user is not authenticated")
+			return
+		}
+		result, err := s.SubjectAccessReviews.CreateContext(r.Context(), sar)
+		if err != nil {
+			s.Log.Error(err, "failed to create subject access review", "user", sar.Spec.User)
+			writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, "failed to authorize the user")
+			return
+		}
+		if !result.Status.Allowed {
+			writeStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden,
+				fmt.Sprintf("user %q cannot %s %s: %s", sar.Spec.User, r.Method, r.URL.Path, result.Status.Reason))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// subjectAccessReview returns SubjectAccessReview of the request.
+// False is returned if the user is not passed in the request headers.
+func (s *Server) subjectAccessReview(r *http.Request) (*authorizationv1.SubjectAccessReview, bool) {
+	rh := s.requestHeader
+	if len(rh.usernameHeaders) == 0 {
+		rh = defaultRequestHeader
+	}
+
+	var sar authorizationv1.SubjectAccessReview
+	for _, h := range rh.usernameHeaders {
+		if sar.Spec.User = r.Header.Get(h); sar.Spec.User != "" {
+			break
+		}
+	}
+	if sar.Spec.User == "" {
+		return nil, false
+	}
+	for _, h := range rh.groupHeaders {
+		sar.Spec.Groups = append(sar.Spec.Groups, r.Header[http.CanonicalHeaderKey(h)]...)
+	}
+	for _, prefix := range rh.extraPrefixes {
+		prefix = http.CanonicalHeaderKey(prefix)
+		for h, values := range r.Header {
+			if !strings.HasPrefix(h, prefix) {
+				continue
+			}
+			key, err := url.PathUnescape(strings.TrimPrefix(h, prefix))
+			if err != nil {
+				continue
+			}
+			if sar.Spec.Extra == nil {
+				sar.Spec.Extra = make(map[string]authorizationv1.ExtraValue)
+			}
+			key = strings.ToLower(key)
+			sar.Spec.Extra[key] = append(sar.Spec.Extra[key], values...)
+		}
+	}
+
+	// the attributes are the same as ones authorized by kube-apiserver before proxying
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, APIPath+"/"), "/")
+	if len(parts) == 3 && parts[0] == "namespaces" {
+		sar.Spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+			Namespace: parts[1],
+			Verb:      "list",
+			Group:     GroupName,
+			Version:   Version,
+			Resource:  parts[2],
+		}
+	} else {
+		sar.Spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{
+			Path: r.URL.Path,
+			Verb: strings.ToLower(r.Method),
+		}
+	}
+	return &sar, true
+}
+
+// verifyAllowedName verifies the common name of the verified client certificate.
+func (s *Server) verifyAllowedName(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(s.requestHeader.allowedNames) == 0 {
+		return nil
+	}
+	for _, chain := range verifiedChains {
+		if len(chain) == 0 {
+			continue
+		}
+		for _, name := range s.requestHeader.allowedNames {
+			if chain[0].Subject.CommonName == name {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("common name of the client certificate is not allowed")
+}
+
+func (s *Server) serveAPIResourceList(w http.ResponseWriter, r *http.Request) {
+	names := s.Store.MetricNames()
+	resources := make([]metav1.APIResource, 0, len(names))
+	for _, name := range names {
+		resources = append(resources, metav1.APIResource{
+			Name:       name,
+			Namespaced: true,
+			Kind:       "ExternalMetricValueList",
+			Verbs:      metav1.Verbs{"get"},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: GroupVersion,
+		APIResources: resources,
+	})
+}
+
+// serveExternalMetric serves /apis/external.metrics.k8s.io/v1beta1/namespaces/<namespace>/<metric name>
+func (s *Server) serveExternalMetric(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, fmt.Sprintf("%s is not allowed", r.Method))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, APIPath+"/"), "/")
+	if len(parts) != 3 || parts[0] != "namespaces" || parts[1] == "" || parts[2] == "" {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("the path is not found: %s", r.URL.Path))
+		return
+	}
+	namespace, metricName := parts[1], parts[2]
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("invalid label selector: %s", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &ExternalMetricValueList{
+		TypeMeta: metav1.TypeMeta{Kind: "ExternalMetricValueList", APIVersion: GroupVersion},
+		Items:    s.Store.List(namespace, metricName, selector),
+	})
+}
+
+// loadAuthentication loads client CA and request headers of the aggregator published by kube-apiserver.
+func (s *Server) loadAuthentication(ctx context.Context) (*x509.CertPool, error) {
+	var cm corev1.ConfigMap
+	key := types.NamespacedName{Namespace: authenticationConfigMapNamespace, Name: authenticationConfigMapName}
+	if err := s.APIReader.Get(ctx, key, &cm); err != nil {
+		return nil, err
+	}
+	ca, ok := cm.Data[requestHeaderClientCAKey]
+	if !ok {
+		return nil, fmt.Errorf("%s is not found in configmap %s", requestHeaderClientCAKey, key)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(ca)) {
+		return nil, fmt.Errorf("failed to parse %s", requestHeaderClientCAKey)
+	}
+
+	rh, err := parseRequestHeader(cm.Data)
+	if err != nil {
+		return nil, err
+	}
+	s.requestHeader = rh
+	return pool, nil
+}
+
+// parseRequestHeader parses request headers in the data of extension-apiserver-authentication configmap.
+// The values are JSON arrays, and defaults are used for missing ones.
+func parseRequestHeader(data map[string]string) (requestHeader, error) {
+	rh := defaultRequestHeader
+	fields := []struct {
+		key   string
+		value *[]string
+	}{
+		{key: requestHeaderAllowedNamesKey, value: &rh.allowedNames},
+		{key: requestHeaderUsernameHeadersKey, value: &rh.usernameHeaders},
+		{key: requestHeaderGroupHeadersKey, value: &rh.groupHeaders},
+		{key: requestHeaderExtraPrefixesKey, value: &rh.extraPrefixes},
+	}
+	for _, f := range fields {
+		v, ok := data[f.key]
+		if !ok || v == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(v), f.value); err != nil {
+			return requestHeader{}, fmt.Errorf("failed to parse %s: %w", f.key, err)
+		}
+	}
+	return rh, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj)
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	writeJSON(w, code, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
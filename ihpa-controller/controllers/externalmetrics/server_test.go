@@ -0,0 +1,274 @@
+package externalmetrics
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// fakeSubjectAccessReviews allows the users in allowed, and records the last review.
+type fakeSubjectAccessReviews struct {
+	allowed map[string]bool
+	last    *authorizationv1.SubjectAccessReview
+}
+
+func (f *fakeSubjectAccessReviews) Create(sar *authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error) {
+	return f.CreateContext(context.Background(), sar)
+}
+
+func (f *fakeSubjectAccessReviews) CreateContext(_ context.Context, sar *authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error) {
+	f.last = sar.DeepCopy()
+	result := sar.DeepCopy()
+	result.Status.Allowed = f.allowed[sar.Spec.User]
+	return result, nil
+}
+
+const testUser = "system:serviceaccount:kube-system:horizontal-pod-autoscaler"
+
+func testGet(u, user string, t *testing.T) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		req.Header.Set("X-Remote-User", user)
+		req.Header.Add("X-Remote-Group", "system:serviceaccounts")
+		req.Header.Add("X-Remote-Group", "system:authenticated")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServerHandler(t *testing.T) {
+	now := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)
+	s := &Server{
+		Store:                testStoreSample(t, now),
+		SubjectAccessReviews: &fakeSubjectAccessReviews{allowed: map[string]bool{testUser: true}},
+		Log:                  logf.Log.WithName("test"),
+	}
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	testServerDiscovery(server.URL, t)
+	testServerExternalMetric(server.URL, t)
+}
+
+func TestServerAuthorization(t *testing.T) {
+	now := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)
+	sars := &fakeSubjectAccessReviews{allowed: map[string]bool{testUser: true}}
+	s := &Server{Store: testStoreSample(t, now), SubjectAccessReviews: sars, Log: logf.Log.WithName("test")}
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	tests := []struct {
+		path                string
+		user                string
+		statusCode          int
+		expectedResource    *authorizationv1.ResourceAttributes
+		expectedNonResource *authorizationv1.NonResourceAttributes
+	}{
+		{path: "/healthz", statusCode: http.StatusOK},
+		{path: APIPath, statusCode: http.StatusUnauthorized},
+		{path: APIPath + "/namespaces/default/ake.ihpa.forecasted_kubernetes_cpu_usage_total", statusCode: http.StatusUnauthorized},
+		{
+			path:                APIPath,
+			user:                "system:anonymous",
+			statusCode:          http.StatusForbidden,
+			expectedNonResource: &authorizationv1.NonResourceAttributes{Path: APIPath, Verb: "get"},
+		},
+		{
+			path:       APIPath + "/namespaces/default/ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			user:       "system:anonymous",
+			statusCode: http.StatusForbidden,
+			expectedResource: &authorizationv1.ResourceAttributes{
+				Namespace: "default",
+				Verb:      "list",
+				Group:     GroupName,
+				Version:   Version,
+				Resource:  "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			},
+		},
+		{
+			path:       APIPath + "/namespaces/default/ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			user:       testUser,
+			statusCode: http.StatusOK,
+			expectedResource: &authorizationv1.ResourceAttributes{
+				Namespace: "default",
+				Verb:      "list",
+				Group:     GroupName,
+				Version:   Version,
+				Resource:  "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		sars.last = nil
+		resp := testGet(server.URL+tt.path, tt.user, t)
+		resp.Body.Close()
+		if resp.StatusCode != tt.statusCode {
+			t.Fatalf("status code is not match (got=%d, exp=%d, path=%s, user=%s)", resp.StatusCode, tt.statusCode, tt.path, tt.user)
+		}
+		if tt.expectedResource == nil && tt.expectedNonResource == nil {
+			if sars.last != nil {
+				t.Fatalf("subject access review is created (path=%s, user=%s)", tt.path, tt.user)
+			}
+			continue
+		}
+		if sars.last == nil {
+			t.Fatalf("subject access review is not created (path=%s, user=%s)", tt.path, tt.user)
+		}
+		spec := sars.last.Spec
+		if spec.User != tt.user || !reflect.DeepEqual(spec.Groups, []string{"system:serviceaccounts", "system:authenticated"}) {
+			t.Fatalf("user is not match (got=%s/%v, exp=%s)", spec.User, spec.Groups, tt.user)
+		}
+		if !reflect.DeepEqual(spec.ResourceAttributes, tt.expectedResource) || !reflect.DeepEqual(spec.NonResourceAttributes, tt.expectedNonResource) {
+			t.Fatalf("attributes are not match (got=%v/%v, exp=%v/%v)", spec.ResourceAttributes, spec.NonResourceAttributes, tt.expectedResource, tt.expectedNonResource)
+		}
+	}
+}
+
+func TestParseRequestHeader(t *testing.T) {
+	tests := []struct {
+		data      map[string]string
+		expected  requestHeader
+		expectErr bool
+	}{
+		{data: map[string]string{}, expected: defaultRequestHeader},
+		{
+			data: map[string]string{
+				requestHeaderAllowedNamesKey:    `["front-proxy-client"]`,
+				requestHeaderUsernameHeadersKey: `["X-Remote-User"]`,
+				requestHeaderGroupHeadersKey:    `["X-Remote-Group"]`,
+				requestHeaderExtraPrefixesKey:   `["X-Remote-Extra-"]`,
+			},
+			expected: requestHeader{
+				allowedNames:    []string{"front-proxy-client"},
+				usernameHeaders: []string{"X-Remote-User"},
+				groupHeaders:    []string{"X-Remote-Group"},
+				extraPrefixes:   []string{"X-Remote-Extra-"},
+			},
+		},
+		{data: map[string]string{requestHeaderAllowedNamesKey: "front-proxy-client"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRequestHeader(tt.data)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("error is not match (data=%v, err=%v, expectErr=%v)", tt.data, err, tt.expectErr)
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.expected) {
+			t.Fatalf("request header is not match (got=%+v, exp=%+v)", got, tt.expected)
+		}
+	}
+}
+
+func TestServerVerifyAllowedName(t *testing.T) {
+	chain := func(cn string) [][]*x509.Certificate {
+		return [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}}
+	}
+
+	tests := []struct {
+		allowedNames []string
+		chains       [][]*x509.Certificate
+		expectErr    bool
+	}{
+		{allowedNames: nil, chains: chain("anyone")},
+		{allowedNames: []string{"front-proxy-client"}, chains: chain("front-proxy-client")},
+		{allowedNames: []string{"front-proxy-client"}, chains: chain("anyone"), expectErr: true},
+	}
+
+	for _, tt := range tests {
+		s := &Server{requestHeader: requestHeader{allowedNames: tt.allowedNames}}
+		if err := s.verifyAllowedName(nil, tt.chains); (err != nil) != tt.expectErr {
+			t.Fatalf("error is not match (allowedNames=%v, err=%v, expectErr=%v)", tt.allowedNames, err, tt.expectErr)
+		}
+	}
+}
+
+func testServerDiscovery(baseurl string, t *testing.T) {
+	resp := testGet(baseurl+APIPath, testUser, t)
+	defer resp.Body.Close()
+
+	var list metav1.APIResourceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if list.GroupVersion != GroupVersion {
+		t.Fatalf("group version is not match (got=%s, exp=%s)", list.GroupVersion, GroupVersion)
+	}
+	if len(list.APIResources) != 2 {
+		t.Fatalf("number of resources is not match (got=%d, exp=%d)", len(list.APIResources), 2)
+	}
+}
+
+func testServerExternalMetric(baseurl string, t *testing.T) {
+	tests := []struct {
+		path          string
+		labelSelector string
+		statusCode    int
+		expectedItems int
+		expectedValue string
+	}{
+		{
+			path:          "/namespaces/default/ake.ihpa.forecasted_nginx_net_request_per_s",
+			labelSelector: "kube_system_uid=xxx,kube_namespace=default,kube_deployment=nginx",
+			statusCode:    http.StatusOK,
+			expectedItems: 1,
+			expectedValue: "30500m",
+		},
+		{
+			path:          "/namespaces/default/ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			labelSelector: "",
+			statusCode:    http.StatusOK,
+			expectedItems: 2,
+		},
+		{
+			path:          "/namespaces/default/ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			labelSelector: "kube_deployment in (",
+			statusCode:    http.StatusBadRequest,
+		},
+		{
+			path:       "/namespaces/default",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		u := baseurl + APIPath + tt.path + "?labelSelector=" + url.QueryEscape(tt.labelSelector)
+		resp := testGet(u, testUser, t)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != tt.statusCode {
+			t.Fatalf("status code is not match (got=%d, exp=%d, url=%s)", resp.StatusCode, tt.statusCode, u)
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var list ExternalMetricValueList
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != tt.expectedItems {
+			t.Fatalf("number of items is not match (got=%d, exp=%d)", len(list.Items), tt.expectedItems)
+		}
+		if tt.expectedValue != "" && list.Items[0].Value.String() != tt.expectedValue {
+			t.Fatalf("value is not match (got=%s, exp=%s)", list.Items[0].Value.String(), tt.expectedValue)
+		}
+	}
+}
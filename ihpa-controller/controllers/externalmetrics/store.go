@@ -0,0 +1,119 @@
+package externalmetrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Store holds the latest forecasted value of each estimator in memory.
+// This is safe for concurrent use.
+type Store struct {
+	mu     sync.RWMutex
+	values map[string]*storedValue
+}
+
+type storedValue struct {
+	namespace string
+	name      string
+	labels    map[string]string
+	value     float64
+	timestamp time.Time
+}
+
+func NewStore() *Store {
+	return &Store{values: make(map[string]*storedValue)}
+}
+
+// Set stores the value with id of estimator.
+// The value which has same id is overwritten.
+func (s *Store) Set(id, namespace, metricName string, metricLabels map[string]string, value float64, timestamp time.Time) {
+	copied := make(map[string]string, len(metricLabels))
+	for k, v := range metricLabels {
+		copied[k] = v
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[id] = &storedValue{
+		namespace: namespace,
+		name:      metricName,
+		labels:    copied,
+		value:     value,
+		timestamp: timestamp,
+	}
+}
+
+// Delete removes the value of id.
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, id)
+}
+
+// List returns the values which match namespace, metric name and selector.
+// Metric name is compared with case insensitive because HPA may request it as lower case.
+func (s *Store) List(namespace, metricName string, selector labels.Selector) []ExternalMetricValue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]ExternalMetricValue, 0)
+	for _, v := range s.values {
+		if v.namespace != namespace || !strings.EqualFold(v.name, metricName) {
+			continue
+		}
+		if selector != nil && !selector.Matches(labels.Set(v.labels)) {
+			continue
+		}
+		metricLabels := make(map[string]string, len(v.labels))
+		for lk, lv := range v.labels {
+			metricLabels[lk] = lv
+		}
+		items = append(items, ExternalMetricValue{
+			MetricName:   v.name,
+			MetricLabels: metricLabels,
+			Timestamp:    metav1.NewTime(v.timestamp),
+			Value:        *resource.NewMilliQuantity(int64(math.Round(v.value*1000)), resource.DecimalSI),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return labels.Set(items[i].MetricLabels).String() < labels.Set(items[j].MetricLabels).String()
+	})
+	return items
+}
+
+// MetricNames returns sorted unique names of stored metrics.
+func (s *Store) MetricNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nameMap := make(map[string]struct{}, len(s.values))
+	for _, v := range s.values {
+		nameMap[v.name] = struct{}{}
+	}
+	names := make([]string, 0, len(nameMap))
+	for name := range nameMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseTags converts "key:value" tags to labels.
+func ParseTags(tags []string) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m
+}
@@ -0,0 +1,110 @@
+package externalmetrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func testStoreSample(t *testing.T, now time.Time) *Store {
+	t.Helper()
+	s := NewStore()
+	s.Set("default/nginx-cpu", "default", "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+		map[string]string{"kube_system_uid": "xxx", "kube_namespace": "default", "kube_deployment": "nginx"}, 250000000, now)
+	s.Set("default/web-cpu", "default", "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+		map[string]string{"kube_system_uid": "xxx", "kube_namespace": "default", "kube_deployment": "web"}, 0.125, now)
+	s.Set("loadtest/nginx-cpu", "loadtest", "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+		map[string]string{"kube_system_uid": "xxx", "kube_namespace": "loadtest", "kube_deployment": "nginx"}, 1, now)
+	s.Set("default/nginx-request", "default", "ake.ihpa.forecasted_nginx_net_request_per_s",
+		map[string]string{"kube_system_uid": "xxx", "kube_namespace": "default", "kube_deployment": "nginx"}, 30.5, now)
+	return s
+}
+
+func TestStoreList(t *testing.T) {
+	now := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)
+	s := testStoreSample(t, now)
+
+	tests := []struct {
+		namespace  string
+		metricName string
+		selector   labels.Selector
+		expected   []ExternalMetricValue
+	}{
+		{
+			namespace:  "default",
+			metricName: "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			selector:   labels.SelectorFromSet(labels.Set{"kube_system_uid": "xxx", "kube_namespace": "default", "kube_deployment": "nginx"}),
+			expected: []ExternalMetricValue{
+				{
+					MetricName:   "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+					MetricLabels: map[string]string{"kube_system_uid": "xxx", "kube_namespace": "default", "kube_deployment": "nginx"},
+					Timestamp:    metav1.NewTime(now),
+					Value:        *resource.NewMilliQuantity(250000000000, resource.DecimalSI),
+				},
+			},
+		},
+		{
+			// HPA may request lower case metric name
+			namespace:  "default",
+			metricName: "AKE.IHPA.FORECASTED_KUBERNETES_CPU_USAGE_TOTAL",
+			selector:   labels.SelectorFromSet(labels.Set{"kube_deployment": "web"}),
+			expected: []ExternalMetricValue{
+				{
+					MetricName:   "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+					MetricLabels: map[string]string{"kube_system_uid": "xxx", "kube_namespace": "default", "kube_deployment": "web"},
+					Timestamp:    metav1.NewTime(now),
+					Value:        *resource.NewMilliQuantity(125, resource.DecimalSI),
+				},
+			},
+		},
+		{
+			namespace:  "loadtest",
+			metricName: "ake.ihpa.forecasted_nginx_net_request_per_s",
+			selector:   labels.Everything(),
+			expected:   []ExternalMetricValue{},
+		},
+		{
+			namespace:  "default",
+			metricName: "ake.ihpa.forecasted_kubernetes_cpu_usage_total",
+			selector:   labels.SelectorFromSet(labels.Set{"kube_deployment": "none"}),
+			expected:   []ExternalMetricValue{},
+		},
+	}
+
+	for _, tt := range tests {
+		got := s.List(tt.namespace, tt.metricName, tt.selector)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Fatalf("external metric values are not match (got=%v, exp=%v)", got, tt.expected)
+		}
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	now := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)
+	s := testStoreSample(t, now)
+
+	s.Delete("default/nginx-request")
+	s.Delete("not-found")
+
+	got := s.MetricNames()
+	expected := []string{"ake.ihpa.forecasted_kubernetes_cpu_usage_total"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("metric names are not match (got=%v, exp=%v)", got, expected)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	got := ParseTags([]string{"kube_namespace:default", "kube_deployment:nginx", "invalid", "url:http://example.com"})
+	expected := map[string]string{
+		"kube_namespace":  "default",
+		"kube_deployment": "nginx",
+		"url":             "http://example.com",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("labels are not match (got=%v, exp=%v)", got, expected)
+	}
+}
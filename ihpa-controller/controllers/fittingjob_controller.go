@@ -19,15 +19,25 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
 )
@@ -35,14 +45,25 @@ import (
 // FittingJobReconciler reconciles a FittingJob object
 type FittingJobReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// CronJobAPIVersion is apiVersion of generated CronJobs, which is batch/v1 or batch/v1beta1.
+	// batch/v1beta1 is used if this is empty.
+	CronJobAPIVersion string
+	// CronJobTimeZone is true if generated CronJobs support spec.timeZone.
+	// Otherwise, schedules in time zones are converted to UTC and converted again when the offsets are changed.
+	CronJobTimeZone bool
 }
 
 // +kubebuilder:rbac:groups=ihpa.ake.cyberagent.co.jp,resources=fittingjobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=ihpa.ake.cyberagent.co.jp,resources=fittingjobs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=cronjobs/status,verbs=get
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (r *FittingJobReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -54,29 +75,18 @@ func (r *FittingJobReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	g, err := NewFittingJobGenerator(&fj)
+	g, err := NewFittingJobGenerator(&fj, r.CronJobTimeZone)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to create fittingjob resource generator: %w", err)
 	}
 
 	// * create/update configmap resource for fittingjob config
-	cmResource, err := g.ConfigMapResource()
+	cm, err := g.ConfigMapResource()
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to generate configmap resource: %w", err)
 	}
-	cm := &corev1.ConfigMap{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: cmResource.GetNamespace(), Name: cmResource.GetName()}, cm); apierrors.IsNotFound(err) {
-		log.V(ResourceMessageLogLevel).Info("initialize configmap", "name", cmResource.GetName())
-		cm = cmResource.DeepCopy()
-		if err := r.Create(ctx, cm); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create configmap: %w", err)
-		}
-	} else {
-		cm.Data = cmResource.DeepCopy().Data
-		cm.BinaryData = cmResource.DeepCopy().BinaryData
-		if err := r.Update(ctx, cm); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to update configmap: %w", err)
-		}
+	if _, err := applyChild(ctx, r, r.Scheme, cm); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to apply configmap: %w", err)
 	}
 	log.V(ResourceMessageLogLevel).Info("successed to create/update configmap", "kind", cm.GetObjectKind().GroupVersionKind(), "name", cm.GetName())
 
@@ -85,26 +95,160 @@ func (r *FittingJobReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to generate cronjob resource: %w", err)
 	}
-	cj := &batchv1beta1.CronJob{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: cjResource.GetNamespace(), Name: cjResource.GetName()}, cj); apierrors.IsNotFound(err) {
-		log.V(ResourceMessageLogLevel).Info("initialize cronjob", "name", cjResource.GetName())
-		cj = cjResource.DeepCopy()
-		if err := r.Create(ctx, cj); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create cronjob: %w", err)
-		}
-	} else {
-		cj.Spec = cjResource.DeepCopy().Spec
-		if err := r.Update(ctx, cj); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to update cronjob: %w", err)
+	// cronjob is handled as unstructured to generate the version served by the cluster
+	var timeZone string
+	if r.CronJobTimeZone {
+		timeZone = fj.Spec.TimeZone
+	}
+	desiredCJ, err := newUnstructuredCronJob(cjResource, r.CronJobAPIVersion, timeZone)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to generate cronjob resource: %w", err)
+	}
+	result, err := applyChild(ctx, r, r.Scheme, desiredCJ)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to apply cronjob: %w", err)
+	}
+	cj, err := typedCronJob(desiredCJ)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if result == ctrlutil.OperationResultCreated {
+		recordOwnerEvent(r.Recorder, &fj, corev1.EventTypeNormal, EventReasonCronJobCreated,
+			"Created CronJob %s for FittingJob %s (schedule=%q)", cj.GetName(), fj.GetName(), cj.Spec.Schedule)
+	}
+	log.V(ResourceMessageLogLevel).Info("successed to create/update cronjob", "kind", cj.GetObjectKind().GroupVersionKind(), "name", cj.GetName(), "result", result)
+
+	// * create a job on demand
+	trigger, err := r.runTrigger(ctx, &fj, cj)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to run trigger: %w", err)
+	}
+
+	// * update status from jobs spawned by the cronjob
+	if err := r.updateStatus(ctx, &fj, cj, trigger); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update fittingjob status: %w", err)
+	}
+
+	// the schedule converted to UTC is updated when the offset of the time zone is changed
+	return ctrl.Result{RequeueAfter: fittingJobRequeueAfter(&fj.Spec, r.CronJobTimeZone, time.Now())}, nil
+}
+
+// updateStatus records the result of jobs to FittingJob status, and raises an event when a new failure is found.
+// trigger is the request of the on-demand job, whose phase is updated from the jobs.
+func (r *FittingJobReconciler) updateStatus(
+	ctx context.Context,
+	fj *ihpav1beta2.FittingJob,
+	cj *batchv1beta1.CronJob,
+	trigger *ihpav1beta2.FittingJobTriggerStatus,
+) error {
+	var jobList batchv1.JobList
+	if err := r.List(ctx, &jobList, client.InNamespace(fj.GetNamespace())); err != nil {
+		return fmt.Errorf("failed to get list of jobs: %w", err)
+	}
+	jobs := make([]batchv1.Job, 0, len(jobList.Items))
+	for _, job := range jobList.Items {
+		if cronJobName, ok := jobOwnerCronJobName(&job); ok && cronJobName == cj.GetName() {
+			jobs = append(jobs, job)
 		}
 	}
-	log.V(ResourceMessageLogLevel).Info("successed to create/update cronjob", "kind", cj.GetObjectKind().GroupVersionKind(), "name", cj.GetName())
 
-	return ctrl.Result{}, nil
+	var datapoints int32
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: fj.GetNamespace(), Name: fj.Spec.DataConfigMap.Name}, cm); err == nil {
+		datapoints = countDatapoints(cm, fj.Spec.TargetMetric.Name)
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get data configmap: %w", err)
+	}
+
+	status := buildFittingJobStatus(&fj.Status, cj, jobs, datapoints)
+	status.LastTrigger = triggerJobStatus(trigger, jobs)
+	if equality.Semantic.DeepEqual(&fj.Status, status) {
+		return nil
+	}
+	if status.LastFailureTime != nil && !status.LastFailureTime.Equal(fj.Status.LastFailureTime) {
+		r.recordEvent(fj, corev1.EventTypeWarning, EventReasonFittingJobFailed,
+			"FittingJob %s failed: %s", fj.GetName(), status.LastFailureReason)
+	}
+	fj.Status = *status
+	return r.Status().Update(ctx, fj)
+}
+
+// recordEvent records an event on the FittingJob and the owning IHPA.
+func (r *FittingJobReconciler) recordEvent(fj *ihpav1beta2.FittingJob, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(fj, eventtype, reason, messageFmt, args...)
+	recordOwnerEvent(r.Recorder, fj, eventtype, reason, messageFmt, args...)
 }
 
 func (r *FittingJobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// cronjobs are read from the cache, because the client reads unstructured objects from the API server
+	cronJobs := mgr.GetCache()
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ihpav1beta2.FittingJob{}).
+		Owns(newCronJobObject(r.CronJobAPIVersion)).
+		// jobs are owned by the cronjob which is owned by fittingjob
+		Watches(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+				return r.fittingJobForJob(cronJobs, obj)
+			}),
+		}).
 		Complete(r)
 }
+
+// fittingJobForJob returns a request of FittingJob which spawned the job through the cronjob.
+// The FittingJob is resolved by the owner reference of the cronjob.
+func (r *FittingJobReconciler) fittingJobForJob(cronJobs client.Reader, obj handler.MapObject) []reconcile.Request {
+	job, ok := obj.Object.(*batchv1.Job)
+	if !ok {
+		return nil
+	}
+	cronJobName, ok := jobOwnerCronJobName(job)
+	if !ok {
+		return nil
+	}
+	cj := newCronJobObject(r.CronJobAPIVersion)
+	if err := cronJobs.Get(context.Background(), types.NamespacedName{Namespace: job.GetNamespace(), Name: cronJobName}, cj); err != nil {
+		if !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to get cronjob", "namespace", job.GetNamespace(), "name", cronJobName)
+		}
+		return nil
+	}
+	name, ok := ownerFittingJobName(cj)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: job.GetNamespace(), Name: name}},
+	}
+}
+
+// ownerFittingJobName returns a name of the fittingjob which controls the object.
+func ownerFittingJobName(obj metav1.Object) (string, bool) {
+	fjKind := ihpav1beta2.GroupVersion.WithKind("FittingJob").GroupKind()
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil || gv.Group != fjKind.Group {
+			continue
+		}
+		// addOwnerReference qualifies the kind with the group
+		if ref.Kind == fjKind.Kind || ref.Kind == fjKind.String() {
+			return ref.Name, true
+		}
+	}
+	return "", false
+}
+
+// jobOwnerCronJobName returns a name of the cronjob which owns the job.
+func jobOwnerCronJobName(job *batchv1.Job) (string, bool) {
+	for _, ref := range job.GetOwnerReferences() {
+		if ref.Kind == "CronJob" {
+			return ref.Name, true
+		}
+	}
+	return "", false
+}
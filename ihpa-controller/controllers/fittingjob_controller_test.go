@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"testing"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestFittingJobForJob(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ihpav1beta2.AddToScheme(scheme)
+
+	fj := &ihpav1beta2.FittingJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: ihpav1beta2.GroupVersion.String(), Kind: "FittingJob"},
+		ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default", UID: "fj-uid"},
+	}
+	// the name of the cronjob is different from the fittingjob
+	owned := &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "renamed", Namespace: "default"}}
+	addOwnerReference(&fj.TypeMeta, &fj.ObjectMeta, owned)
+	notOwned := &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+	c := fake.NewFakeClientWithScheme(scheme, owned, notOwned)
+	r := &FittingJobReconciler{Log: logf.Log.WithName("test")}
+
+	newJob := func(cronJobName string) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "default"}}
+		if cronJobName != "" {
+			job.OwnerReferences = []metav1.OwnerReference{
+				{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: cronJobName, UID: "cj-uid"},
+			}
+		}
+		return job
+	}
+
+	tests := []struct {
+		job      *batchv1.Job
+		expected string
+	}{
+		{job: newJob("renamed"), expected: "ihpa-nginx-cpu"},
+		{job: newJob("other"), expected: ""},
+		{job: newJob("missing"), expected: ""},
+		{job: newJob(""), expected: ""},
+	}
+
+	for _, tt := range tests {
+		reqs := r.fittingJobForJob(c, handler.MapObject{Meta: tt.job, Object: tt.job})
+		var got string
+		if len(reqs) > 0 {
+			got = reqs[0].Name
+		}
+		if len(reqs) > 1 || got != tt.expected {
+			t.Fatalf("requests are not match (got=%v, exp=%s)", reqs, tt.expected)
+		}
+	}
+}
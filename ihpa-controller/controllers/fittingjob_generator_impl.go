@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
 
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
 	mpconfig "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider/config"
@@ -12,20 +15,36 @@ import (
 
 type fittingJobGeneratorImpl struct {
 	fj *ihpav1beta2.FittingJob
+	// now is used to convert the schedule in the time zone to UTC.
+	now func() time.Time
+	// cronJobTimeZone is true if the time zone is set to spec.timeZone of the CronJob,
+	// and then the schedule is kept in the time zone.
+	cronJobTimeZone bool
 }
 
-func NewFittingJobGenerator(fj *ihpav1beta2.FittingJob) (FittingJobGenerator, error) {
-	return &fittingJobGeneratorImpl{fj: fj}, nil
+// NewFittingJobGenerator returns the generator of the resources of fj.
+// cronJobTimeZone should be true if the generated CronJob supports spec.timeZone.
+func NewFittingJobGenerator(fj *ihpav1beta2.FittingJob, cronJobTimeZone bool) (FittingJobGenerator, error) {
+	return &fittingJobGeneratorImpl{fj: fj, now: time.Now, cronJobTimeZone: cronJobTimeZone}, nil
 }
 
 // ConfigMapResource generates an instance of ConfigMap (v1)
 func (g *fittingJobGeneratorImpl) ConfigMapResource() (*corev1.ConfigMap, error) {
 	mpConfig := mpconfig.ConvertMetricProvider(&g.fj.Spec.Provider)
+	mp := mpConfig.ActiveProvider()
+	if mp == nil {
+		return nil, fmt.Errorf("metric provider is not specified")
+	}
+
+	var targetTags map[string]string
+	if g.fj.Spec.TargetMetric.Selector != nil {
+		targetTags = g.fj.Spec.TargetMetric.Selector.MatchLabels
+	}
 
 	fittingJobConfig := &FittingJobConfig{
 		MetricProvider:             *mpConfig,
-		TargetMetricsName:          mpConfig.ActiveProvider().AddSumAggregator(g.fj.Spec.TargetMetric.Name),
-		TargetTags:                 g.fj.Spec.TargetMetric.Selector.MatchLabels,
+		TargetMetricsName:          mp.AddSumAggregator(g.fj.Spec.TargetMetric.Name),
+		TargetTags:                 targetTags,
 		Seasonality:                g.fj.Spec.Seasonality,
 		ChangePointDetectionConfig: g.fj.Spec.ChangePointDetectionConfig,
 		CustomConfig:               g.fj.Spec.CustomConfig,
@@ -53,8 +72,21 @@ func (g *fittingJobGeneratorImpl) ConfigMapResource() (*corev1.ConfigMap, error)
 }
 
 // CronJobResource generates an instance of CronJob (v1beta1)
+// It is converted to the version served by the cluster on apply.
 func (g *fittingJobGeneratorImpl) CronJobResource() (*batchv1beta1.CronJob, error) {
-	jobSpec := *g.fj.Spec.JobPatchSpec.GenerateJobSpec()
+	var schedule string
+	var err error
+	if g.cronJobTimeZone {
+		schedule, err = fittingJobLocalSchedule(&g.fj.Spec, g.fj)
+	} else {
+		schedule, err = fittingJobSchedule(&g.fj.Spec, g.fj, g.now())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jps := &g.fj.Spec.JobPatchSpec
+	jobSpec := *jps.GenerateJobSpec()
 
 	volume := corev1.Volume{
 		Name: "fittingjob-config",
@@ -75,6 +107,11 @@ func (g *fittingJobGeneratorImpl) CronJobResource() (*batchv1beta1.CronJob, erro
 		fittingContainer.Image = DefaultImage
 	}
 	fittingContainer.VolumeMounts = append(fittingContainer.VolumeMounts, volumeMount)
+	// keys of metric provider are given by environment variables
+	// instead of writing them to the configmap.
+	if dd := g.fj.Spec.Provider.ProviderSource.Datadog; dd != nil {
+		fittingContainer.EnvFrom = append(fittingContainer.EnvFrom, dd.KeysFrom...)
+	}
 	jobSpec.Template.Spec.Containers[0] = fittingContainer
 
 	cj := batchv1beta1.CronJob{
@@ -83,11 +120,20 @@ func (g *fittingJobGeneratorImpl) CronJobResource() (*batchv1beta1.CronJob, erro
 			Namespace: g.fj.GetNamespace(),
 		},
 		Spec: batchv1beta1.CronJobSpec{
-			JobTemplate: batchv1beta1.JobTemplateSpec{Spec: jobSpec},
-			Schedule:    randomMinuteCronFormat(int(g.fj.Spec.ExecuteOn)),
+			JobTemplate:                batchv1beta1.JobTemplateSpec{Spec: jobSpec},
+			Schedule:                   schedule,
+			ConcurrencyPolicy:          batchv1beta1.ConcurrencyPolicy(jps.ConcurrencyPolicy),
+			SuccessfulJobsHistoryLimit: jps.SuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     jps.FailedJobsHistoryLimit,
+			StartingDeadlineSeconds:    jps.StartingDeadlineSeconds,
 		},
 	}
 
+	// suspend is defaulted to false by API server when it is resumed
+	if g.fj.Spec.Suspend {
+		cj.Spec.Suspend = &g.fj.Spec.Suspend
+	}
+
 	addOwnerReference(&(g.fj.TypeMeta), &(g.fj.ObjectMeta), &cj)
 
 	return &cj, nil
@@ -96,3 +142,78 @@ func (g *fittingJobGeneratorImpl) CronJobResource() (*batchv1beta1.CronJob, erro
 func (g *fittingJobGeneratorImpl) configMapName() string {
 	return g.fj.GetName() + "-config"
 }
+
+// fittingJobSchedule returns the schedule of the CronJob in UTC.
+// The schedule in the time zone is converted with the offset at now, so it should be converted again
+// when the offset is changed (see fittingJobRequeueAfter).
+func fittingJobSchedule(spec *ihpav1beta2.FittingJobSpec, obj metav1.Object, now time.Time) (string, error) {
+	expr, err := fittingJobLocalSchedule(spec, obj)
+	if err != nil {
+		return "", err
+	}
+	if spec.TimeZone == "" {
+		return expr, nil
+	}
+	loc, err := time.LoadLocation(spec.TimeZone)
+	if err != nil {
+		return "", fmt.Errorf("invalid time zone: %w", err)
+	}
+	schedule, err := parseCronSchedule(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid schedule: %w", err)
+	}
+	if schedule, err = schedule.inUTC(loc, now); err != nil {
+		return "", fmt.Errorf("failed to convert schedule in %s to UTC: %w", spec.TimeZone, err)
+	}
+	return schedule.String(), nil
+}
+
+// fittingJobLocalSchedule returns the schedule of the CronJob in the time zone.
+// Without Schedule, the job is executed daily on ExecuteOn with the delay in the jitter window,
+// which is derived from the identity of the object so that the schedule is not changed on every reconcile.
+func fittingJobLocalSchedule(spec *ihpav1beta2.FittingJobSpec, obj metav1.Object) (string, error) {
+	expr := spec.Schedule
+	if expr == "" {
+		expr = dailyCronFormat(int(spec.ExecuteOn), fittingJobJitterMinutes(spec, obj))
+	}
+	if _, err := parseCronSchedule(expr); err != nil {
+		return "", fmt.Errorf("invalid schedule: %w", err)
+	}
+	return expr, nil
+}
+
+// fittingJobRequeueAfter returns the duration until the offset of the time zone is changed,
+// when the schedule of the CronJob is converted to UTC. This returns 0 if no requeue is needed.
+func fittingJobRequeueAfter(spec *ihpav1beta2.FittingJobSpec, cronJobTimeZone bool, now time.Time) time.Duration {
+	if cronJobTimeZone || spec.TimeZone == "" {
+		return 0
+	}
+	loc, err := time.LoadLocation(spec.TimeZone)
+	if err != nil {
+		return 0
+	}
+	next := nextZoneTransition(loc, now)
+	if next.IsZero() {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// fittingJobJitterMinutes returns the delay in the jitter window derived from UID of the object.
+// The name is used instead if UID is not assigned yet.
+func fittingJobJitterMinutes(spec *ihpav1beta2.FittingJobSpec, obj metav1.Object) int {
+	window := int32(DefaultJitterMinutes)
+	if spec.JitterMinutes != nil {
+		window = *spec.JitterMinutes
+	}
+	if window <= 0 {
+		return 0
+	}
+	id := string(obj.GetUID())
+	if id == "" {
+		id = obj.GetNamespace() + "/" + obj.GetName()
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % uint32(window))
+}
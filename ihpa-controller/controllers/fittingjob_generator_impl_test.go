@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
 	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
@@ -89,10 +90,16 @@ func testFittingJobSample(t *testing.T) (sample1, sample2 *fittingJobGeneratorIm
 					Name: "data-configmap2",
 				},
 				JobPatchSpec: ihpav1beta2.JobPatchSpec{
+					// related to CronJob
+					ConcurrencyPolicy:          "Replace",
+					SuccessfulJobsHistoryLimit: func(i int32) *int32 { return &i }(3),
+					FailedJobsHistoryLimit:     func(i int32) *int32 { return &i }(0),
+					StartingDeadlineSeconds:    func(i int64) *int64 { return &i }(600),
 					// related to Job
-					ActiveDeadlineSeconds: func(i int64) *int64 { return &i }(300),
-					BackoffLimit:          func(i int32) *int32 { return &i }(5),
-					Completions:           func(i int32) *int32 { return &i }(10),
+					ActiveDeadlineSeconds:   func(i int64) *int64 { return &i }(300),
+					BackoffLimit:            func(i int32) *int32 { return &i }(5),
+					Completions:             func(i int32) *int32 { return &i }(10),
+					TTLSecondsAfterFinished: func(i int32) *int32 { return &i }(3600),
 					// related to Pod
 					ImagePullSecrets: []corev1.LocalObjectReference{{Name: "secret1"}},
 					Affinity: &corev1.Affinity{
@@ -172,6 +179,7 @@ func testFittingJobSample(t *testing.T) (sample1, sample2 *fittingJobGeneratorIm
 			},
 		},
 	}
+	sample1.now, sample2.now = time.Now, time.Now
 	return sample1, sample2
 }
 
@@ -316,7 +324,7 @@ func TestFittingJobCronJobResource(t *testing.T) {
 					},
 				},
 				Spec: batchv1beta1.CronJobSpec{
-					Schedule: "* 4 * * *",
+					Schedule: "57 4 * * *",
 					JobTemplate: batchv1beta1.JobTemplateSpec{
 						Spec: batchv1.JobSpec{
 							Template: corev1.PodTemplateSpec{
@@ -372,12 +380,17 @@ func TestFittingJobCronJobResource(t *testing.T) {
 					},
 				},
 				Spec: batchv1beta1.CronJobSpec{
-					Schedule: "* 5 * * *",
+					Schedule:                   "57 5 * * *",
+					ConcurrencyPolicy:          batchv1beta1.ReplaceConcurrent,
+					SuccessfulJobsHistoryLimit: func(i int32) *int32 { return &i }(3),
+					FailedJobsHistoryLimit:     func(i int32) *int32 { return &i }(0),
+					StartingDeadlineSeconds:    func(i int64) *int64 { return &i }(600),
 					JobTemplate: batchv1beta1.JobTemplateSpec{
 						Spec: batchv1.JobSpec{
-							ActiveDeadlineSeconds: func(i int64) *int64 { return &i }(300),
-							BackoffLimit:          func(i int32) *int32 { return &i }(5),
-							Completions:           func(i int32) *int32 { return &i }(10),
+							ActiveDeadlineSeconds:   func(i int64) *int64 { return &i }(300),
+							BackoffLimit:            func(i int32) *int32 { return &i }(5),
+							Completions:             func(i int32) *int32 { return &i }(10),
+							TTLSecondsAfterFinished: func(i int32) *int32 { return &i }(3600),
 							Template: corev1.PodTemplateSpec{
 								Spec: corev1.PodSpec{
 									RestartPolicy:      "OnFailure",
@@ -477,13 +490,144 @@ func TestFittingJobCronJobResource(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		got.Spec.Schedule, err = testReplaceCronMinuteSectionToAny(t, got.Spec.Schedule)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Fatalf("cronjob is not match (got=%#v, exp=%#v)", got, tt.expected)
+		}
+	}
+}
+
+func TestFittingJobCronJobResourceSuspend(t *testing.T) {
+	sample1, _ := testFittingJobSample(t)
+
+	for _, suspend := range []bool{true, false} {
+		sample1.fj.Spec.Suspend = suspend
+		got, err := sample1.CronJobResource()
 		if err != nil {
 			t.Fatal(err)
 		}
+		if (got.Spec.Suspend != nil && *got.Spec.Suspend) != suspend {
+			t.Fatalf("suspend is not match (got=%v, exp=%v)", got.Spec.Suspend, suspend)
+		}
+	}
+}
 
-		if !reflect.DeepEqual(got, tt.expected) {
-			t.Fatalf("cronjob is not match (got=%#v, exp=%#v)", got, tt.expected)
+func TestFittingJobKeysFrom(t *testing.T) {
+	_, sample2 := testFittingJobSample(t)
+	keysFrom := corev1.EnvFromSource{
+		SecretRef: &corev1.SecretEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "datadog-keys"},
+		},
+	}
+	sample2.fj.Spec.Provider.ProviderSource.Datadog = &ihpav1beta2.DatadogProviderSource{
+		KeysFrom: []corev1.EnvFromSource{keysFrom},
+	}
+
+	// keys are not written to the configmap
+	cm, err := sample2.ConfigMapResource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Provider map[string]map[string]interface{} `json:"provider"`
+	}
+	if err := json.Unmarshal([]byte(cm.Data["config.json"]), &config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Provider["datadog"]; len(got) != 0 {
+		t.Fatalf("keys should not be written to configmap (got=%v)", got)
+	}
+
+	// keys are given by environment variables
+	cj, err := sample2.CronJobResource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFrom := cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].EnvFrom
+	if len(envFrom) == 0 || !reflect.DeepEqual(envFrom[len(envFrom)-1], keysFrom) {
+		t.Fatalf("envFrom is not match (got=%v, exp=%v)", envFrom, keysFrom)
+	}
+}
+
+func TestFittingJobCronJobResourceTimeZone(t *testing.T) {
+	sample1, _ := testFittingJobSample(t)
+	sample1.fj.Spec.TimeZone = "Asia/Tokyo"
+	sample1.fj.Spec.Schedule = "30 2 * * 1-5"
+	sample1.now = func() time.Time { return time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		cronJobTimeZone bool
+		expected        string
+	}{
+		{cronJobTimeZone: false, expected: "30 17 * * 0-4"},
+		// the time zone is set to the cronjob
+		{cronJobTimeZone: true, expected: "30 2 * * 1-5"},
+	}
+
+	for _, tt := range tests {
+		sample1.cronJobTimeZone = tt.cronJobTimeZone
+		got, err := sample1.CronJobResource()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Spec.Schedule != tt.expected {
+			t.Fatalf("schedule is not match (cronJobTimeZone=%v, got=%s, exp=%s)", tt.cronJobTimeZone, got.Spec.Schedule, tt.expected)
+		}
+	}
+}
+
+func TestFittingJobRequeueAfter(t *testing.T) {
+	now := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec            ihpav1beta2.FittingJobSpec
+		cronJobTimeZone bool
+		expected        time.Duration
+	}{
+		{spec: ihpav1beta2.FittingJobSpec{}, expected: 0},
+		{spec: ihpav1beta2.FittingJobSpec{TimeZone: "Asia/Tokyo"}, expected: 0},
+		// daylight saving time starts at 2020-03-08 07:00 UTC
+		{spec: ihpav1beta2.FittingJobSpec{TimeZone: "America/New_York"}, expected: time.Date(2020, 3, 8, 7, 0, 0, 0, time.UTC).Sub(now)},
+		{spec: ihpav1beta2.FittingJobSpec{TimeZone: "America/New_York"}, cronJobTimeZone: true, expected: 0},
+	}
+
+	for _, tt := range tests {
+		if got := fittingJobRequeueAfter(&tt.spec, tt.cronJobTimeZone, now); got != tt.expected {
+			t.Fatalf("requeue after is not match (spec=%v, got=%v, exp=%v)", tt.spec, got, tt.expected)
+		}
+	}
+}
+
+func TestFittingJobSchedule(t *testing.T) {
+	obj := &metav1.ObjectMeta{Name: "sample1", Namespace: "default", UID: "9fc642f3-bb9d-404d-afd5-d04f1d6149ad"}
+	now := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+	window := func(i int32) *int32 { return &i }
+
+	tests := []struct {
+		spec      ihpav1beta2.FittingJobSpec
+		obj       *metav1.ObjectMeta
+		expected  string
+		expectErr bool
+	}{
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4}, obj: obj, expected: "57 4 * * *"},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4, JitterMinutes: window(0)}, obj: obj, expected: "0 4 * * *"},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 23, JitterMinutes: window(180)}, obj: obj, expected: "57 1 * * *"},
+		// the name is used if UID is not assigned
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4}, obj: &metav1.ObjectMeta{Name: "sample1", Namespace: "default"}, expected: "36 4 * * *"},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4, JitterMinutes: window(0), TimeZone: "Asia/Tokyo"}, obj: obj, expected: "0 19 * * *"},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4, Schedule: "30 2 * * 1-5"}, obj: obj, expected: "30 2 * * 1-5"},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4, Schedule: "30 2 * * 1-5", TimeZone: "Asia/Tokyo"}, obj: obj, expected: "30 17 * * 0-4"},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4, Schedule: "30 2 * *"}, obj: obj, expectErr: true},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4, TimeZone: "Unknown/Zone"}, obj: obj, expectErr: true},
+		{spec: ihpav1beta2.FittingJobSpec{ExecuteOn: 4, Schedule: "30 2 1 * *", TimeZone: "Asia/Tokyo"}, obj: obj, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := fittingJobSchedule(&tt.spec, tt.obj, now)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("error is not match (spec=%v, err=%v, expectErr=%v)", tt.spec, err, tt.expectErr)
+		}
+		if got != tt.expected {
+			t.Fatalf("schedule is not match (spec=%v, got=%s, exp=%s)", tt.spec, got, tt.expected)
 		}
 	}
 }
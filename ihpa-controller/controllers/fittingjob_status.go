@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// buildFittingJobStatus builds FittingJob status from the cronjob and the jobs spawned by it.
+// Jobs are removed by history limit of CronJob, so the last times in prev are kept if they are newer.
+func buildFittingJobStatus(
+	prev *ihpav1beta2.FittingJobStatus,
+	cj *batchv1beta1.CronJob,
+	jobs []batchv1.Job,
+	datapoints int32,
+) *ihpav1beta2.FittingJobStatus {
+	status := prev.DeepCopy()
+	status.Datapoints = datapoints
+	if cj != nil && cj.Status.LastScheduleTime != nil {
+		status.LastScheduleTime = cj.Status.LastScheduleTime.DeepCopy()
+	}
+
+	sorted := append([]batchv1.Job(nil), jobs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CreationTimestamp.Before(&sorted[j].CreationTimestamp)
+	})
+	if len(sorted) > 0 {
+		status.LastJobName = sorted[len(sorted)-1].GetName()
+	}
+
+	var lastFinished *metav1.Time
+	for _, job := range sorted {
+		finished, failed, cond := jobFinishedCondition(&job)
+		if !finished {
+			continue
+		}
+		finishedTime := cond.LastTransitionTime
+		if !failed && job.Status.CompletionTime != nil {
+			finishedTime = *job.Status.CompletionTime
+		}
+
+		if failed {
+			if status.LastFailureTime == nil || status.LastFailureTime.Before(&finishedTime) {
+				status.LastFailureTime = finishedTime.DeepCopy()
+				status.LastFailureReason = fmt.Sprintf("job %s failed (%s: %s)", job.GetName(), cond.Reason, cond.Message)
+			}
+		} else {
+			if status.LastSuccessfulTime == nil || status.LastSuccessfulTime.Before(&finishedTime) {
+				status.LastSuccessfulTime = finishedTime.DeepCopy()
+			}
+		}
+
+		if job.Status.StartTime != nil && (lastFinished == nil || lastFinished.Before(&finishedTime)) {
+			lastFinished = finishedTime.DeepCopy()
+			status.LastRunDuration = &metav1.Duration{Duration: finishedTime.Sub(job.Status.StartTime.Time)}
+		}
+	}
+
+	return status
+}
+
+// jobFinishedCondition returns the condition if the job is completed or failed.
+func jobFinishedCondition(job *batchv1.Job) (finished, failed bool, cond *batchv1.JobCondition) {
+	for i := range job.Status.Conditions {
+		c := &job.Status.Conditions[i]
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, false, c
+		case batchv1.JobFailed:
+			return true, true, c
+		}
+	}
+	return false, false, nil
+}
+
+// countDatapoints returns the number of forecasted datapoints in the data configmap.
+// The key is same as the one estimator reads.
+func countDatapoints(cm *corev1.ConfigMap, key string) int32 {
+	data, ok := cm.Data[key]
+	if !ok {
+		return 0
+	}
+	eds, err := readEstimateDataAsCSV(bytes.NewReader([]byte(data)))
+	if err != nil {
+		return 0
+	}
+	return int32(len(eds))
+}
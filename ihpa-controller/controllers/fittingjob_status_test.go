@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testFittingJobRun(name string, start time.Time, duration time.Duration, failed bool) batchv1.Job {
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(start),
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: "ihpa-nginx-cpu", UID: "xxx"},
+			},
+		},
+	}
+	startTime := metav1.NewTime(start)
+	finishedTime := metav1.NewTime(start.Add(duration))
+	job.Status.StartTime = &startTime
+	if failed {
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: finishedTime, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"},
+		}
+	} else {
+		job.Status.CompletionTime = &finishedTime
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: finishedTime},
+		}
+	}
+	return job
+}
+
+func TestBuildFittingJobStatus(t *testing.T) {
+	base := time.Date(2020, 3, 1, 4, 0, 0, 0, time.UTC)
+	lastSchedule := metav1.NewTime(base.Add(24 * time.Hour))
+	cj := &batchv1beta1.CronJob{Status: batchv1beta1.CronJobStatus{LastScheduleTime: &lastSchedule}}
+
+	tests := []struct {
+		prev            *ihpav1beta2.FittingJobStatus
+		jobs            []batchv1.Job
+		expectedJob     string
+		expectedSuccess *time.Time
+		expectedFailure *time.Time
+		expectedRun     time.Duration
+	}{
+		{
+			prev: &ihpav1beta2.FittingJobStatus{},
+			jobs: []batchv1.Job{
+				testFittingJobRun("ihpa-nginx-cpu-1", base, 10*time.Minute, false),
+				testFittingJobRun("ihpa-nginx-cpu-2", base.Add(24*time.Hour), 3*time.Minute, true),
+			},
+			expectedJob:     "ihpa-nginx-cpu-2",
+			expectedSuccess: func(t time.Time) *time.Time { return &t }(base.Add(10 * time.Minute)),
+			expectedFailure: func(t time.Time) *time.Time { return &t }(base.Add(24*time.Hour + 3*time.Minute)),
+			expectedRun:     3 * time.Minute,
+		},
+		{
+			// recovered by the latest job
+			prev: &ihpav1beta2.FittingJobStatus{},
+			jobs: []batchv1.Job{
+				testFittingJobRun("ihpa-nginx-cpu-1", base, 3*time.Minute, true),
+				testFittingJobRun("ihpa-nginx-cpu-2", base.Add(24*time.Hour), 10*time.Minute, false),
+			},
+			expectedJob:     "ihpa-nginx-cpu-2",
+			expectedSuccess: func(t time.Time) *time.Time { return &t }(base.Add(24*time.Hour + 10*time.Minute)),
+			expectedFailure: func(t time.Time) *time.Time { return &t }(base.Add(3 * time.Minute)),
+			expectedRun:     10 * time.Minute,
+		},
+		{
+			// failed job was removed by history limit
+			prev: &ihpav1beta2.FittingJobStatus{
+				LastFailureTime:   &metav1.Time{Time: base.Add(3 * time.Minute)},
+				LastFailureReason: "job ihpa-nginx-cpu-1 failed",
+			},
+			jobs:            nil,
+			expectedFailure: func(t time.Time) *time.Time { return &t }(base.Add(3 * time.Minute)),
+		},
+	}
+
+	for _, tt := range tests {
+		got := buildFittingJobStatus(tt.prev, cj, tt.jobs, 288)
+		if !got.LastScheduleTime.Equal(&lastSchedule) {
+			t.Fatalf("last schedule time is not match (got=%v, exp=%v)", got.LastScheduleTime, lastSchedule)
+		}
+		if got.Datapoints != 288 {
+			t.Fatalf("datapoints is not match (got=%d, exp=%d)", got.Datapoints, 288)
+		}
+		if got.LastJobName != tt.expectedJob {
+			t.Fatalf("last job name is not match (got=%s, exp=%s)", got.LastJobName, tt.expectedJob)
+		}
+		if (got.LastSuccessfulTime == nil) != (tt.expectedSuccess == nil) ||
+			(got.LastSuccessfulTime != nil && !got.LastSuccessfulTime.Time.Equal(*tt.expectedSuccess)) {
+			t.Fatalf("last successful time is not match (got=%v, exp=%v)", got.LastSuccessfulTime, tt.expectedSuccess)
+		}
+		if (got.LastFailureTime == nil) != (tt.expectedFailure == nil) ||
+			(got.LastFailureTime != nil && !got.LastFailureTime.Time.Equal(*tt.expectedFailure)) {
+			t.Fatalf("last failure time is not match (got=%v, exp=%v)", got.LastFailureTime, tt.expectedFailure)
+		}
+		if tt.expectedRun != 0 && (got.LastRunDuration == nil || got.LastRunDuration.Duration != tt.expectedRun) {
+			t.Fatalf("last run duration is not match (got=%v, exp=%v)", got.LastRunDuration, tt.expectedRun)
+		}
+	}
+}
+
+func TestCountDatapoints(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		Data: map[string]string{
+			"nginx.net.request_per_s": "timestamp,yhat,yhat_upper,yhat_lower\n1583020800,1.0,2.0,0.5\n1583021100,1.5,2.5,1.0\n",
+			"broken":                  "timestamp\n",
+		},
+	}
+
+	tests := []struct {
+		key      string
+		expected int32
+	}{
+		{key: "nginx.net.request_per_s", expected: 2},
+		{key: "broken", expected: 0},
+		{key: "none", expected: 0},
+	}
+
+	for _, tt := range tests {
+		if got := countDatapoints(cm, tt.key); got != tt.expected {
+			t.Fatalf("datapoints is not match (got=%d, exp=%d, key=%s)", got, tt.expected, tt.key)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// triggerAnnotation requests a fitting job to be executed immediately.
+	// Each new value of the annotation creates a job at most once.
+	// The annotation of the IHPA is propagated to all of its FittingJobs.
+	triggerAnnotation = annotationPrefix + "/trigger"
+
+	// manualJobAnnotation is the annotation which kubectl adds to a job created from a CronJob.
+	manualJobAnnotation = "cronjob.kubernetes.io/instantiate"
+
+	// jobNameMaxLength is the max length of a job name, which is used as a label value of the pods.
+	jobNameMaxLength = 63
+)
+
+// runTrigger creates a job from the CronJob if a new value of the trigger annotation is found.
+// The handled value is returned to be recorded in the status, and the name of the job is derived
+// from the value, so each value creates a job at most once even if the status is not updated.
+func (r *FittingJobReconciler) runTrigger(
+	ctx context.Context,
+	fj *ihpav1beta2.FittingJob,
+	cj *batchv1beta1.CronJob,
+) (*ihpav1beta2.FittingJobTriggerStatus, error) {
+	trigger := fj.GetAnnotations()[triggerAnnotation]
+	if trigger == "" || (fj.Status.LastTrigger != nil && fj.Status.LastTrigger.Trigger == trigger) {
+		return fj.Status.LastTrigger, nil
+	}
+
+	result := &ihpav1beta2.FittingJobTriggerStatus{
+		Trigger:     trigger,
+		RequestTime: metav1.Now(),
+	}
+	if fj.Spec.Suspend {
+		result.Phase = ihpav1beta2.TriggerPhaseSkipped
+		result.Message = "fitting job is suspended"
+		r.recordEvent(fj, corev1.EventTypeWarning, EventReasonTriggerSkipped,
+			"Trigger %q of FittingJob %s is skipped: %s", trigger, fj.GetName(), result.Message)
+		return result, nil
+	}
+
+	job := manualJobResource(cj, trigger)
+	if err := r.Create(ctx, job); apierrors.IsAlreadyExists(err) {
+		r.Log.V(ResourceMessageLogLevel).Info("job for the trigger already exists", "fittingjob", fj.GetName(), "job", job.GetName())
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	} else {
+		r.recordEvent(fj, corev1.EventTypeNormal, EventReasonTriggered,
+			"Created Job %s for trigger %q of FittingJob %s", job.GetName(), trigger, fj.GetName())
+	}
+	result.JobName = job.GetName()
+	result.Phase = ihpav1beta2.TriggerPhaseRunning
+	return result, nil
+}
+
+// manualJobResource generates a job from the JobTemplate of the CronJob in the same way as
+// "kubectl create job --from=cronjob", so the job is handled as the jobs scheduled by the CronJob.
+// The owner reference points the version of the CronJob read from the cluster.
+func manualJobResource(cj *batchv1beta1.CronJob, trigger string) *batchv1.Job {
+	apiVersion := cj.APIVersion
+	if apiVersion == "" {
+		apiVersion = batchv1beta1.SchemeGroupVersion.String()
+	}
+	annotations := make(map[string]string, len(cj.Spec.JobTemplate.Annotations)+1)
+	for k, v := range cj.Spec.JobTemplate.Annotations {
+		annotations[k] = v
+	}
+	annotations[manualJobAnnotation] = "manual"
+	labels := make(map[string]string, len(cj.Spec.JobTemplate.Labels))
+	for k, v := range cj.Spec.JobTemplate.Labels {
+		labels[k] = v
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        manualJobName(cj.GetName(), trigger),
+			Namespace:   cj.GetNamespace(),
+			Labels:      labels,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: apiVersion,
+					Kind:       cronJobKind,
+					Name:       cj.GetName(),
+					UID:        cj.GetUID(),
+					Controller: func(b bool) *bool { return &b }(true),
+				},
+			},
+		},
+		Spec: *cj.Spec.JobTemplate.Spec.DeepCopy(),
+	}
+}
+
+// manualJobName returns a name of the job for the trigger.
+func manualJobName(cronJobName, trigger string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(trigger))
+	suffix := fmt.Sprintf("-manual-%08x", h.Sum32())
+	if len(cronJobName)+len(suffix) > jobNameMaxLength {
+		cronJobName = cronJobName[:jobNameMaxLength-len(suffix)]
+	}
+	return cronJobName + suffix
+}
+
+// triggerJobStatus updates the phase of the on-demand job from the jobs of the CronJob.
+// The phase is kept if the job is not found, e.g. it is not in the cache yet.
+func triggerJobStatus(trigger *ihpav1beta2.FittingJobTriggerStatus, jobs []batchv1.Job) *ihpav1beta2.FittingJobTriggerStatus {
+	if trigger == nil || trigger.Phase != ihpav1beta2.TriggerPhaseRunning {
+		return trigger
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.GetName() != trigger.JobName {
+			continue
+		}
+		finished, failed, cond := jobFinishedCondition(job)
+		if !finished {
+			break
+		}
+		trigger = trigger.DeepCopy()
+		trigger.Phase = ihpav1beta2.TriggerPhaseSucceeded
+		trigger.CompletionTime = cond.LastTransitionTime.DeepCopy()
+		if failed {
+			trigger.Phase = ihpav1beta2.TriggerPhaseFailed
+			trigger.Message = fmt.Sprintf("%s: %s", cond.Reason, cond.Message)
+		} else if job.Status.CompletionTime != nil {
+			trigger.CompletionTime = job.Status.CompletionTime.DeepCopy()
+		}
+		break
+	}
+	return trigger
+}
+
+// propagateTrigger adds the trigger of the IHPA to the FittingJobs.
+// The annotation is patched outside of server-side apply so that the value set on the FittingJob directly
+// is not overwritten by the next reconcile.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) propagateTrigger(
+	ctx context.Context,
+	trigger string,
+	fittingJobs []*ihpav1beta2.FittingJob,
+) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{triggerAnnotation: trigger},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, fj := range fittingJobs {
+		obj := &ihpav1beta2.FittingJob{}
+		obj.SetNamespace(fj.GetNamespace())
+		obj.SetName(fj.GetName())
+		if err := r.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch)); err != nil {
+			return fmt.Errorf("failed to propagate trigger to fittingjob %s: %w", fj.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestManualJobName(t *testing.T) {
+	name := manualJobName("ihpa-nginx-cpu", "2020-01-01")
+	if name != manualJobName("ihpa-nginx-cpu", "2020-01-01") {
+		t.Fatalf("name is not stable (got=%s)", name)
+	}
+	if name == manualJobName("ihpa-nginx-cpu", "2020-01-02") {
+		t.Fatalf("name is not changed by trigger (got=%s)", name)
+	}
+	if !strings.HasPrefix(name, "ihpa-nginx-cpu-manual-") {
+		t.Fatalf("name is not match (got=%s)", name)
+	}
+	if long := manualJobName(strings.Repeat("a", 70), "2020-01-01"); len(long) != jobNameMaxLength {
+		t.Fatalf("length of name is not match (got=%d, exp=%d)", len(long), jobNameMaxLength)
+	}
+}
+
+func TestManualJobResource(t *testing.T) {
+	cj := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default", UID: "uid"},
+		Spec: batchv1beta1.CronJobSpec{
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"note": "template"}},
+				Spec:       batchv1.JobSpec{BackoffLimit: func(i int32) *int32 { return &i }(5)},
+			},
+		},
+	}
+
+	job := manualJobResource(cj, "2020-01-01")
+	if job.GetNamespace() != "default" || *job.Spec.BackoffLimit != 5 {
+		t.Fatalf("job is not generated from the template (got=%v)", job)
+	}
+	if job.Annotations[manualJobAnnotation] != "manual" || job.Annotations["note"] != "template" {
+		t.Fatalf("annotations are not match (got=%v)", job.Annotations)
+	}
+	if cronJobName, ok := jobOwnerCronJobName(job); !ok || cronJobName != "ihpa-nginx-cpu" || job.OwnerReferences[0].UID != "uid" {
+		t.Fatalf("owner is not match (got=%v)", job.OwnerReferences)
+	}
+	if _, ok := cj.Spec.JobTemplate.Annotations[manualJobAnnotation]; ok {
+		t.Fatalf("template is modified (got=%v)", cj.Spec.JobTemplate.Annotations)
+	}
+}
+
+func TestTriggerJobStatus(t *testing.T) {
+	finishedAt := metav1.Unix(1577836800, 0)
+	running := &ihpav1beta2.FittingJobTriggerStatus{Trigger: "1", JobName: "job", Phase: ihpav1beta2.TriggerPhaseRunning}
+	job := func(condType batchv1.JobConditionType) batchv1.Job {
+		j := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job"}}
+		if condType != "" {
+			j.Status.Conditions = []batchv1.JobCondition{
+				{Type: condType, Status: corev1.ConditionTrue, LastTransitionTime: finishedAt, Reason: "BackoffLimitExceeded"},
+			}
+		}
+		return j
+	}
+
+	tests := []struct {
+		trigger  *ihpav1beta2.FittingJobTriggerStatus
+		jobs     []batchv1.Job
+		expected ihpav1beta2.FittingJobTriggerPhase
+	}{
+		{trigger: running, jobs: nil, expected: ihpav1beta2.TriggerPhaseRunning},
+		{trigger: running, jobs: []batchv1.Job{job("")}, expected: ihpav1beta2.TriggerPhaseRunning},
+		{trigger: running, jobs: []batchv1.Job{job(batchv1.JobComplete)}, expected: ihpav1beta2.TriggerPhaseSucceeded},
+		{trigger: running, jobs: []batchv1.Job{job(batchv1.JobFailed)}, expected: ihpav1beta2.TriggerPhaseFailed},
+		{
+			trigger:  &ihpav1beta2.FittingJobTriggerStatus{Trigger: "1", Phase: ihpav1beta2.TriggerPhaseSkipped},
+			jobs:     []batchv1.Job{job(batchv1.JobComplete)},
+			expected: ihpav1beta2.TriggerPhaseSkipped,
+		},
+	}
+
+	for _, tt := range tests {
+		got := triggerJobStatus(tt.trigger, tt.jobs)
+		if got.Phase != tt.expected {
+			t.Fatalf("phase is not match (got=%s, exp=%s)", got.Phase, tt.expected)
+		}
+		if got.Phase == ihpav1beta2.TriggerPhaseSucceeded || got.Phase == ihpav1beta2.TriggerPhaseFailed {
+			if got.CompletionTime == nil || !got.CompletionTime.Equal(&finishedAt) {
+				t.Fatalf("completion time is not match (got=%v, exp=%v)", got.CompletionTime, finishedAt)
+			}
+		}
+	}
+	if running.Phase != ihpav1beta2.TriggerPhaseRunning {
+		t.Fatalf("the given status is modified (got=%v)", running)
+	}
+}
+
+func TestFittingJobReconcilerRunTrigger(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ihpav1beta2.AddToScheme(scheme)
+
+	cj := &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default", UID: "uid"}}
+	fj := &ihpav1beta2.FittingJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ihpa-nginx-cpu",
+			Namespace:   "default",
+			Annotations: map[string]string{triggerAnnotation: "2020-01-01"},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	r := &FittingJobReconciler{Client: c, Log: logf.Log.WithName("test"), Scheme: scheme, Recorder: recorder}
+	ctx := context.Background()
+
+	got, err := r.runTrigger(ctx, fj, cj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Trigger != "2020-01-01" || got.Phase != ihpav1beta2.TriggerPhaseRunning || got.JobName != manualJobName(cj.GetName(), "2020-01-01") {
+		t.Fatalf("trigger status is not match (got=%v)", got)
+	}
+	job := &batchv1.Job{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: got.JobName}, job); err != nil {
+		t.Fatalf("job is not created: %v", err)
+	}
+
+	// the job already exists if the status was not updated
+	if again, err := r.runTrigger(ctx, fj, cj); err != nil || again.JobName != got.JobName {
+		t.Fatalf("trigger is not deduplicated by the job name (got=%v, err=%v)", again, err)
+	}
+	// the handled trigger is ignored
+	fj.Status.LastTrigger = got
+	if again, err := r.runTrigger(ctx, fj, cj); err != nil || again != got {
+		t.Fatalf("handled trigger is not ignored (got=%v, err=%v)", again, err)
+	}
+	var jobs batchv1.JobList
+	if err := c.List(ctx, &jobs, client.InNamespace("default")); err != nil || len(jobs.Items) != 1 {
+		t.Fatalf("number of jobs is not match (got=%d, exp=1, err=%v)", len(jobs.Items), err)
+	}
+
+	// no job is created while suspended
+	fj.Spec.Suspend = true
+	fj.Annotations[triggerAnnotation] = "2020-01-02"
+	got, err = r.runTrigger(ctx, fj, cj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Phase != ihpav1beta2.TriggerPhaseSkipped || got.JobName != "" {
+		t.Fatalf("trigger status is not match (got=%v)", got)
+	}
+
+	expected := []string{EventReasonTriggered, EventReasonTriggerSkipped}
+	if got := recordedReasons(recorder); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("events are not match (got=%v, exp=%v)", got, expected)
+	}
+}
+
+func TestPropagateTrigger(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ihpav1beta2.AddToScheme(scheme)
+
+	fjs := []*ihpav1beta2.FittingJob{
+		{ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default", Annotations: map[string]string{"note": "kept"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx-memory", Namespace: "default"}},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, fjs[0], fjs[1])
+	r := &IntelligentHorizontalPodAutoscalerReconciler{Client: c, Log: logf.Log.WithName("test")}
+
+	if err := r.propagateTrigger(context.Background(), "2020-01-01", fjs); err != nil {
+		t.Fatal(err)
+	}
+	for _, fj := range fjs {
+		got := &ihpav1beta2.FittingJob{}
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: fj.GetName()}, got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Annotations[triggerAnnotation] != "2020-01-01" {
+			t.Fatalf("trigger is not propagated (got=%v)", got.Annotations)
+		}
+		if fj.Annotations["note"] != "" && got.Annotations["note"] != "kept" {
+			t.Fatalf("other annotations are not kept (got=%v)", got.Annotations)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// ForecastAccuracyWindow is the number of datapoints for rolling accuracy.
+	// This is one day of 5 minutes interval data.
+	ForecastAccuracyWindow = 288
+)
+
+// ForecastSnapshot is the latest state of an estimator.
+// This is written by estimator goroutine and read by reconcilers for status.
+type ForecastSnapshot struct {
+	// LastForecastTime is the time when forecasted metrics were sent successfully.
+	LastForecastTime time.Time
+	// HorizonStart and HorizonEnd are the estimate time of the first and the last forecasted datum.
+	HorizonStart time.Time
+	HorizonEnd   time.Time
+	// NextSendTime is the estimate time of the next datum to send.
+	NextSendTime time.Time
+	// RawValue and AdjustedValue are the latest sent values.
+	RawValue      float64
+	AdjustedValue float64
+	// ProviderAccessed is true after the estimator accesses metric provider at least once.
+	ProviderAccessed bool
+	// ProviderError is the message of the latest error of metric provider.
+	// This is empty if the latest access succeeded.
+	ProviderError string
+	// SendFailures is the number of failures of sending data to metric provider.
+	SendFailures int32
+	// Accuracy holds errors between forecasted values and actual values.
+	Accuracy forecastAccuracy
+}
+
+// ForecastSnapshotStore holds ForecastSnapshot of each estimator.
+// This is safe for concurrent use.
+type ForecastSnapshotStore struct {
+	mu        sync.RWMutex
+	snapshots map[string]*ForecastSnapshot
+}
+
+func NewForecastSnapshotStore() *ForecastSnapshotStore {
+	return &ForecastSnapshotStore{snapshots: make(map[string]*ForecastSnapshot)}
+}
+
+// Update applies f to the snapshot of id. The snapshot is created if it does not exist.
+func (s *ForecastSnapshotStore) Update(id string, f func(*ForecastSnapshot)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		snapshot = &ForecastSnapshot{}
+		s.snapshots[id] = snapshot
+	}
+	f(snapshot)
+}
+
+// Get returns a copy of the snapshot of id.
+func (s *ForecastSnapshotStore) Get(id string) (ForecastSnapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return ForecastSnapshot{}, false
+	}
+	copied := *snapshot
+	copied.Accuracy = snapshot.Accuracy.copy()
+	return copied, true
+}
+
+// Delete removes the snapshot of id.
+func (s *ForecastSnapshotStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snapshots, id)
+}
+
+// forecastAccuracy is rolling pairs of forecasted value and actual value.
+type forecastAccuracy struct {
+	forecasts []float64
+	actuals   []float64
+}
+
+// add appends a pair and drops the oldest pair beyond ForecastAccuracyWindow.
+func (a *forecastAccuracy) add(forecast, actual float64) {
+	a.forecasts = append(a.forecasts, forecast)
+	a.actuals = append(a.actuals, actual)
+	if over := len(a.forecasts) - ForecastAccuracyWindow; over > 0 {
+		a.forecasts = a.forecasts[over:]
+		a.actuals = a.actuals[over:]
+	}
+}
+
+func (a *forecastAccuracy) samples() int {
+	return len(a.forecasts)
+}
+
+// meanAbsoluteError returns mean of absolute errors. This returns false if there is no sample.
+func (a *forecastAccuracy) meanAbsoluteError() (float64, bool) {
+	if len(a.forecasts) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for i := range a.forecasts {
+		sum += math.Abs(a.forecasts[i] - a.actuals[i])
+	}
+	return sum / float64(len(a.forecasts)), true
+}
+
+// meanAbsolutePercentageError returns mean of absolute percentage errors.
+// Pairs whose actual value is zero are excluded because the error cannot be defined.
+// This returns false if there is no valid sample.
+func (a *forecastAccuracy) meanAbsolutePercentageError() (float64, bool) {
+	var sum float64
+	n := 0
+	for i := range a.forecasts {
+		if a.actuals[i] == 0 {
+			continue
+		}
+		sum += math.Abs((a.forecasts[i] - a.actuals[i]) / a.actuals[i])
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n) * 100, true
+}
+
+func (a *forecastAccuracy) copy() forecastAccuracy {
+	return forecastAccuracy{
+		forecasts: append([]float64(nil), a.forecasts...),
+		actuals:   append([]float64(nil), a.actuals...),
+	}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	HPAAPIVersionV2      = "autoscaling/v2"
+	HPAAPIVersionV2beta2 = "autoscaling/v2beta2"
+)
+
+// DiscoverHPAAPIVersion returns the newest version of HorizontalPodAutoscaler API served by the cluster.
+// autoscaling/v2 is preferred because autoscaling/v2beta2 is removed in Kubernetes 1.26.
+func DiscoverHPAAPIVersion(dc discovery.ServerGroupsInterface) (string, error) {
+	groups, err := dc.ServerGroups()
+	if err != nil {
+		return "", fmt.Errorf("failed to discover api groups: %w", err)
+	}
+
+	served := make(map[string]struct{})
+	for _, g := range groups.Groups {
+		if g.Name != autoscalingv2beta2.GroupName {
+			continue
+		}
+		for _, v := range g.Versions {
+			served[v.GroupVersion] = struct{}{}
+		}
+	}
+	for _, v := range []string{HPAAPIVersionV2, HPAAPIVersionV2beta2} {
+		if _, ok := served[v]; ok {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("neither %s nor %s is served", HPAAPIVersionV2, HPAAPIVersionV2beta2)
+}
+
+// hpaGroupVersionKind returns GVK of HorizontalPodAutoscaler for apiVersion.
+// autoscaling/v2beta2 is used if apiVersion is empty.
+func hpaGroupVersionKind(apiVersion string) schema.GroupVersionKind {
+	if apiVersion == "" {
+		apiVersion = HPAAPIVersionV2beta2
+	}
+	return schema.FromAPIVersionAndKind(apiVersion, hpaKind)
+}
+
+// newHPAObject returns an empty HorizontalPodAutoscaler of apiVersion to be watched.
+func newHPAObject(apiVersion string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(hpaGroupVersionKind(apiVersion))
+	return u
+}
+
+// newHPAList returns an empty list of HorizontalPodAutoscaler for apiVersion.
+func newHPAList(apiVersion string) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(hpaGroupVersionKind(apiVersion).GroupVersion().WithKind(hpaKind + "List"))
+	return list
+}
+
+// newUnstructuredHPA converts the generated HPA to apiVersion, and adds behavior to it.
+// The spec of autoscaling/v2beta2 is compatible with autoscaling/v2 except behavior which
+// is not defined in the client library of this controller.
+func newUnstructuredHPA(
+	hpa *autoscalingv2beta2.HorizontalPodAutoscaler,
+	behavior *ihpav1beta2.HorizontalPodAutoscalerBehavior,
+	apiVersion string,
+) (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(hpa)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert hpa: %w", err)
+	}
+	// status is owned by kube-controller-manager
+	delete(obj, "status")
+
+	if behavior != nil {
+		b, err := runtime.DefaultUnstructuredConverter.ToUnstructured(behavior)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert behavior: %w", err)
+		}
+		if err := unstructured.SetNestedField(obj, b, "spec", "behavior"); err != nil {
+			return nil, err
+		}
+	}
+
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetGroupVersionKind(hpaGroupVersionKind(apiVersion))
+	return u, nil
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDiscoverHPAAPIVersion(t *testing.T) {
+	tests := []struct {
+		groupVersions []string
+		expected      string
+		expectErr     bool
+	}{
+		{
+			groupVersions: []string{"autoscaling/v1", "autoscaling/v2", "autoscaling/v2beta2"},
+			expected:      HPAAPIVersionV2,
+		},
+		{
+			groupVersions: []string{"autoscaling/v1", "autoscaling/v2beta1", "autoscaling/v2beta2"},
+			expected:      HPAAPIVersionV2beta2,
+		},
+		{
+			groupVersions: []string{"autoscaling/v1"},
+			expectErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		dc := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+		for _, gv := range tt.groupVersions {
+			dc.Resources = append(dc.Resources, &metav1.APIResourceList{
+				GroupVersion: gv,
+				APIResources: []metav1.APIResource{{Name: "horizontalpodautoscalers", Kind: hpaKind}},
+			})
+		}
+		got, err := DiscoverHPAAPIVersion(dc)
+		if tt.expectErr {
+			if err == nil {
+				t.Fatalf("error is expected (got=%s)", got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Fatalf("hpa api version is not match (got=%s, exp=%s)", got, tt.expected)
+		}
+	}
+}
+
+func TestNewUnstructuredHPA(t *testing.T) {
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "ihpa-nginx", Namespace: "default"},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx"},
+			MaxReplicas:    10,
+		},
+	}
+	selectPolicy := ihpav1beta2.MaxPolicySelect
+	behavior := &ihpav1beta2.HorizontalPodAutoscalerBehavior{
+		ScaleUp: &ihpav1beta2.HPAScalingRules{
+			SelectPolicy: &selectPolicy,
+			Policies: []ihpav1beta2.HPAScalingPolicy{
+				{Type: ihpav1beta2.PercentScalingPolicy, Value: 100, PeriodSeconds: 15},
+			},
+		},
+	}
+
+	tests := []struct {
+		apiVersion       string
+		behavior         *ihpav1beta2.HorizontalPodAutoscalerBehavior
+		expectedVersion  string
+		expectedBehavior interface{}
+	}{
+		{
+			apiVersion:      HPAAPIVersionV2,
+			behavior:        behavior,
+			expectedVersion: "autoscaling/v2",
+			expectedBehavior: map[string]interface{}{
+				"scaleUp": map[string]interface{}{
+					"selectPolicy": "Max",
+					"policies": []interface{}{
+						map[string]interface{}{"type": "Percent", "value": int64(100), "periodSeconds": int64(15)},
+					},
+				},
+			},
+		},
+		{
+			apiVersion:       "",
+			behavior:         nil,
+			expectedVersion:  "autoscaling/v2beta2",
+			expectedBehavior: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := newUnstructuredHPA(hpa, tt.behavior, tt.apiVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.GetAPIVersion() != tt.expectedVersion || got.GetKind() != hpaKind {
+			t.Fatalf("apiVersion/kind is not match (got=%s/%s, exp=%s/%s)", got.GetAPIVersion(), got.GetKind(), tt.expectedVersion, hpaKind)
+		}
+		if name, _, _ := unstructured.NestedString(got.Object, "spec", "scaleTargetRef", "name"); name != "nginx" {
+			t.Fatalf("scale target is not match (got=%s, exp=%s)", name, "nginx")
+		}
+		b, _, _ := unstructured.NestedFieldCopy(got.Object, "spec", "behavior")
+		if !reflect.DeepEqual(b, tt.expectedBehavior) {
+			t.Fatalf("behavior is not match (got=%v, exp=%v)", b, tt.expectedBehavior)
+		}
+		if _, ok := got.Object["status"]; ok {
+			t.Fatalf("status should be removed")
+		}
+	}
+}
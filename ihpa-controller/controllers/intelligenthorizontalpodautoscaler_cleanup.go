@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	fittingJobKind     = "FittingJob"
+	estimatorKind      = "Estimator"
+	configMapKind      = "ConfigMap"
+	hpaKind            = "HorizontalPodAutoscaler"
+	roleBindingKind    = "RoleBinding"
+	roleKind           = "Role"
+	serviceAccountKind = "ServiceAccount"
+)
+
+// ihpaChildKinds is kinds of resources generated from an IHPA in deletion order.
+// FittingJobs and Estimators are deleted first to stop writing data before their ConfigMaps are deleted.
+var ihpaChildKinds = []struct {
+	kind    string
+	newList func() runtime.Object
+}{
+	{kind: fittingJobKind, newList: func() runtime.Object { return &ihpav1beta2.FittingJobList{} }},
+	{kind: estimatorKind, newList: func() runtime.Object { return &ihpav1beta2.EstimatorList{} }},
+	{kind: configMapKind, newList: func() runtime.Object { return &corev1.ConfigMapList{} }},
+	// the version of hpa depends on the cluster, see newHPAList
+	{kind: hpaKind, newList: nil},
+	{kind: roleBindingKind, newList: func() runtime.Object { return &rbacv1.RoleBindingList{} }},
+	{kind: roleKind, newList: func() runtime.Object { return &rbacv1.RoleList{} }},
+	{kind: serviceAccountKind, newList: func() runtime.Object { return &corev1.ServiceAccountList{} }},
+}
+
+// ihpaChildSet is names of generated resources keyed by kind.
+type ihpaChildSet map[string]map[string]struct{}
+
+func (s ihpaChildSet) add(kind, name string) {
+	if _, ok := s[kind]; !ok {
+		s[kind] = make(map[string]struct{})
+	}
+	s[kind][name] = struct{}{}
+}
+
+func (s ihpaChildSet) has(kind, name string) bool {
+	_, ok := s[kind][name]
+	return ok
+}
+
+// deleteChildren deletes resources labeled with the IHPA name except the ones in keep.
+// An event is recorded on the IHPA for each deletion.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) deleteChildren(
+	ctx context.Context,
+	log logr.Logger,
+	ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler,
+	keep ihpaChildSet,
+	reason string,
+) error {
+	for _, ck := range ihpaChildKinds {
+		var list runtime.Object
+		if ck.kind == hpaKind {
+			list = newHPAList(r.HPAAPIVersion)
+		} else {
+			list = ck.newList()
+		}
+		if err := r.cachedClient().List(ctx, list,
+			client.InNamespace(ihpa.GetNamespace()),
+			client.MatchingLabels{ihpaNameLabel: ihpa.GetName()},
+		); err != nil {
+			return fmt.Errorf("failed to get list of %s: %w", ck.kind, err)
+		}
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range objs {
+			m, err := meta.Accessor(obj)
+			if err != nil {
+				return err
+			}
+			if keep.has(ck.kind, m.GetName()) || !m.GetDeletionTimestamp().IsZero() {
+				continue
+			}
+			if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("failed to delete %s %s: %w", ck.kind, m.GetName(), err)
+			}
+			log.V(ResourceMessageLogLevel).Info("successed to delete generated resource", "kind", ck.kind, "name", m.GetName())
+			deleteChildMetrics(ihpa.GetNamespace(), ihpa.GetName(), ck.kind, m.GetName())
+			r.recordEvent(ihpa, corev1.EventTypeNormal, EventReasonDeleted, "Deleted %s %s because %s", ck.kind, m.GetName(), reason)
+		}
+	}
+	return nil
+}
+
+// finalize deletes all generated resources and removes the finalizer from the IHPA.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) finalize(
+	ctx context.Context,
+	log logr.Logger,
+	ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler,
+) error {
+	if !containsString(ihpa.GetFinalizers(), cleanupFinalizer) {
+		return nil
+	}
+	if err := r.deleteChildren(ctx, log, ihpa, ihpaChildSet{}, "the IHPA is deleted"); err != nil {
+		return err
+	}
+	deleteIHPAMetrics(ihpa.GetNamespace(), ihpa.GetName())
+
+	ihpa.SetFinalizers(removeString(ihpa.GetFinalizers(), cleanupFinalizer))
+	if err := r.Update(ctx, ihpa); err != nil {
+		return fmt.Errorf("failed to remove finalizer: %w", err)
+	}
+	log.V(ResourceMessageLogLevel).Info("successed to remove finalizer", "finalizer", cleanupFinalizer)
+	return nil
+}
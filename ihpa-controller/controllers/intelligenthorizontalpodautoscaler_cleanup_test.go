@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestDeleteChildren(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ihpav1beta2.AddToScheme(scheme)
+
+	labeled := func(name, ihpaName string) metav1.ObjectMeta {
+		meta := metav1.ObjectMeta{Name: name, Namespace: "default"}
+		if ihpaName != "" {
+			meta.Labels = map[string]string{ihpaNameLabel: ihpaName}
+		}
+		return meta
+	}
+	ihpa := &ihpav1beta2.IntelligentHorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "nginx",
+			Namespace:  "default",
+			Finalizers: []string{cleanupFinalizer},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		ihpa,
+		&ihpav1beta2.FittingJob{ObjectMeta: labeled("ihpa-nginx-cpu", "nginx")},
+		&ihpav1beta2.FittingJob{ObjectMeta: labeled("ihpa-nginx-memory", "nginx")},
+		&ihpav1beta2.Estimator{ObjectMeta: labeled("ihpa-nginx-cpu", "nginx")},
+		&ihpav1beta2.Estimator{ObjectMeta: labeled("ihpa-nginx-memory", "nginx")},
+		&corev1.ConfigMap{ObjectMeta: labeled("ihpa-nginx-cpu", "nginx")},
+		&corev1.ConfigMap{ObjectMeta: labeled("ihpa-nginx-memory", "nginx")},
+		&corev1.ConfigMap{ObjectMeta: labeled("ihpa-other-memory", "other")},
+		&corev1.ConfigMap{ObjectMeta: labeled("unrelated", "")},
+		&rbacv1.Role{ObjectMeta: labeled("ihpa-nginx", "nginx")},
+		&autoscalingv2beta2.HorizontalPodAutoscaler{ObjectMeta: labeled("ihpa-nginx", "nginx")},
+	)
+	recorder := record.NewFakeRecorder(20)
+	r := &IntelligentHorizontalPodAutoscalerReconciler{
+		Client:   c,
+		Log:      logf.Log.WithName("test"),
+		Recorder: recorder,
+	}
+
+	exists := func(obj runtime.Object, name string) bool {
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, obj)
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+
+	// metric "memory" is removed
+	keep := make(ihpaChildSet)
+	keep.add(fittingJobKind, "ihpa-nginx-cpu")
+	keep.add(estimatorKind, "ihpa-nginx-cpu")
+	keep.add(configMapKind, "ihpa-nginx-cpu")
+	keep.add(roleKind, "ihpa-nginx")
+	keep.add(hpaKind, "ihpa-nginx")
+	if err := r.deleteChildren(context.Background(), r.Log, ihpa, keep, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		obj      runtime.Object
+		name     string
+		expected bool
+	}{
+		{obj: &ihpav1beta2.FittingJob{}, name: "ihpa-nginx-cpu", expected: true},
+		{obj: &ihpav1beta2.FittingJob{}, name: "ihpa-nginx-memory", expected: false},
+		{obj: &ihpav1beta2.Estimator{}, name: "ihpa-nginx-cpu", expected: true},
+		{obj: &ihpav1beta2.Estimator{}, name: "ihpa-nginx-memory", expected: false},
+		{obj: &corev1.ConfigMap{}, name: "ihpa-nginx-cpu", expected: true},
+		{obj: &corev1.ConfigMap{}, name: "ihpa-nginx-memory", expected: false},
+		{obj: &corev1.ConfigMap{}, name: "ihpa-other-memory", expected: true},
+		{obj: &corev1.ConfigMap{}, name: "unrelated", expected: true},
+		{obj: &rbacv1.Role{}, name: "ihpa-nginx", expected: true},
+		{obj: &autoscalingv2beta2.HorizontalPodAutoscaler{}, name: "ihpa-nginx", expected: true},
+	}
+	for _, tt := range tests {
+		if got := exists(tt.obj, tt.name); got != tt.expected {
+			t.Fatalf("existence is not match (got=%v, exp=%v, kind=%T, name=%s)", got, tt.expected, tt.obj, tt.name)
+		}
+	}
+	if len(recorder.Events) != 3 {
+		t.Fatalf("the number of events is not match (got=%d, exp=%d)", len(recorder.Events), 3)
+	}
+
+	// the ihpa is deleted
+	if err := r.finalize(context.Background(), r.Log, ihpa); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		expected := tt.name == "ihpa-other-memory" || tt.name == "unrelated"
+		if got := exists(tt.obj, tt.name); got != expected {
+			t.Fatalf("existence is not match (got=%v, exp=%v, kind=%T, name=%s)", got, expected, tt.obj, tt.name)
+		}
+	}
+	var got ihpav1beta2.IntelligentHorizontalPodAutoscaler
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "nginx"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if containsString(got.GetFinalizers(), cleanupFinalizer) {
+		t.Fatalf("finalizer should be removed (got=%v)", got.GetFinalizers())
+	}
+}
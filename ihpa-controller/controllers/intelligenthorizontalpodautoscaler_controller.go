@@ -19,24 +19,36 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"strings"
+	"time"
 
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
 	"github.com/go-logr/logr"
-	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
-	annotationPrefix        = "ihpa.ake.cyberagent.co.jp"
-	fittingJobIDAnnotation  = annotationPrefix + "/fittingjob-id"
-	fittingJobIDsAnnotation = annotationPrefix + "/fittingjob-ids"
+	annotationPrefix       = "ihpa.ake.cyberagent.co.jp"
+	fittingJobIDAnnotation = annotationPrefix + "/fittingjob-id"
+	// ihpaNameLabel is set to resources generated from an IHPA for listing them.
+	ihpaNameLabel = annotationPrefix + "/ihpa-name"
+	// cleanupFinalizer makes the controller delete generated resources before the IHPA is deleted.
+	cleanupFinalizer = annotationPrefix + "/cleanup"
 
 	ResourceMessageLogLevel = 1
 	LogicMessageLogLevel    = 1
@@ -48,230 +60,396 @@ type IntelligentHorizontalPodAutoscalerReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 
-	// fittingJobMap is used for cleanup all fittingjob when ihpa resource is deleted.
-	// Any fittingjob can be deleted when some ihpa metric field is deleted because of comparison fittingJobIDsAnnotation,
-	// but if ihpa is deleted, this controller cannot delete fittingjob because controller cannot refer to the annotation.
-	fittingJobMap map[string]map[string]struct{}
+	// HPAAPIVersion is apiVersion of generated HPAs, which is autoscaling/v2 or autoscaling/v2beta2.
+	// autoscaling/v2beta2 is used if this is empty.
+	HPAAPIVersion string
+
+	// Recorder records changes of generated resources and transitions of conditions on the IHPA.
+	Recorder record.EventRecorder
+
+	// RESTMapper and ScaleClient resolve scale targets other than Deployment, StatefulSet and ReplicaSet.
+	RESTMapper  meta.RESTMapper
+	ScaleClient scale.ScalesGetter
+	// APIReader reads pods of the scale target without cache.
+	APIReader client.Reader
+	// CacheReader reads generated HPAs from the informer cache.
+	// HPAs are handled as unstructured, which the client reads without cache.
+	// If this is nil, HPAs are read by the client.
+	CacheReader client.Reader
+
+	// ForecastSnapshots is shared with EstimatorReconciler for status.
+	// If this is nil, forecast information of the status is not reported.
+	ForecastSnapshots *ForecastSnapshotStore
 }
 
 // +kubebuilder:rbac:groups=ihpa.ake.cyberagent.co.jp,resources=intelligenthorizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=ihpa.ake.cyberagent.co.jp,resources=intelligenthorizontalpodautoscalers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers/status,verbs=get
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=secrets/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=*,resources=*/scale,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
 
 func (r *IntelligentHorizontalPodAutoscalerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("intelligenthorizontalpodautoscaler", req.NamespacedName)
-	ihpaNamespacedName := req.NamespacedName.String()
 
 	// TODO: (low) fetch datadog key from env
 	// TODO: (low) determine sum/min/max/count/avg from IHPA property
 	// TODO: (low) consider selector of hpa object type
-	// TODO: (low) write any status to configmap
 
 	var ihpa ihpav1beta2.IntelligentHorizontalPodAutoscaler
 	if err := r.Get(ctx, req.NamespacedName, &ihpa); err != nil {
 		log.V(ResourceMessageLogLevel).Info("failed to fetch IntelligentHorizontalPodAutoscaler", "error_message", err)
-		if apierrors.IsNotFound(err) {
-			log.V(LogicMessageLogLevel).Info("cleanup estimator", "target", ihpaNamespacedName)
-			delete(r.fittingJobMap, ihpaNamespacedName)
-		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	if _, ok := r.fittingJobMap[ihpaNamespacedName]; !ok {
-		r.fittingJobMap[ihpaNamespacedName] = make(map[string]struct{})
+
+	// * delete generated resources before the ihpa is deleted
+	if !ihpa.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, log, &ihpa)
+	}
+	if !containsString(ihpa.GetFinalizers(), cleanupFinalizer) {
+		ihpa.SetFinalizers(append(ihpa.GetFinalizers(), cleanupFinalizer))
+		if err := r.Update(ctx, &ihpa); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to add finalizer: %w", err)
+		}
+		log.V(ResourceMessageLogLevel).Info("successed to add finalizer", "finalizer", cleanupFinalizer)
+	}
+
+	children, reconcileErr := r.reconcileChildren(ctx, log, &ihpa)
+	if err := r.updateStatus(ctx, &ihpa, children, reconcileErr); err != nil {
+		if reconcileErr == nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update ihpa status: %w", err)
+		}
+		log.V(ResourceMessageLogLevel).Info("failed to update ihpa status", "error_message", err)
+	}
+	if reconcileErr != nil {
+		return ctrl.Result{}, reconcileErr
+	}
+
+	// the status is refreshed by events of the children, except changes caused by the passage of time
+	return ctrl.Result{RequeueAfter: statusRequeueAfter(&ihpa.Status, children, time.Now())}, nil
+}
+
+// cachedClient returns the client which reads unstructured objects from the informer cache.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) cachedClient() client.Client {
+	if r.CacheReader == nil {
+		return r.Client
 	}
+	return &client.DelegatingClient{Reader: r.CacheReader, Writer: r.Client, StatusClient: r.Client}
+}
+
+// reconcileChildren creates/updates/deletes resources generated from the IHPA.
+// The names of generated resources are returned even if an error occurred on the way.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) reconcileChildren(
+	ctx context.Context,
+	log logr.Logger,
+	ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler,
+) (*ihpaChildren, error) {
+	children := &ihpaChildren{}
+	keep := make(ihpaChildSet)
 
-	g, err := NewIntelligentHorizontalPodAutoscalerGenerator(&ihpa, r, ctx)
+	g, err := NewIntelligentHorizontalPodAutoscalerGenerator(ihpa, r, ctx)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to create ihpa manager: %w", err)
+		return children, fmt.Errorf("failed to create ihpa manager: %w", err)
 	}
 
 	// * create/update hpa resource
 	hpaResource, err := g.HorizontalPodAutoscalerResource()
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to generate hpa resource: %w", err)
-	}
-	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: hpaResource.GetNamespace(), Name: hpaResource.GetName()}, hpa); apierrors.IsNotFound(err) {
-		log.V(ResourceMessageLogLevel).Info("initialize hpa", "name", hpaResource.GetName())
-		hpa = hpaResource.DeepCopy()
-		if err := r.Create(ctx, hpa); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create hpa: %w", err)
+		return children, fmt.Errorf("failed to generate hpa resource: %w", err)
+	}
+	// hpa is handled as unstructured to generate the version served by the cluster
+	desiredHPA, err := newUnstructuredHPA(hpaResource, ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Behavior, r.HPAAPIVersion)
+	if err != nil {
+		return children, fmt.Errorf("failed to generate hpa resource: %w", err)
+	}
+	hpa := &unstructured.Unstructured{}
+	hpa.SetGroupVersionKind(desiredHPA.GroupVersionKind())
+	getErr := r.cachedClient().Get(ctx, types.NamespacedName{Namespace: hpaResource.GetNamespace(), Name: hpaResource.GetName()}, hpa)
+	now := time.Now()
+	// minReplicas is moved ahead of forecasted load in floor mode
+	if ihpa.Spec.EstimatorPatchSpec.Mode == string(FloorMode) && !ihpa.Spec.Shadow && !ihpa.Spec.Paused {
+		current := int32(1)
+		if hpaResource.Spec.MinReplicas != nil {
+			current = *hpaResource.Spec.MinReplicas
+		}
+		if getErr == nil {
+			if v, found, _ := unstructured.NestedInt64(hpa.Object, "spec", "minReplicas"); found {
+				current = int32(v)
+			}
+		}
+		minReplicas, err := r.floorMinReplicas(ihpa, g, current, now)
+		if err != nil {
+			return children, fmt.Errorf("failed to calculate minReplicas from forecast: %w", err)
+		}
+		if err := unstructured.SetNestedField(desiredHPA.Object, int64(minReplicas), "spec", "minReplicas"); err != nil {
+			return children, fmt.Errorf("failed to set minReplicas of hpa: %w", err)
+		}
+		if minReplicas != current {
+			log.V(LogicMessageLogLevel).Info("minReplicas is changed by forecast", "name", hpaResource.GetName(), "from", current, "to", minReplicas)
+		}
+	}
+	// minReplicas is raised in windows of scheduled overrides unless paused
+	overrides, err := newScheduledOverrides(ihpa.Spec.ScheduledOverrides)
+	if err != nil {
+		return children, fmt.Errorf("failed to parse scheduled overrides: %w", err)
+	}
+	var activeOverrides []*scheduledOverride
+	if !ihpa.Spec.Paused {
+		activeOverrides = activeScheduledOverrides(overrides, now)
+		children.nextOverrideTransition = nextScheduledOverrideTransition(overrides, now)
+	}
+	for _, o := range activeOverrides {
+		children.activeOverrides = append(children.activeOverrides, o.Name)
+	}
+	if overrideMin := overrideMinReplicas(activeOverrides); overrideMin > 0 {
+		minReplicas := int64(1)
+		if v, found, _ := unstructured.NestedInt64(desiredHPA.Object, "spec", "minReplicas"); found {
+			minReplicas = v
 		}
-	} else {
-		hpa.Spec = hpaResource.DeepCopy().Spec
-		if err := r.Update(ctx, hpa); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to update hpa: %w", err)
+		if overrideMin > hpaResource.Spec.MaxReplicas {
+			overrideMin = hpaResource.Spec.MaxReplicas
+		}
+		if int64(overrideMin) > minReplicas {
+			if err := unstructured.SetNestedField(desiredHPA.Object, int64(overrideMin), "spec", "minReplicas"); err != nil {
+				return children, fmt.Errorf("failed to set minReplicas of hpa: %w", err)
+			}
+			log.V(LogicMessageLogLevel).Info("minReplicas is raised by scheduled overrides", "name", hpaResource.GetName(),
+				"overrides", children.activeOverrides, "minReplicas", overrideMin)
 		}
 	}
-	log.V(ResourceMessageLogLevel).Info("successed to create/update hpa", "kind", hpa.GetObjectKind().GroupVersionKind(), "name", hpa.GetName())
 
-	// * create rbac resources
-	saResource, roleResource, roleBindingResource, err := g.RBACResources()
+	if getErr != nil && !apierrors.IsNotFound(getErr) {
+		return children, fmt.Errorf("failed to get hpa: %w", getErr)
+	}
+	hpa = desiredHPA
+	result, err := applyChild(ctx, r.cachedClient(), r.Scheme, hpa)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to generate rbac resource: %w", err)
-	}
-	sa := &corev1.ServiceAccount{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: saResource.GetNamespace(), Name: saResource.GetName()}, sa); apierrors.IsNotFound(err) {
-		log.V(ResourceMessageLogLevel).Info("initialize serviceAccount", "name", saResource.GetName())
-		sa = saResource.DeepCopy()
-		if err := r.Create(ctx, sa); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create serviceAccount: %w", err)
-		}
+		return children, fmt.Errorf("failed to apply hpa: %w", err)
 	}
-	role := &rbacv1.Role{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: roleResource.GetNamespace(), Name: roleResource.GetName()}, role); apierrors.IsNotFound(err) {
-		log.V(ResourceMessageLogLevel).Info("initialize role", "name", roleResource.GetName())
-		role = roleResource.DeepCopy()
-		if err := r.Create(ctx, role); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create role: %w", err)
+	switch result {
+	case ctrlutil.OperationResultCreated:
+		r.recordEvent(ihpa, corev1.EventTypeNormal, EventReasonHPACreated, "Created HorizontalPodAutoscaler %s", hpa.GetName())
+	case ctrlutil.OperationResultUpdated:
+		minReplicas, _, _ := unstructured.NestedInt64(hpa.Object, "spec", "minReplicas")
+		r.recordEvent(ihpa, corev1.EventTypeNormal, EventReasonHPAUpdated, "Updated HorizontalPodAutoscaler %s (minReplicas=%d)", hpa.GetName(), minReplicas)
+	}
+	log.V(ResourceMessageLogLevel).Info("successed to create/update hpa", "kind", hpa.GetObjectKind().GroupVersionKind(), "name", hpa.GetName(), "result", result)
+	children.hpaName = hpa.GetName()
+	keep.add(hpaKind, hpa.GetName())
+
+	// * compare forecast with the hpa in shadow mode
+	if ihpa.Spec.Shadow && !ihpa.Spec.Paused {
+		shadow, err := r.shadowStatus(g, hpa, now)
+		if err != nil {
+			return children, fmt.Errorf("failed to calculate replicas recommended by forecast: %w", err)
 		}
+		children.shadow = shadow
+		recordShadowMetrics(ihpa.GetNamespace(), ihpa.GetName(), shadow)
+	} else {
+		deleteShadowMetrics(ihpa.GetNamespace(), ihpa.GetName())
+	}
+
+	// * create rbac resources
+	saResource, roleResource, roleBindingResource, err := g.RBACResources()
+	if err != nil {
+		return children, fmt.Errorf("failed to generate rbac resource: %w", err)
 	}
-	roleBinding := &rbacv1.RoleBinding{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: roleBindingResource.GetNamespace(), Name: roleBindingResource.GetName()}, roleBinding); apierrors.IsNotFound(err) {
-		log.V(ResourceMessageLogLevel).Info("initialize roleBinding", "name", roleBindingResource.GetName())
-		roleBinding = roleBindingResource.DeepCopy()
-		if err := r.Create(ctx, roleBinding); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create roleBinding: %w", err)
+	for _, obj := range []runtime.Object{saResource, roleResource, roleBindingResource} {
+		if _, err := applyChild(ctx, r, r.Scheme, obj); err != nil {
+			return children, fmt.Errorf("failed to apply rbac resource: %w", err)
 		}
 	}
+	keep.add(serviceAccountKind, saResource.GetName())
+	keep.add(roleKind, roleResource.GetName())
+	keep.add(roleBindingKind, roleBindingResource.GetName())
 
 	// * create fittingjob resources
 	fittingJobResources, err := g.FittingJobResources()
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to generate fittingjob resources: %w", err)
+		return children, fmt.Errorf("failed to generate fittingjob resources: %w", err)
 	}
 	for _, fjResource := range fittingJobResources {
-		fj := &ihpav1beta2.FittingJob{}
-		if err := r.Get(ctx, types.NamespacedName{Namespace: fjResource.GetNamespace(), Name: fjResource.GetName()}, fj); apierrors.IsNotFound(err) {
-			log.V(ResourceMessageLogLevel).Info("initialize fittingjob", "name", fjResource.GetName())
-			fj = fjResource.DeepCopy()
-			if err := r.Create(ctx, fj); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to create fittingjob: %w", err)
-			}
-		} else {
-			fj.Spec = fjResource.DeepCopy().Spec
-			if err := r.Update(ctx, fj); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to update fittingjob: %w", err)
-			}
+		fj := fjResource.DeepCopy()
+		result, err := applyChild(ctx, r, r.Scheme, fj)
+		if err != nil {
+			return children, fmt.Errorf("failed to apply fittingjob: %w", err)
+		}
+		if result == ctrlutil.OperationResultCreated {
+			r.recordEvent(ihpa, corev1.EventTypeNormal, EventReasonFittingJobCreated, "Created FittingJob %s", fj.GetName())
 		}
-		log.V(ResourceMessageLogLevel).Info("successed to create/update fittingjob", "kind", fj.GetObjectKind().GroupVersionKind(), "name", fj.GetName())
+		log.V(ResourceMessageLogLevel).Info("successed to create/update fittingjob", "kind", fj.GetObjectKind().GroupVersionKind(), "name", fj.GetName(), "result", result)
+		keep.add(fittingJobKind, fj.GetName())
+	}
+	// a new value of the trigger is propagated to the fittingjobs once
+	if trigger := ihpa.GetAnnotations()[triggerAnnotation]; trigger != "" && trigger != ihpa.Status.LastTrigger {
+		if err := r.propagateTrigger(ctx, trigger, fittingJobResources); err != nil {
+			return children, err
+		}
+		log.V(LogicMessageLogLevel).Info("trigger is propagated to fittingjobs", "trigger", trigger)
+		children.trigger = trigger
 	}
 
 	// * create estimator resources
 	estimatorResources, err := g.EstimatorResources()
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to generate estimator resources: %w", err)
+		return children, fmt.Errorf("failed to generate estimator resources: %w", err)
+	}
+	for i, metric := range ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics {
+		metricName, _ := extractScopedMetricInfo(metric.MetricSpec())
+		children.metrics = append(children.metrics, ihpaMetricChildren{
+			metricName:     metricName,
+			fittingJobName: fittingJobResources[i].GetName(),
+			estimatorName:  estimatorResources[i].GetName(),
+		})
 	}
 	for _, estResource := range estimatorResources {
-		est := &ihpav1beta2.Estimator{}
-		if err := r.Get(ctx, types.NamespacedName{Namespace: estResource.GetNamespace(), Name: estResource.GetName()}, est); apierrors.IsNotFound(err) {
-			log.V(ResourceMessageLogLevel).Info("initialize estimator", "name", estResource.GetName())
-			est = estResource.DeepCopy()
-			if err := r.Create(ctx, est); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to create estimator: %w", err)
-			}
-		} else {
-			est.Spec = estResource.DeepCopy().Spec
-			if err := r.Update(ctx, est); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to update estimator: %w", err)
-			}
+		est := estResource.DeepCopy()
+		result, err := applyChild(ctx, r, r.Scheme, est)
+		if err != nil {
+			return children, fmt.Errorf("failed to apply estimator: %w", err)
 		}
-		log.V(ResourceMessageLogLevel).Info("successed to create/update estimator", "kind", est.GetObjectKind().GroupVersionKind(), "name", est.GetName())
+		if result == ctrlutil.OperationResultCreated {
+			r.recordEvent(ihpa, corev1.EventTypeNormal, EventReasonEstimatorCreated, "Created Estimator %s", est.GetName())
+		}
+		log.V(ResourceMessageLogLevel).Info("successed to create/update estimator", "kind", est.GetObjectKind().GroupVersionKind(), "name", est.GetName(), "result", result)
+		keep.add(estimatorKind, est.GetName())
+		keep.add(configMapKind, est.Spec.DataConfigMap.Name)
 	}
 
-	// * get all fittingjob id related to this ihpa
-	currentIds := make(map[string]struct{}, len(fittingJobResources))
-	for _, fj := range fittingJobResources {
-		id, ok := fj.GetAnnotations()[fittingJobIDAnnotation]
-		if !ok {
-			continue
+	// * delete resources which are no longer generated (e.g. removed metrics)
+	// generated resources are changed only by the spec, so they are checked only once for each generation
+	if ihpa.Status.ObservedGeneration != ihpa.GetGeneration() {
+		if err := r.deleteChildren(ctx, log, ihpa, keep, "it is no longer generated from the spec"); err != nil {
+			return children, err
 		}
-		currentIds[id] = struct{}{}
-		r.fittingJobMap[ihpaNamespacedName][id] = struct{}{}
 	}
 
-	annotations := ihpa.GetAnnotations()
-	if annotations == nil {
-		annotations = make(map[string]string)
-	}
+	return children, nil
+}
 
-	// * delete fittingjob and estimator
-	if fjIdsStr, ok := annotations[fittingJobIDsAnnotation]; ok {
-		previousIds := strings.Split(fjIdsStr, ",")
-		deleteIds := make(map[string]struct{}, len(previousIds))
-		for _, id := range previousIds {
-			if _, ok := currentIds[id]; !ok {
-				deleteIds[id] = struct{}{}
+// updateStatus aggregates the state of the children and updates IHPA status if it is changed.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) updateStatus(
+	ctx context.Context,
+	ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler,
+	children *ihpaChildren,
+	reconcileErr error,
+) error {
+	src := &ihpaStatusSource{
+		children:        children,
+		paused:          ihpa.Spec.Paused,
+		pausedReason:    ihpa.Spec.PausedReason,
+		snapshots:       make(map[string]ForecastSnapshot, len(children.metrics)),
+		fittingFailures: make(map[string]string),
+		reconcileErr:    reconcileErr,
+	}
+	fittingJobs := make(map[string]*ihpav1beta2.FittingJobStatus, len(children.metrics))
+	for _, m := range children.metrics {
+		if r.ForecastSnapshots != nil {
+			id := types.NamespacedName{Namespace: ihpa.GetNamespace(), Name: m.estimatorName}.String()
+			if snapshot, ok := r.ForecastSnapshots.Get(id); ok {
+				src.snapshots[m.estimatorName] = snapshot
 			}
 		}
-
-		var fjs ihpav1beta2.FittingJobList
-		if err := r.List(ctx, &fjs); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to get list of fittingjobs: %w", err)
+		// the name of cronjob is same as fittingjob
+		msg, err := latestJobFailure(ctx, r, ihpa.GetNamespace(), m.fittingJobName)
+		if err != nil {
+			return err
 		}
-		for _, fj := range fjs.Items {
-			if id, ok := fj.GetAnnotations()[fittingJobIDAnnotation]; ok {
-				if _, ok := deleteIds[id]; ok {
-					if err := r.Delete(ctx, &fj); err != nil {
-						return ctrl.Result{}, fmt.Errorf("failed to delete fittingjob: %w", err)
-					}
-					log.V(ResourceMessageLogLevel).Info("successed to delete fitting job", "kind", fj.GetObjectKind(), "name", fj.GetName(), "id", id)
-				}
-			}
+		if msg != "" {
+			src.fittingFailures[m.fittingJobName] = msg
 		}
-
-		var ests ihpav1beta2.EstimatorList
-		if err := r.List(ctx, &ests); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to get list of estimators: %w", err)
-		}
-		for _, est := range ests.Items {
-			if id, ok := est.GetAnnotations()[fittingJobIDAnnotation]; ok {
-				if _, ok := deleteIds[id]; ok {
-					if err := r.Delete(ctx, &est); err != nil {
-						return ctrl.Result{}, fmt.Errorf("failed to delete estimator: %w", err)
-					}
-					log.V(ResourceMessageLogLevel).Info("successed to delete estimator", "kind", est.GetObjectKind(), "name", est.GetName(), "id", id)
-				}
+		fj := &ihpav1beta2.FittingJob{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: ihpa.GetNamespace(), Name: m.fittingJobName}, fj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
 			}
+			return err
 		}
-
-		// unregister from estimator
-		for id, _ := range deleteIds {
-			delete(r.fittingJobMap[ihpaNamespacedName], id)
-		}
+		fittingJobs[m.fittingJobName] = &fj.Status
 	}
 
-	// * update fittingjob ids annotation
-	var fjIdsStr string
-	for k, _ := range currentIds {
-		fjIdsStr += k + ","
+	now := time.Now()
+	recordIHPAMetrics(ihpa, src, fittingJobs, now)
+	status := buildIHPAStatus(&ihpa.Status, src, ihpa.GetGeneration(), now)
+	if equality.Semantic.DeepEqual(&ihpa.Status, status) {
+		return nil
+	}
+	transitions := conditionTransitions(&ihpa.Status, status)
+	ihpa.Status = *status
+	if err := r.Status().Update(ctx, ihpa); err != nil {
+		return err
 	}
-	fjIdsStr = strings.TrimRight(fjIdsStr, ",")
-	annotations[fittingJobIDsAnnotation] = fjIdsStr
-	ihpa.SetAnnotations(annotations)
-	if err := r.Update(ctx, &ihpa); err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to update ihpa resource: %w", err)
+	for i := range transitions {
+		cond := &transitions[i]
+		r.recordEvent(ihpa, conditionEventType(cond), cond.Reason, "%s condition changed to %s: %s", cond.Type, cond.Status, cond.Message)
 	}
-	log.V(ResourceMessageLogLevel).Info("successed to apply annotation", fittingJobIDsAnnotation, fjIdsStr)
+	return nil
+}
 
-	return ctrl.Result{}, nil
+// recordEvent records an event on the IHPA if the recorder is given.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) recordEvent(
+	ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler,
+	eventtype, reason, messageFmt string,
+	args ...interface{},
+) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(ihpa, eventtype, reason, messageFmt, args...)
+	}
 }
 
 func (r *IntelligentHorizontalPodAutoscalerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	r.fittingJobMap = make(map[string]map[string]struct{})
-
+	// the status is aggregated from the generated resources
+	toIHPA := &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(ihpaForGeneratedResource)}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ihpav1beta2.IntelligentHorizontalPodAutoscaler{}).
+		WithEventFilter(hpaChangedPredicate).
+		Watches(&source.Kind{Type: newHPAObject(r.HPAAPIVersion)}, toIHPA).
+		Watches(&source.Kind{Type: &ihpav1beta2.FittingJob{}}, toIHPA).
+		Watches(&source.Kind{Type: &ihpav1beta2.Estimator{}}, toIHPA).
 		Complete(r)
 }
+
+// ihpaForGeneratedResource returns a request of the IHPA which the resource is generated from.
+func ihpaForGeneratedResource(obj handler.MapObject) []reconcile.Request {
+	name, ok := obj.Meta.GetLabels()[ihpaNameLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.Meta.GetNamespace(), Name: name}}}
+}
+
+// hpaChangedPredicate ignores updates of HPA which change neither the spec nor desiredReplicas.
+// The status of HPA is updated at every sync of kube-controller-manager, but only desiredReplicas is used.
+// Events of other kinds are passed.
+var hpaChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldHPA, ok := e.ObjectOld.(*unstructured.Unstructured)
+		if !ok || oldHPA.GetKind() != hpaKind {
+			return true
+		}
+		newHPA, ok := e.ObjectNew.(*unstructured.Unstructured)
+		if !ok {
+			return true
+		}
+		if oldHPA.GetGeneration() != newHPA.GetGeneration() {
+			return true
+		}
+		oldDesired, _, _ := unstructured.NestedInt64(oldHPA.Object, "status", "desiredReplicas")
+		newDesired, _, _ := unstructured.NestedInt64(newHPA.Object, "status", "desiredReplicas")
+		return oldDesired != newDesired
+	},
+}
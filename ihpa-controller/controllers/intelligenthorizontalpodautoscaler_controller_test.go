@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+func TestHPAChangedPredicate(t *testing.T) {
+	hpa := func(generation, desiredReplicas int64, currentCPU string) *unstructured.Unstructured {
+		u := newHPAObject(HPAAPIVersionV2)
+		u.SetGeneration(generation)
+		_ = unstructured.SetNestedField(u.Object, desiredReplicas, "status", "desiredReplicas")
+		_ = unstructured.SetNestedField(u.Object, currentCPU, "status", "currentCPU")
+		return u
+	}
+
+	tests := []struct {
+		old, new *unstructured.Unstructured
+		expected bool
+	}{
+		{old: hpa(1, 3, "10"), new: hpa(1, 3, "20"), expected: false},
+		{old: hpa(1, 3, "10"), new: hpa(1, 4, "20"), expected: true},
+		{old: hpa(1, 3, "10"), new: hpa(2, 3, "10"), expected: true},
+	}
+
+	for _, tt := range tests {
+		e := event.UpdateEvent{MetaOld: tt.old, ObjectOld: tt.old, MetaNew: tt.new, ObjectNew: tt.new}
+		if got := hpaChangedPredicate.Update(e); got != tt.expected {
+			t.Fatalf("result of predicate is not match (got=%v, exp=%v)", got, tt.expected)
+		}
+	}
+}
+
+func TestIHPAForGeneratedResource(t *testing.T) {
+	labeled := &metav1.ObjectMeta{Name: "ihpa-nginx-cpu", Namespace: "default", Labels: map[string]string{ihpaNameLabel: "nginx"}}
+	reqs := ihpaForGeneratedResource(handler.MapObject{Meta: labeled})
+	if len(reqs) != 1 || reqs[0].Namespace != "default" || reqs[0].Name != "nginx" {
+		t.Fatalf("requests are not match (got=%v, exp=%s)", reqs, "default/nginx")
+	}
+
+	unlabeled := &metav1.ObjectMeta{Name: "nginx", Namespace: "default"}
+	if reqs := ihpaForGeneratedResource(handler.MapObject{Meta: unlabeled}); len(reqs) != 0 {
+		t.Fatalf("requests are not match (got=%v, exp=none)", reqs)
+	}
+}
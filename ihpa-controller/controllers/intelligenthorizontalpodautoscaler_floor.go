@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"math"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// floorMinReplicas returns minReplicas of the HPA in floor mode.
+// Replicas recommended by forecasted metrics are used, and minReplicas goes back to the one of
+// the IHPA when no forecast is available.
+// The result is bounded by minReplicas/maxReplicas of the IHPA and FloorMaxStep from current.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) floorMinReplicas(
+	ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler,
+	g IntelligentHorizontalPodAutoscalerGenerator,
+	current int32,
+	now time.Time,
+) (int32, error) {
+	spec := &ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec
+	min := int32(1)
+	if spec.MinReplicas != nil {
+		min = *spec.MinReplicas
+	}
+
+	desired := min
+	recommended, ok, err := r.forecastRecommendedReplicas(g, now)
+	if err != nil {
+		return 0, err
+	}
+	if ok && recommended > desired {
+		desired = recommended
+	}
+
+	return boundFloorReplicas(desired, current, min, spec.MaxReplicas, ihpa.Spec.EstimatorPatchSpec.FloorMaxStep), nil
+}
+
+// forecastRecommendedReplicas returns replicas recommended by forecasted metrics.
+// The adjusted forecasted value of each metric is converted into replicas by its target value,
+// and the largest one is returned. Metrics whose forecast is not available are ignored, and
+// this returns false if no forecast is available.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) forecastRecommendedReplicas(
+	g IntelligentHorizontalPodAutoscalerGenerator,
+	now time.Time,
+) (int32, bool, error) {
+	if r.ForecastSnapshots == nil {
+		return 0, false, nil
+	}
+	targets, err := g.ForecastTargetValues()
+	if err != nil {
+		return 0, false, err
+	}
+	estimators, err := g.EstimatorResources()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var recommended int32
+	found := false
+	for i, est := range estimators {
+		id := types.NamespacedName{Namespace: est.GetNamespace(), Name: est.GetName()}.String()
+		snapshot, ok := r.ForecastSnapshots.Get(id)
+		if !ok || !snapshot.ProviderAccessed || snapshot.HorizonEnd.Before(now) {
+			continue
+		}
+		found = true
+		if replicas := forecastReplicas(snapshot.AdjustedValue, &targets[i]); replicas > recommended {
+			recommended = replicas
+		}
+	}
+	return recommended, found, nil
+}
+
+// forecastReplicas returns the number of replicas required for the forecasted value.
+// The forecasted value is the total of all replicas, and the target is the average value per replica.
+func forecastReplicas(forecast float64, target *resource.Quantity) int32 {
+	t := float64(target.MilliValue()) / 1000
+	if t <= 0 || forecast <= 0 {
+		return 0
+	}
+	replicas := math.Ceil(forecast / t)
+	if replicas > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(replicas)
+}
+
+// boundFloorReplicas bounds desired by step from current, and then by min and max.
+// step is ignored if it is zero.
+func boundFloorReplicas(desired, current, min, max, step int32) int32 {
+	if step > 0 {
+		if desired > current+step {
+			desired = current + step
+		} else if desired < current-step {
+			desired = current - step
+		}
+	}
+	if desired < min {
+		desired = min
+	}
+	if desired > max {
+		desired = max
+	}
+	return desired
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// floorTestGenerator returns fixed estimators and target values.
+type floorTestGenerator struct {
+	IntelligentHorizontalPodAutoscalerGenerator
+	estimators []*ihpav1beta2.Estimator
+	targets    []resource.Quantity
+}
+
+func (g *floorTestGenerator) ForecastTargetValues() ([]resource.Quantity, error) {
+	return g.targets, nil
+}
+
+func (g *floorTestGenerator) EstimatorResources() ([]*ihpav1beta2.Estimator, error) {
+	return g.estimators, nil
+}
+
+func TestForecastReplicas(t *testing.T) {
+	tests := []struct {
+		forecast float64
+		target   resource.Quantity
+		expected int32
+	}{
+		{forecast: 100, target: resource.MustParse("10"), expected: 10},
+		{forecast: 101, target: resource.MustParse("10"), expected: 11},
+		{forecast: 1.5, target: resource.MustParse("500m"), expected: 3},
+		{forecast: 0, target: resource.MustParse("10"), expected: 0},
+		{forecast: 100, target: resource.MustParse("0"), expected: 0},
+	}
+
+	for _, tt := range tests {
+		if got := forecastReplicas(tt.forecast, &tt.target); got != tt.expected {
+			t.Fatalf("replicas is not match (got=%d, exp=%d)", got, tt.expected)
+		}
+	}
+}
+
+func TestBoundFloorReplicas(t *testing.T) {
+	tests := []struct {
+		desired, current, min, max, step int32
+		expected                         int32
+	}{
+		{desired: 8, current: 2, min: 1, max: 10, step: 0, expected: 8},
+		{desired: 8, current: 2, min: 1, max: 10, step: 3, expected: 5},
+		{desired: 1, current: 8, min: 1, max: 10, step: 3, expected: 5},
+		{desired: 20, current: 2, min: 1, max: 10, step: 0, expected: 10},
+		{desired: 1, current: 2, min: 3, max: 10, step: 0, expected: 3},
+		// current is out of range after the ihpa is changed
+		{desired: 3, current: 20, min: 1, max: 10, step: 3, expected: 10},
+	}
+
+	for _, tt := range tests {
+		if got := boundFloorReplicas(tt.desired, tt.current, tt.min, tt.max, tt.step); got != tt.expected {
+			t.Fatalf("replicas is not match (got=%d, exp=%d, case=%+v)", got, tt.expected, tt)
+		}
+	}
+}
+
+func TestFloorMinReplicas(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := NewForecastSnapshotStore()
+	snapshots.Update("default/cpu", func(s *ForecastSnapshot) {
+		s.ProviderAccessed = true
+		s.AdjustedValue = 350
+		s.HorizonEnd = now.Add(time.Hour)
+	})
+	snapshots.Update("default/requests", func(s *ForecastSnapshot) {
+		s.ProviderAccessed = true
+		s.AdjustedValue = 600
+		s.HorizonEnd = now.Add(time.Hour)
+	})
+	snapshots.Update("default/expired", func(s *ForecastSnapshot) {
+		s.ProviderAccessed = true
+		s.AdjustedValue = 10000
+		s.HorizonEnd = now.Add(-time.Hour)
+	})
+	r := &IntelligentHorizontalPodAutoscalerReconciler{ForecastSnapshots: snapshots}
+
+	estimator := func(name string) *ihpav1beta2.Estimator {
+		return &ihpav1beta2.Estimator{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	}
+	ihpa := func(step int32) *ihpav1beta2.IntelligentHorizontalPodAutoscaler {
+		ihpa := &ihpav1beta2.IntelligentHorizontalPodAutoscaler{}
+		ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.MinReplicas = func(i int32) *int32 { return &i }(2)
+		ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.MaxReplicas = 10
+		ihpa.Spec.EstimatorPatchSpec = ihpav1beta2.EstimatorPatchSpec{Mode: "floor", FloorMaxStep: step}
+		return ihpa
+	}
+
+	tests := []struct {
+		ihpa       *ihpav1beta2.IntelligentHorizontalPodAutoscaler
+		estimators []*ihpav1beta2.Estimator
+		current    int32
+		expected   int32
+	}{
+		{
+			// the largest replicas in metrics
+			ihpa:       ihpa(0),
+			estimators: []*ihpav1beta2.Estimator{estimator("cpu"), estimator("requests")},
+			current:    2,
+			expected:   6,
+		},
+		{
+			ihpa:       ihpa(2),
+			estimators: []*ihpav1beta2.Estimator{estimator("cpu"), estimator("requests")},
+			current:    2,
+			expected:   4,
+		},
+		{
+			// expired or unknown forecast is ignored
+			ihpa:       ihpa(0),
+			estimators: []*ihpav1beta2.Estimator{estimator("expired"), estimator("unknown")},
+			current:    6,
+			expected:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		g := &floorTestGenerator{
+			estimators: tt.estimators,
+			targets:    []resource.Quantity{resource.MustParse("100"), resource.MustParse("100")},
+		}
+		got, err := r.floorMinReplicas(tt.ihpa, g, tt.current, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Fatalf("minReplicas is not match (got=%d, exp=%d)", got, tt.expected)
+		}
+	}
+}
@@ -5,12 +5,16 @@ import (
 	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 type IntelligentHorizontalPodAutoscalerGenerator interface {
 	// HorizontalPodAutoscalerResource generate a HPA (v2beta2.autoscaling) struct
 	// that added some forecast metric fields.
 	HorizontalPodAutoscalerResource() (*autoscalingv2beta2.HorizontalPodAutoscaler, error)
+	// ForecastTargetValues returns the target average value of forecasted metric of every metric fields.
+	// Forecasted metric divided by the value is the number of replicas required for the forecast.
+	ForecastTargetValues() ([]resource.Quantity, error)
 	// FittingJobResources generate an array of FittingJob struct
 	// that generated every metric fields.
 	FittingJobResources() ([]*ihpav1beta2.FittingJob, error)
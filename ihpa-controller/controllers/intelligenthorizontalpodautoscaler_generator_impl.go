@@ -6,12 +6,13 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"strings"
 
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider"
 	mpconfig "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider/config"
-	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -39,27 +40,9 @@ func NewIntelligentHorizontalPodAutoscalerGenerator(
 		return nil, err
 	}
 
-	var containers []corev1.Container
-	scaleTarget := ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.ScaleTargetRef
-	switch scaleTarget.Kind {
-	case "Deployment":
-		deployment := &appsv1.Deployment{}
-		if err := r.Get(ctx, amtypes.NamespacedName{Namespace: ihpa.GetNamespace(), Name: scaleTarget.Name}, deployment); err != nil {
-			return nil, err
-		}
-		containers = deployment.Spec.Template.Spec.Containers
-	case "StatefulSet":
-		statefulset := &appsv1.StatefulSet{}
-		if err := r.Get(ctx, amtypes.NamespacedName{Namespace: ihpa.GetNamespace(), Name: scaleTarget.Name}, statefulset); err != nil {
-			return nil, err
-		}
-		containers = statefulset.Spec.Template.Spec.Containers
-	case "ReplicaSet":
-		replicaset := &appsv1.ReplicaSet{}
-		if err := r.Get(ctx, amtypes.NamespacedName{Namespace: ihpa.GetNamespace(), Name: scaleTarget.Name}, replicaset); err != nil {
-			return nil, err
-		}
-		containers = replicaset.Spec.Template.Spec.Containers
+	containers, err := r.scaleTargetContainers(ctx, ihpa.GetNamespace(), &ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.ScaleTargetRef)
+	if err != nil {
+		return nil, err
 	}
 	rl := *totalResourceList(containers)
 
@@ -87,7 +70,10 @@ func (g *ihpaGeneratorImpl) HorizontalPodAutoscalerResource() (*autoscalingv2bet
 		}
 		forecastedMetrics[i] = *f
 	}
-	metrics = append(metrics, forecastedMetrics...)
+	// forecasted metrics are reflected on minReplicas in floor mode, and not applied in shadow mode or while paused
+	if g.ihpa.Spec.EstimatorPatchSpec.Mode != string(FloorMode) && !g.ihpa.Spec.Shadow && !g.ihpa.Spec.Paused {
+		metrics = append(metrics, forecastedMetrics...)
+	}
 
 	hpa.Spec = autoscalingv2beta2.HorizontalPodAutoscalerSpec{
 		ScaleTargetRef: *g.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.ScaleTargetRef.DeepCopy(),
@@ -97,10 +83,25 @@ func (g *ihpaGeneratorImpl) HorizontalPodAutoscalerResource() (*autoscalingv2bet
 	}
 
 	addOwnerReference(&(g.ihpa.TypeMeta), &(g.ihpa.ObjectMeta), &hpa)
+	addIHPALabel(g.ihpa.GetName(), &hpa)
 
 	return &hpa, nil
 }
 
+// ForecastTargetValues returns the target average value of forecasted metric of every metric fields.
+func (g *ihpaGeneratorImpl) ForecastTargetValues() ([]resource.Quantity, error) {
+	extendedMetrics := g.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics
+	targets := make([]resource.Quantity, len(extendedMetrics))
+	for i := range extendedMetrics {
+		f, err := g.generateForecastedMetricSpec(extendedMetrics[i].MetricSpec())
+		if err != nil {
+			return nil, err
+		}
+		targets[i] = f.External.Target.AverageValue.DeepCopy()
+	}
+	return targets, nil
+}
+
 // generateForecastedMetricSpec returns external MetricSpec for forecasted value.
 func (g *ihpaGeneratorImpl) generateForecastedMetricSpec(metric *autoscalingv2beta2.MetricSpec) (*autoscalingv2beta2.MetricSpec, error) {
 	metricName, metricTarget := extractScopedMetricInfo(metric)
@@ -121,9 +122,10 @@ func (g *ihpaGeneratorImpl) generateForecastedMetricSpec(metric *autoscalingv2be
 	// we need whole value of this metric for calculation of utilization.
 	// Utilization is used by cpu, memory, storage and ephemeral-storage.
 	if metric.Type == "Resource" && metricTarget.Type == "Utilization" {
-		var avg int64
-
-		mp := mpconfig.ConvertMetricProvider(g.ihpa.Spec.MetricProvider.DeepCopy()).ActiveProvider()
+		mp, err := g.metricProvider()
+		if err != nil {
+			return nil, err
+		}
 		mi := mp.ConvertResourceMetricName(metricName, false)
 		if mi == nil {
 			return nil, fmt.Errorf("correspond metric name is not found (convert failed): %s", metricName)
@@ -153,17 +155,26 @@ func (g *ihpaGeneratorImpl) generateForecastedMetricSpec(metric *autoscalingv2be
 			//       so we must scale value to nanocore. HPA treat external metrics without unit.
 			//       Therefore HPA shows very big number, 9,000,000,000 **nanocores** in Datadog is
 			//       shown as 9,000,000,000 **cores**, even if Datadog dashboard shows that 9 millicore.
+			//       On the other hand, the unit of cAdvisor series in Prometheus is core (0),
+			//       so the value may be fractional and we keep it as milli value.
 			percentage := float64(*(metricTarget.AverageUtilization)) / 100.0
-			requestTotal := float64(qty.ScaledValue(resource.Scale(mi.GetScale() + scaleAdjust)))
-			avg = int64(requestTotal * percentage)
-			q.Set(avg)
+			requestTotal := float64(qty.Value()) * math.Pow10(-(mi.GetScale() + scaleAdjust))
+			avg := requestTotal * percentage
+			if avg == math.Trunc(avg) {
+				q.Set(int64(avg))
+			} else {
+				q.SetMilli(int64(math.Round(avg * 1000)))
+			}
 			avgValue = q.DeepCopy()
 		} else {
-			return nil, fmt.Errorf("cannot set %s as utilization, not found scaleTarget...containers.Resource.Requests", metricName)
+			scaleTarget := g.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.ScaleTargetRef
+			return nil, fmt.Errorf("cannot set %s as utilization, resource requests of %s %s are not found (no containers requesting it or no live pods)",
+				metricName, scaleTarget.Kind, scaleTarget.Name)
 		}
 		// clear utilization field
 		metricTarget.AverageUtilization = nil
-	} else if metric.Type == "External" {
+	} else if metric.Type == "External" || metric.Type == "Object" || metric.Type == "Pods" {
+		// Pods metric always has AverageValue target
 		switch metricTarget.Type {
 		case "AverageValue":
 			avgValue = metricTarget.AverageValue.DeepCopy()
@@ -231,6 +242,7 @@ func (g *ihpaGeneratorImpl) fittingJobResource(metric *ihpav1beta2.ExtendedMetri
 	fj.Spec.TargetMetric = *metricIdentifier
 	fj.Spec.DataConfigMap = corev1.LocalObjectReference{Name: g.configMapName(metric)}
 	fj.Spec.Provider = g.ihpa.Spec.MetricProvider
+	fj.Spec.Suspend = g.ihpa.Spec.Paused
 
 	if fj.Spec.ServiceAccountName == "" {
 		fj.Spec.ServiceAccountName = g.rbacName()
@@ -242,25 +254,60 @@ func (g *ihpaGeneratorImpl) fittingJobResource(metric *ihpav1beta2.ExtendedMetri
 	}
 
 	addOwnerReference(&(g.ihpa.TypeMeta), &(g.ihpa.ObjectMeta), &fj)
+	addIHPALabel(g.ihpa.GetName(), &fj)
 
 	return &fj, nil
 }
 
 // convertMetricSpecToIdentifier convert metric name to special name which is dedicated to metric provider.
-// Currently, Resource and External are supported only.
 // For example, "cpu" in Resource is convert to "kubernetes.cpu.usage.total" in Datadog.
 func (g *ihpaGeneratorImpl) convertMetricSpecToIdentifier(metric *autoscalingv2beta2.MetricSpec) (*autoscalingv2beta2.MetricIdentifier, error) {
+	if metric.Type == "External" {
+		if metric.External == nil {
+			return nil, fmt.Errorf("external is not specified for External metric")
+		}
+		return metric.External.Metric.DeepCopy(), nil
+	}
+
+	mp, err := g.metricProvider()
+	if err != nil {
+		return nil, err
+	}
 	metricIdentifier := &autoscalingv2beta2.MetricIdentifier{}
 	switch metric.Type {
 	case "Resource":
-		mp := mpconfig.ConvertMetricProvider(g.ihpa.Spec.MetricProvider.DeepCopy()).ActiveProvider()
+		if metric.Resource == nil {
+			return nil, fmt.Errorf("resource is not specified for Resource metric")
+		}
 		mi := mp.ConvertResourceMetricName(metric.Resource.Name.String(), false)
+		if mi == nil {
+			return nil, fmt.Errorf("%s is not supported as Resource metric by the metric provider", metric.Resource.Name)
+		}
 		filters := g.uniqueMetricFilters()
 
 		metricIdentifier.Name = mi.GetName()
 		metricIdentifier.Selector = &metav1.LabelSelector{MatchLabels: filters}
-	case "External":
-		metricIdentifier = metric.External.Metric.DeepCopy()
+	case "Pods":
+		if metric.Pods == nil {
+			return nil, fmt.Errorf("pods is not specified for Pods metric")
+		}
+		// Pods metric is aggregated over all pods of scale target
+		metricIdentifier = scopedMetricIdentifier(
+			&metric.Pods.Metric,
+			mp.ConvertPodsMetricName(metric.Pods.Metric.Name, false),
+			g.uniqueMetricFilters(),
+		)
+	case "Object":
+		if metric.Object == nil {
+			return nil, fmt.Errorf("object is not specified for Object metric")
+		}
+		// Object metric is scoped by the described object instead of scale target
+		described := metric.Object.DescribedObject
+		metricIdentifier = scopedMetricIdentifier(
+			&metric.Object.Metric,
+			mp.ConvertObjectMetricName(metric.Object.Metric.Name, false),
+			generateMetricUniqueFilter(g.kubeSystemUID, g.ihpa.GetNamespace(), described.Kind, described.Name),
+		)
 	default:
 		return nil, fmt.Errorf("%s metric is not supported yet.", metric.Type)
 	}
@@ -268,6 +315,15 @@ func (g *ihpaGeneratorImpl) convertMetricSpecToIdentifier(metric *autoscalingv2b
 	return metricIdentifier, nil
 }
 
+// metricProvider returns the metric provider specified in the IHPA.
+func (g *ihpaGeneratorImpl) metricProvider() (metricprovider.MetricProvider, error) {
+	mp := mpconfig.ConvertMetricProvider(g.ihpa.Spec.MetricProvider.DeepCopy()).ActiveProvider()
+	if mp == nil {
+		return nil, fmt.Errorf("metric provider is not specified")
+	}
+	return mp, nil
+}
+
 // EstimatorResources generate an array of Estimator struct
 func (g *ihpaGeneratorImpl) EstimatorResources() ([]*ihpav1beta2.Estimator, error) {
 	metrics := g.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics
@@ -304,25 +360,17 @@ func (g *ihpaGeneratorImpl) estimatorResource(metric *ihpav1beta2.ExtendedMetric
 	}
 	sort.Strings(tags)
 
-	// search base tags
+	// base tags are same as the filter of the metric used in FittingJob
 	var baseMetricTags []string
-	for _, metric := range g.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics {
-		if metric.Type != "External" {
-			continue
-		}
-		name, _ := extractScopedMetricInfo(metric.MetricSpec())
-		if name == metricIdentifier.Name {
-			m := metric.External.Metric.Selector.MatchLabels
-			baseMetricTags = make([]string, 0, len(m))
-			for k, v := range m {
-				baseMetricTags = append(baseMetricTags, k+":"+v)
-			}
-			sort.Strings(baseMetricTags)
-			break
+	if metricIdentifier.Selector != nil && metricIdentifier.Selector.MatchLabels != nil {
+		m := metricIdentifier.Selector.MatchLabels
+		baseMetricTags = make([]string, 0, len(m))
+		for k, v := range m {
+			baseMetricTags = append(baseMetricTags, k+":"+v)
 		}
+		sort.Strings(baseMetricTags)
 	}
 	if baseMetricTags == nil {
-		// tags of excepting External is generated by unique filter
 		baseMetricTags = tags
 	}
 
@@ -341,6 +389,13 @@ func (g *ihpaGeneratorImpl) estimatorResource(metric *ihpav1beta2.ExtendedMetric
 	spec.MetricTags = tags
 	spec.BaseMetricName = metricIdentifier.Name
 	spec.BaseMetricTags = baseMetricTags
+	// estimator uses only overrides which multiply forecasted values
+	for _, o := range g.ihpa.Spec.ScheduledOverrides {
+		if o.ForecastMultiplier != nil {
+			spec.ScheduledOverrides = append(spec.ScheduledOverrides, *o.DeepCopy())
+		}
+	}
+	spec.Paused = g.ihpa.Spec.Paused
 
 	est := ihpav1beta2.Estimator{
 		ObjectMeta: meta,
@@ -348,6 +403,7 @@ func (g *ihpaGeneratorImpl) estimatorResource(metric *ihpav1beta2.ExtendedMetric
 	}
 
 	addOwnerReference(&(g.ihpa.TypeMeta), &(g.ihpa.ObjectMeta), &est)
+	addIHPALabel(g.ihpa.GetName(), &est)
 
 	return &est, nil
 }
@@ -397,6 +453,9 @@ func (g *ihpaGeneratorImpl) RBACResources() (*corev1.ServiceAccount, *rbacv1.Rol
 	addOwnerReference(&(g.ihpa.TypeMeta), &(g.ihpa.ObjectMeta), &sa)
 	addOwnerReference(&(g.ihpa.TypeMeta), &(g.ihpa.ObjectMeta), &role)
 	addOwnerReference(&(g.ihpa.TypeMeta), &(g.ihpa.ObjectMeta), &roleBinding)
+	addIHPALabel(g.ihpa.GetName(), &sa)
+	addIHPALabel(g.ihpa.GetName(), &role)
+	addIHPALabel(g.ihpa.GetName(), &roleBinding)
 
 	return &sa, &role, &roleBinding, nil
 }
@@ -266,6 +266,7 @@ func TestHorizontalPodAutoscalerResource(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample1",
 					Namespace: "default",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample1"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1beta1",
@@ -324,6 +325,7 @@ func TestHorizontalPodAutoscalerResource(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample2",
 					Namespace: "web",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -474,6 +476,80 @@ func TestHorizontalPodAutoscalerResource(t *testing.T) {
 	}
 }
 
+func TestHorizontalPodAutoscalerResourceShadowMode(t *testing.T) {
+	sample1, _ := testIHPAGeneratorSample(t)
+	sample1.ihpa.Spec.Shadow = true
+
+	got, err := sample1.HorizontalPodAutoscalerResource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only metrics of the template
+	for i, m := range sample1.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics {
+		if !reflect.DeepEqual(&got.Spec.Metrics[i], m.MetricSpec()) {
+			t.Fatalf("metric is not match (got=%v, exp=%v)", got.Spec.Metrics[i], m.MetricSpec())
+		}
+	}
+	if len(got.Spec.Metrics) != len(sample1.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics) {
+		t.Fatalf("number of metrics is not match (got=%d, exp=%d)", len(got.Spec.Metrics), len(sample1.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics))
+	}
+}
+
+func TestIntelligentHorizontalPodAutoscalerGeneratorPaused(t *testing.T) {
+	sample1, _ := testIHPAGeneratorSample(t)
+	sample1.ihpa.Spec.Paused = true
+
+	hpa, err := sample1.HorizontalPodAutoscalerResource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reverted to the metrics of the template
+	if len(hpa.Spec.Metrics) != len(sample1.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics) {
+		t.Fatalf("number of metrics is not match (got=%d, exp=%d)", len(hpa.Spec.Metrics), len(sample1.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics))
+	}
+	fjs, err := sample1.FittingJobResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fj := range fjs {
+		if !fj.Spec.Suspend {
+			t.Fatalf("fittingjob is not suspended (name=%s)", fj.GetName())
+		}
+	}
+	ests, err := sample1.EstimatorResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, est := range ests {
+		if !est.Spec.Paused {
+			t.Fatalf("estimator is not paused (name=%s)", est.GetName())
+		}
+	}
+}
+
+func TestHorizontalPodAutoscalerResourceFloorMode(t *testing.T) {
+	sample1, _ := testIHPAGeneratorSample(t)
+	sample1.ihpa.Spec.EstimatorPatchSpec.Mode = "floor"
+
+	got, err := sample1.HorizontalPodAutoscalerResource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// forecasted metrics are not added
+	if len(got.Spec.Metrics) != len(sample1.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics) {
+		t.Fatalf("number of metrics is not match (got=%d, exp=%d)", len(got.Spec.Metrics), len(sample1.ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics))
+	}
+
+	targets, err := sample1.ForecastTargetValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := resource.NewQuantity(resource.NewQuantity(250, resource.DecimalSI).ScaledValue(resource.Micro), resource.DecimalSI)
+	if targets[0].Cmp(*expected) != 0 {
+		t.Fatalf("target value is not match (got=%v, exp=%v)", targets[0], expected)
+	}
+}
+
 func TestFittingJobResources(t *testing.T) {
 	sample1, sample2 := testIHPAGeneratorSample(t)
 	tests := []struct {
@@ -487,6 +563,7 @@ func TestFittingJobResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample1-cpu",
 						Namespace: "default",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample1"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1beta1",
@@ -538,6 +615,7 @@ func TestFittingJobResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample2-cpu",
 						Namespace: "web",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -599,6 +677,7 @@ func TestFittingJobResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample2-memory",
 						Namespace: "web",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -643,6 +722,7 @@ func TestFittingJobResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample2-nginx-net-request-per-s",
 						Namespace: "web",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -776,6 +856,7 @@ func TestEstimatorResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample1-cpu",
 						Namespace: "default",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample1"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1beta1",
@@ -826,6 +907,7 @@ func TestEstimatorResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample2-cpu",
 						Namespace: "web",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -871,6 +953,7 @@ func TestEstimatorResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample2-memory",
 						Namespace: "web",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -916,6 +999,7 @@ func TestEstimatorResources(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "ihpa-sample2-nginx-net-request-per-s",
 						Namespace: "web",
+						Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 						OwnerReferences: []metav1.OwnerReference{
 							{
 								APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -988,6 +1072,7 @@ func TestRBACResources(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample1",
 					Namespace: "default",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample1"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1beta1",
@@ -1004,6 +1089,7 @@ func TestRBACResources(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample1",
 					Namespace: "default",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample1"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1beta1",
@@ -1028,6 +1114,7 @@ func TestRBACResources(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample1",
 					Namespace: "default",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample1"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1beta1",
@@ -1060,6 +1147,7 @@ func TestRBACResources(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample2",
 					Namespace: "web",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -1076,6 +1164,7 @@ func TestRBACResources(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample2",
 					Namespace: "web",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -1104,6 +1193,7 @@ func TestRBACResources(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "ihpa-sample2",
 					Namespace: "web",
+					Labels:    map[string]string{"ihpa.ake.cyberagent.co.jp/ihpa-name": "sample2"},
 					OwnerReferences: []metav1.OwnerReference{
 						{
 							APIVersion:         "ihpa.ake.cyberagent.co.jp/v1",
@@ -1151,6 +1241,14 @@ func TestRBACResources(t *testing.T) {
 
 func TestGenerateForecastedMetricSpec(t *testing.T) {
 	sample1, sample2 := testIHPAGeneratorSample(t)
+	prometheusSample := &ihpaGeneratorImpl{
+		kubeSystemUID:       sample1.kubeSystemUID,
+		scaleTargetRequests: sample1.scaleTargetRequests.DeepCopy(),
+		ihpa:                sample1.ihpa.DeepCopy(),
+	}
+	prometheusSample.ihpa.Spec.MetricProvider.ProviderSource = ihpav1beta2.ProviderSource{
+		Prometheus: &ihpav1beta2.PrometheusProviderSource{URL: "http://prometheus:9090"},
+	}
 	tests := []struct {
 		generator *ihpaGeneratorImpl
 		metric    *autoscalingv2beta2.MetricSpec
@@ -1188,6 +1286,38 @@ func TestGenerateForecastedMetricSpec(t *testing.T) {
 				},
 			},
 		},
+		{
+			generator: prometheusSample,
+			metric: &autoscalingv2beta2.MetricSpec{
+				Type: "Resource",
+				Resource: &autoscalingv2beta2.ResourceMetricSource{
+					Name: "cpu",
+					Target: autoscalingv2beta2.MetricTarget{
+						Type:               "Utilization",
+						AverageUtilization: func(i int32) *int32 { return &i }(30),
+					},
+				},
+			},
+			expected: &autoscalingv2beta2.MetricSpec{
+				Type: "External",
+				External: &autoscalingv2beta2.ExternalMetricSource{
+					Metric: autoscalingv2beta2.MetricIdentifier{
+						Name: "ake.ihpa.forecasted_container_cpu_usage_seconds_total",
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"kube_system_uid": "46f9e396-d3c4-4103-a807-49054f47bbfb",
+								"kube_namespace":  "default",
+								"kube_deployment": "nginx",
+							},
+						},
+					},
+					Target: autoscalingv2beta2.MetricTarget{
+						Type:         "AverageValue",
+						AverageValue: resource.NewScaledQuantity(150, resource.Milli), // 0.15 core
+					},
+				},
+			},
+		},
 		{
 			generator: sample2,
 			metric: &autoscalingv2beta2.MetricSpec{
@@ -1227,6 +1357,40 @@ func TestGenerateForecastedMetricSpec(t *testing.T) {
 				},
 			},
 		},
+		{
+			generator: sample1,
+			metric: &autoscalingv2beta2.MetricSpec{
+				Type: "Pods",
+				Pods: &autoscalingv2beta2.PodsMetricSource{
+					Metric: autoscalingv2beta2.MetricIdentifier{
+						Name: "nginx.net.request_per_s",
+					},
+					Target: autoscalingv2beta2.MetricTarget{
+						Type:         "AverageValue",
+						AverageValue: resource.NewQuantity(50, resource.DecimalSI),
+					},
+				},
+			},
+			expected: &autoscalingv2beta2.MetricSpec{
+				Type: "External",
+				External: &autoscalingv2beta2.ExternalMetricSource{
+					Metric: autoscalingv2beta2.MetricIdentifier{
+						Name: "ake.ihpa.forecasted_nginx_net_request_per_s",
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"kube_system_uid": "46f9e396-d3c4-4103-a807-49054f47bbfb",
+								"kube_namespace":  "default",
+								"kube_deployment": "nginx",
+							},
+						},
+					},
+					Target: autoscalingv2beta2.MetricTarget{
+						Type:         "AverageValue",
+						AverageValue: resource.NewQuantity(50, resource.DecimalSI),
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1317,6 +1481,54 @@ func TestConvertMetricSpecToIdentifier(t *testing.T) {
 					},
 				},
 			},
+			expected: &autoscalingv2beta2.MetricIdentifier{
+				Name: "requests-per-second",
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"kube_system_uid": "9833e04f-a689-47f9-b588-36a616432abd",
+						"kube_namespace":  "web",
+						"kube_ingress":    "main-route",
+					},
+				},
+			},
+		},
+		{
+			generator: sample1,
+			metric: &autoscalingv2beta2.MetricSpec{
+				Type: "Pods",
+				Pods: &autoscalingv2beta2.PodsMetricSource{
+					Metric: autoscalingv2beta2.MetricIdentifier{
+						Name: "nginx.net.request_per_s",
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"port":           "80",
+								"kube_namespace": "overwritten",
+							},
+						},
+					},
+					Target: autoscalingv2beta2.MetricTarget{
+						Type:         "AverageValue",
+						AverageValue: resource.NewQuantity(50, resource.DecimalSI),
+					},
+				},
+			},
+			expected: &autoscalingv2beta2.MetricIdentifier{
+				Name: "nginx.net.request_per_s",
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"port":            "80",
+						"kube_system_uid": "46f9e396-d3c4-4103-a807-49054f47bbfb",
+						"kube_namespace":  "default",
+						"kube_deployment": "nginx",
+					},
+				},
+			},
+		},
+		{
+			generator: sample1,
+			metric: &autoscalingv2beta2.MetricSpec{
+				Type: "ContainerResource",
+			},
 			expected: nil,
 		},
 	}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// shadowStatus compares replicas recommended by forecasted metrics with desired replicas of the HPA.
+// The recommended replicas are bounded by minReplicas/maxReplicas of the HPA as the HPA does.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) shadowStatus(
+	g IntelligentHorizontalPodAutoscalerGenerator,
+	hpa *unstructured.Unstructured,
+	now time.Time,
+) (*ihpav1beta2.ShadowStatus, error) {
+	status := &ihpav1beta2.ShadowStatus{}
+	if v, found, _ := unstructured.NestedInt64(hpa.Object, "status", "desiredReplicas"); found {
+		status.HPADesiredReplicas = int32(v)
+	}
+
+	recommended, ok, err := r.forecastRecommendedReplicas(g, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return status, nil
+	}
+	if v, found, _ := unstructured.NestedInt64(hpa.Object, "spec", "minReplicas"); found && recommended < int32(v) {
+		recommended = int32(v)
+	} else if !found && recommended < 1 {
+		recommended = 1
+	}
+	if v, found, _ := unstructured.NestedInt64(hpa.Object, "spec", "maxReplicas"); found && recommended > int32(v) {
+		recommended = int32(v)
+	}
+	status.RecommendedReplicas = &recommended
+	return status, nil
+}
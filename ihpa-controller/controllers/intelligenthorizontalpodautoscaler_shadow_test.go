@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestShadowStatus(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := NewForecastSnapshotStore()
+	snapshots.Update("default/cpu", func(s *ForecastSnapshot) {
+		s.ProviderAccessed = true
+		s.AdjustedValue = 350
+		s.HorizonEnd = now.Add(time.Hour)
+	})
+	snapshots.Update("default/spike", func(s *ForecastSnapshot) {
+		s.ProviderAccessed = true
+		s.AdjustedValue = 5000
+		s.HorizonEnd = now.Add(time.Hour)
+	})
+	r := &IntelligentHorizontalPodAutoscalerReconciler{ForecastSnapshots: snapshots}
+
+	hpa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   map[string]interface{}{"minReplicas": int64(2), "maxReplicas": int64(10)},
+		"status": map[string]interface{}{"desiredReplicas": int64(3)},
+	}}
+	estimator := func(name string) *ihpav1beta2.Estimator {
+		return &ihpav1beta2.Estimator{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	}
+
+	tests := []struct {
+		estimator *ihpav1beta2.Estimator
+		expected  *int32
+	}{
+		{estimator: estimator("cpu"), expected: func(i int32) *int32 { return &i }(4)},
+		// bounded by maxReplicas
+		{estimator: estimator("spike"), expected: func(i int32) *int32 { return &i }(10)},
+		// no forecast
+		{estimator: estimator("unknown"), expected: nil},
+	}
+
+	for _, tt := range tests {
+		g := &floorTestGenerator{
+			estimators: []*ihpav1beta2.Estimator{tt.estimator},
+			targets:    []resource.Quantity{resource.MustParse("100")},
+		}
+		got, err := r.shadowStatus(g, hpa, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.HPADesiredReplicas != 3 {
+			t.Fatalf("hpa desired replicas is not match (got=%d, exp=%d)", got.HPADesiredReplicas, 3)
+		}
+		if (got.RecommendedReplicas == nil) != (tt.expected == nil) ||
+			(tt.expected != nil && *got.RecommendedReplicas != *tt.expected) {
+			t.Fatalf("recommended replicas is not match (got=%v, exp=%v)", got.RecommendedReplicas, tt.expected)
+		}
+	}
+}
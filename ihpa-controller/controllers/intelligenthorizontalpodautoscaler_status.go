@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ihpaChildren is names of resources generated from an IHPA.
+type ihpaChildren struct {
+	hpaName string
+	metrics []ihpaMetricChildren
+	// activeOverrides is names of scheduled overrides applied to the HPA.
+	activeOverrides []string
+	// shadow is the comparison between forecast and the HPA in shadow mode.
+	shadow *ihpav1beta2.ShadowStatus
+	// trigger is the value of the trigger annotation propagated to the fittingjobs.
+	trigger string
+	// nextOverrideTransition is the time when a window of the scheduled overrides starts or ends next.
+	nextOverrideTransition time.Time
+}
+
+// ihpaMetricChildren is names of resources generated for a metric.
+type ihpaMetricChildren struct {
+	metricName     string
+	fittingJobName string
+	estimatorName  string
+}
+
+// ihpaStatusSource is observed state of the children for building IHPA status.
+type ihpaStatusSource struct {
+	children *ihpaChildren
+	// snapshots is ForecastSnapshot keyed by estimator name.
+	snapshots map[string]ForecastSnapshot
+	// fittingFailures is a message of the latest failed job keyed by fittingjob name.
+	fittingFailures map[string]string
+	// reconcileErr is an error occurred while reconciling the children.
+	reconcileErr error
+	// paused and pausedReason are pausing state of the IHPA spec.
+	paused       bool
+	pausedReason string
+}
+
+// buildIHPAStatus builds IHPA status from the observed state.
+// LastTransitionTime of the conditions in prev is kept if the condition status is not changed.
+// ObservedGeneration is advanced only when the children are reconciled without error.
+func buildIHPAStatus(prev *ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus, src *ihpaStatusSource, generation int64, now time.Time) *ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus {
+	status := &ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{
+		ObservedGeneration: generation,
+		LastTrigger:        prev.LastTrigger,
+		Conditions:         append([]ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition(nil), prev.Conditions...),
+	}
+	if src.reconcileErr != nil {
+		status.ObservedGeneration = prev.ObservedGeneration
+	}
+	// metav1.Time is serialized in seconds
+	now = now.Truncate(time.Second)
+
+	var metrics []ihpaMetricChildren
+	if src.children != nil {
+		status.HorizontalPodAutoscalerName = src.children.hpaName
+		status.ActiveScheduledOverrides = src.children.activeOverrides
+		status.Shadow = src.children.shadow
+		if src.children.trigger != "" {
+			status.LastTrigger = src.children.trigger
+		}
+		metrics = src.children.metrics
+	}
+
+	var lastForecast, horizonEnd time.Time
+	var noDataMetrics, expiredMetrics, providerErrors, fittingFailures []string
+	providerAccessed := false
+	for _, m := range metrics {
+		ms := ihpav1beta2.MetricForecastStatus{
+			Name:           m.metricName,
+			FittingJobName: m.fittingJobName,
+			EstimatorName:  m.estimatorName,
+		}
+
+		snapshot, ok := src.snapshots[m.estimatorName]
+		if ok && !snapshot.LastForecastTime.IsZero() {
+			ms.LastForecastTime = newTruncatedTime(snapshot.LastForecastTime)
+			if snapshot.LastForecastTime.After(lastForecast) {
+				lastForecast = snapshot.LastForecastTime
+			}
+		}
+		switch {
+		case !ok || snapshot.HorizonEnd.IsZero():
+			noDataMetrics = append(noDataMetrics, m.metricName)
+		default:
+			ms.ForecastHorizonEnd = newTruncatedTime(snapshot.HorizonEnd)
+			if horizonEnd.IsZero() || snapshot.HorizonEnd.Before(horizonEnd) {
+				horizonEnd = snapshot.HorizonEnd
+			}
+			if snapshot.HorizonEnd.Before(now) {
+				expiredMetrics = append(expiredMetrics, m.metricName)
+			}
+		}
+		if ok && snapshot.ProviderAccessed {
+			providerAccessed = true
+			ms.RawValue = newMilliQuantity(snapshot.RawValue)
+			ms.AdjustedValue = newMilliQuantity(snapshot.AdjustedValue)
+			if snapshot.ProviderError != "" {
+				providerErrors = append(providerErrors, fmt.Sprintf("%s: %s", m.metricName, snapshot.ProviderError))
+			}
+		}
+		if msg, ok := src.fittingFailures[m.fittingJobName]; ok {
+			fittingFailures = append(fittingFailures, msg)
+		}
+
+		status.Metrics = append(status.Metrics, ms)
+	}
+	if !lastForecast.IsZero() {
+		status.LastForecastTime = newTruncatedTime(lastForecast)
+	}
+	if !horizonEnd.IsZero() {
+		status.ForecastHorizonEnd = newTruncatedTime(horizonEnd)
+	}
+
+	// ForecastAvailable
+	forecastAvailable := corev1.ConditionFalse
+	switch {
+	case len(metrics) == 0:
+		setIHPACondition(status, ihpav1beta2.ConditionForecastAvailable, corev1.ConditionFalse, "NoMetrics",
+			"no metric is forecasted", now)
+	case len(noDataMetrics) != 0:
+		setIHPACondition(status, ihpav1beta2.ConditionForecastAvailable, corev1.ConditionFalse, "NoForecastData",
+			"forecasted data is not loaded: "+strings.Join(noDataMetrics, ", "), now)
+	case len(expiredMetrics) != 0:
+		setIHPACondition(status, ihpav1beta2.ConditionForecastAvailable, corev1.ConditionFalse, "ForecastExpired",
+			"forecasted data is exhausted: "+strings.Join(expiredMetrics, ", "), now)
+	default:
+		forecastAvailable = corev1.ConditionTrue
+		setIHPACondition(status, ihpav1beta2.ConditionForecastAvailable, corev1.ConditionTrue, "ForecastLoaded",
+			"forecasted data covers current time", now)
+	}
+
+	// ProviderHealthy
+	switch {
+	case len(providerErrors) != 0:
+		setIHPACondition(status, ihpav1beta2.ConditionProviderHealthy, corev1.ConditionFalse, "ProviderError",
+			strings.Join(providerErrors, ", "), now)
+	case providerAccessed:
+		setIHPACondition(status, ihpav1beta2.ConditionProviderHealthy, corev1.ConditionTrue, "ProviderAccessible",
+			"metric provider is accessible", now)
+	default:
+		setIHPACondition(status, ihpav1beta2.ConditionProviderHealthy, corev1.ConditionUnknown, "NotAccessed",
+			"metric provider is not accessed yet", now)
+	}
+
+	// FittingFailed
+	if len(fittingFailures) != 0 {
+		setIHPACondition(status, ihpav1beta2.ConditionFittingFailed, corev1.ConditionTrue, "JobFailed",
+			strings.Join(fittingFailures, ", "), now)
+	} else {
+		setIHPACondition(status, ihpav1beta2.ConditionFittingFailed, corev1.ConditionFalse, "NoFailure",
+			"the latest fitting jobs did not fail", now)
+	}
+
+	// Paused
+	if src.paused {
+		message := "predictive scaling is paused"
+		if src.pausedReason != "" {
+			message += ": " + src.pausedReason
+		}
+		setIHPACondition(status, ihpav1beta2.ConditionPaused, corev1.ConditionTrue, "Paused", message, now)
+	} else {
+		setIHPACondition(status, ihpav1beta2.ConditionPaused, corev1.ConditionFalse, "Running",
+			"predictive scaling is running", now)
+	}
+
+	// Ready
+	switch {
+	case src.reconcileErr != nil:
+		setIHPACondition(status, ihpav1beta2.ConditionReady, corev1.ConditionFalse, "ReconcileFailed",
+			src.reconcileErr.Error(), now)
+	case src.paused:
+		setIHPACondition(status, ihpav1beta2.ConditionReady, corev1.ConditionFalse, "Paused",
+			"forecasted metrics are not served while paused", now)
+	case forecastAvailable != corev1.ConditionTrue:
+		setIHPACondition(status, ihpav1beta2.ConditionReady, corev1.ConditionFalse, "ForecastUnavailable",
+			"forecasted metrics are not available", now)
+	default:
+		setIHPACondition(status, ihpav1beta2.ConditionReady, corev1.ConditionTrue, "Ready",
+			"forecasted metrics are served", now)
+	}
+
+	return status
+}
+
+// statusRequeueAfter returns the duration until the status changes without events of the children,
+// which is the next transition of the scheduled overrides or the expiry of the forecasted data.
+// This returns 0 if no change is expected.
+func statusRequeueAfter(status *ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus, children *ihpaChildren, now time.Time) time.Duration {
+	var next time.Time
+	if children != nil {
+		next = children.nextOverrideTransition
+	}
+	if status.ForecastHorizonEnd != nil {
+		// the horizon end is truncated to seconds, and it is expired after that
+		expiry := status.ForecastHorizonEnd.Add(time.Second)
+		if expiry.After(now) && (next.IsZero() || expiry.Before(next)) {
+			next = expiry
+		}
+	}
+	if !next.After(now) {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// setIHPACondition sets the condition to status.
+// LastTransitionTime is updated only when the condition status is changed.
+func setIHPACondition(
+	status *ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus,
+	condType ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType,
+	condStatus corev1.ConditionStatus,
+	reason, message string,
+	now time.Time,
+) {
+	cond := ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition{
+		Type:               condType,
+		Status:             condStatus,
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             reason,
+		Message:            message,
+	}
+	for i := range status.Conditions {
+		if status.Conditions[i].Type != condType {
+			continue
+		}
+		if status.Conditions[i].Status == condStatus {
+			cond.LastTransitionTime = status.Conditions[i].LastTransitionTime
+		}
+		status.Conditions[i] = cond
+		return
+	}
+	status.Conditions = append(status.Conditions, cond)
+}
+
+// latestJobFailure returns a message if the latest job spawned by the cronjob failed.
+// An empty string is returned if the job does not fail or no job exists.
+func latestJobFailure(ctx context.Context, c client.Reader, namespace, cronJobName string) (string, error) {
+	var jobs batchv1.JobList
+	if err := c.List(ctx, &jobs, client.InNamespace(namespace)); err != nil {
+		return "", fmt.Errorf("failed to get list of jobs: %w", err)
+	}
+
+	owned := make([]batchv1.Job, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		for _, ref := range job.GetOwnerReferences() {
+			if ref.Kind == "CronJob" && ref.Name == cronJobName {
+				owned = append(owned, job)
+				break
+			}
+		}
+	}
+	if len(owned) == 0 {
+		return "", nil
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].CreationTimestamp.Before(&owned[j].CreationTimestamp)
+	})
+
+	latest := owned[len(owned)-1]
+	for _, cond := range latest.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return fmt.Sprintf("job %s failed (%s: %s)", latest.GetName(), cond.Reason, cond.Message), nil
+		}
+	}
+	return "", nil
+}
+
+func newTruncatedTime(t time.Time) *metav1.Time {
+	mt := metav1.NewTime(t.Truncate(time.Second))
+	return &mt
+}
+
+func newMilliQuantity(v float64) *resource.Quantity {
+	return resource.NewMilliQuantity(int64(math.Round(v*1000)), resource.DecimalSI)
+}
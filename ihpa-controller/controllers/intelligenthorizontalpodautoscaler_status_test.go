@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func findIHPACondition(status *ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus, condType ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType) *ihpav1beta2.IntelligentHorizontalPodAutoscalerCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == condType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func TestBuildIHPAStatus(t *testing.T) {
+	now := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)
+	children := &ihpaChildren{
+		hpaName: "ihpa-nginx",
+		metrics: []ihpaMetricChildren{
+			{metricName: "cpu", fittingJobName: "ihpa-nginx-cpu", estimatorName: "ihpa-nginx-cpu"},
+			{metricName: "nginx.net.request_per_s", fittingJobName: "ihpa-nginx-nginx-net-request-per-s", estimatorName: "ihpa-nginx-nginx-net-request-per-s"},
+		},
+		activeOverrides: []string{"campaign"},
+	}
+	healthy := map[string]ForecastSnapshot{
+		"ihpa-nginx-cpu": {
+			LastForecastTime: now.Add(-2 * time.Minute),
+			HorizonEnd:       now.Add(24 * time.Hour),
+			RawValue:         1.5,
+			AdjustedValue:    2,
+			ProviderAccessed: true,
+		},
+		"ihpa-nginx-nginx-net-request-per-s": {
+			LastForecastTime: now.Add(-time.Minute),
+			HorizonEnd:       now.Add(12 * time.Hour),
+			RawValue:         10,
+			AdjustedValue:    10,
+			ProviderAccessed: true,
+		},
+	}
+
+	tests := []struct {
+		src      *ihpaStatusSource
+		expected map[ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType]corev1.ConditionStatus
+	}{
+		{
+			src: &ihpaStatusSource{children: children, snapshots: healthy},
+			expected: map[ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType]corev1.ConditionStatus{
+				ihpav1beta2.ConditionReady:             corev1.ConditionTrue,
+				ihpav1beta2.ConditionForecastAvailable: corev1.ConditionTrue,
+				ihpav1beta2.ConditionProviderHealthy:   corev1.ConditionTrue,
+				ihpav1beta2.ConditionFittingFailed:     corev1.ConditionFalse,
+				ihpav1beta2.ConditionPaused:            corev1.ConditionFalse,
+			},
+		},
+		{
+			src: &ihpaStatusSource{children: children, snapshots: healthy, paused: true, pausedReason: "incident"},
+			expected: map[ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType]corev1.ConditionStatus{
+				ihpav1beta2.ConditionReady:             corev1.ConditionFalse,
+				ihpav1beta2.ConditionForecastAvailable: corev1.ConditionTrue,
+				ihpav1beta2.ConditionPaused:            corev1.ConditionTrue,
+			},
+		},
+		{
+			src: &ihpaStatusSource{children: children},
+			expected: map[ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType]corev1.ConditionStatus{
+				ihpav1beta2.ConditionReady:             corev1.ConditionFalse,
+				ihpav1beta2.ConditionForecastAvailable: corev1.ConditionFalse,
+				ihpav1beta2.ConditionProviderHealthy:   corev1.ConditionUnknown,
+				ihpav1beta2.ConditionFittingFailed:     corev1.ConditionFalse,
+			},
+		},
+		{
+			src: &ihpaStatusSource{
+				children: children,
+				snapshots: map[string]ForecastSnapshot{
+					"ihpa-nginx-cpu":                     {HorizonEnd: now.Add(-time.Minute), ProviderAccessed: true, ProviderError: "connection refused"},
+					"ihpa-nginx-nginx-net-request-per-s": healthy["ihpa-nginx-nginx-net-request-per-s"],
+				},
+				fittingFailures: map[string]string{"ihpa-nginx-cpu": "job ihpa-nginx-cpu-xxx failed"},
+			},
+			expected: map[ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType]corev1.ConditionStatus{
+				ihpav1beta2.ConditionReady:             corev1.ConditionFalse,
+				ihpav1beta2.ConditionForecastAvailable: corev1.ConditionFalse,
+				ihpav1beta2.ConditionProviderHealthy:   corev1.ConditionFalse,
+				ihpav1beta2.ConditionFittingFailed:     corev1.ConditionTrue,
+			},
+		},
+		{
+			src: &ihpaStatusSource{children: &ihpaChildren{}, reconcileErr: fmt.Errorf("deployment not found")},
+			expected: map[ihpav1beta2.IntelligentHorizontalPodAutoscalerConditionType]corev1.ConditionStatus{
+				ihpav1beta2.ConditionReady:             corev1.ConditionFalse,
+				ihpav1beta2.ConditionForecastAvailable: corev1.ConditionFalse,
+				ihpav1beta2.ConditionProviderHealthy:   corev1.ConditionUnknown,
+				ihpav1beta2.ConditionFittingFailed:     corev1.ConditionFalse,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := buildIHPAStatus(&ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{}, tt.src, 1, now)
+		for condType, expected := range tt.expected {
+			cond := findIHPACondition(got, condType)
+			if cond == nil {
+				t.Fatalf("condition %s is not found", condType)
+			}
+			if cond.Status != expected {
+				t.Fatalf("status of %s is not match (got=%s, exp=%s, reason=%s)", condType, cond.Status, expected, cond.Reason)
+			}
+		}
+	}
+
+	// aggregated values
+	got := buildIHPAStatus(&ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{}, &ihpaStatusSource{children: children, snapshots: healthy}, 3, now)
+	if got.HorizontalPodAutoscalerName != "ihpa-nginx" {
+		t.Fatalf("hpa name is not match (got=%s, exp=%s)", got.HorizontalPodAutoscalerName, "ihpa-nginx")
+	}
+	if got.ObservedGeneration != 3 {
+		t.Fatalf("observed generation is not match (got=%d, exp=%d)", got.ObservedGeneration, 3)
+	}
+	if !got.LastForecastTime.Time.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("last forecast time is not match (got=%v, exp=%v)", got.LastForecastTime, now.Add(-time.Minute))
+	}
+	if !got.ForecastHorizonEnd.Time.Equal(now.Add(12 * time.Hour)) {
+		t.Fatalf("forecast horizon end is not match (got=%v, exp=%v)", got.ForecastHorizonEnd, now.Add(12*time.Hour))
+	}
+	if len(got.Metrics) != 2 {
+		t.Fatalf("number of metrics is not match (got=%d, exp=%d)", len(got.Metrics), 2)
+	}
+	if v := got.Metrics[0].RawValue.String(); v != "1500m" {
+		t.Fatalf("raw value is not match (got=%s, exp=%s)", v, "1500m")
+	}
+	if v := got.Metrics[0].AdjustedValue.String(); v != "2" {
+		t.Fatalf("adjusted value is not match (got=%s, exp=%s)", v, "2")
+	}
+	if len(got.ActiveScheduledOverrides) != 1 || got.ActiveScheduledOverrides[0] != "campaign" {
+		t.Fatalf("active scheduled overrides are not match (got=%v, exp=%v)", got.ActiveScheduledOverrides, []string{"campaign"})
+	}
+
+	paused := buildIHPAStatus(got, &ihpaStatusSource{children: children, snapshots: healthy, paused: true, pausedReason: "incident"}, 3, now)
+	if cond := findIHPACondition(paused, ihpav1beta2.ConditionPaused); cond.Message != "predictive scaling is paused: incident" {
+		t.Fatalf("paused message is not match (got=%s, exp=%s)", cond.Message, "predictive scaling is paused: incident")
+	}
+
+	// LastTransitionTime is kept while the status is not changed
+	later := buildIHPAStatus(got, &ihpaStatusSource{children: children, snapshots: healthy}, 3, now.Add(time.Minute))
+	cond := findIHPACondition(later, ihpav1beta2.ConditionReady)
+	if !cond.LastTransitionTime.Time.Equal(now) {
+		t.Fatalf("last transition time is not match (got=%v, exp=%v)", cond.LastTransitionTime, now)
+	}
+	failed := buildIHPAStatus(got, &ihpaStatusSource{children: children, reconcileErr: fmt.Errorf("error")}, 4, now.Add(time.Minute))
+	cond = findIHPACondition(failed, ihpav1beta2.ConditionReady)
+	if !cond.LastTransitionTime.Time.Equal(now.Add(time.Minute)) {
+		t.Fatalf("last transition time is not match (got=%v, exp=%v)", cond.LastTransitionTime, now.Add(time.Minute))
+	}
+	// the generation is observed again until it is reconciled
+	if failed.ObservedGeneration != 3 {
+		t.Fatalf("observed generation is not match (got=%d, exp=%d)", failed.ObservedGeneration, 3)
+	}
+
+	// the propagated trigger is kept until a new one is propagated
+	triggered := buildIHPAStatus(got, &ihpaStatusSource{children: &ihpaChildren{trigger: "1"}, snapshots: healthy}, 3, now)
+	if triggered.LastTrigger != "1" {
+		t.Fatalf("last trigger is not match (got=%s, exp=%s)", triggered.LastTrigger, "1")
+	}
+	if kept := buildIHPAStatus(triggered, &ihpaStatusSource{children: children, snapshots: healthy}, 3, now); kept.LastTrigger != "1" {
+		t.Fatalf("last trigger is not match (got=%s, exp=%s)", kept.LastTrigger, "1")
+	}
+}
+
+func TestStatusRequeueAfter(t *testing.T) {
+	now := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)
+	horizonEnd := newTruncatedTime(now.Add(2 * time.Hour))
+
+	tests := []struct {
+		status   *ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus
+		children *ihpaChildren
+		expected time.Duration
+	}{
+		{
+			status:   &ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{},
+			expected: 0,
+		},
+		{
+			status:   &ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{ForecastHorizonEnd: horizonEnd},
+			children: &ihpaChildren{},
+			expected: 2*time.Hour + time.Second,
+		},
+		{
+			status:   &ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{ForecastHorizonEnd: horizonEnd},
+			children: &ihpaChildren{nextOverrideTransition: now.Add(time.Hour)},
+			expected: time.Hour,
+		},
+		{
+			// expired forecast is not refreshed by itself
+			status:   &ihpav1beta2.IntelligentHorizontalPodAutoscalerStatus{ForecastHorizonEnd: newTruncatedTime(now.Add(-time.Hour))},
+			children: &ihpaChildren{},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := statusRequeueAfter(tt.status, tt.children, now); got != tt.expected {
+			t.Fatalf("requeue duration is not match (got=%v, exp=%v)", got, tt.expected)
+		}
+	}
+}
+
+func TestLatestJobFailure(t *testing.T) {
+	base := time.Date(2020, 3, 1, 4, 0, 0, 0, time.UTC)
+	newJob := func(name string, created time.Time, failed bool) *batchv1.Job {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(created),
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: "ihpa-nginx-cpu", UID: "xxx"},
+				},
+			},
+		}
+		if failed {
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"},
+			}
+		}
+		return job
+	}
+
+	tests := []struct {
+		jobs     []*batchv1.Job
+		expected string
+	}{
+		{
+			jobs:     nil,
+			expected: "",
+		},
+		{
+			jobs: []*batchv1.Job{
+				newJob("ihpa-nginx-cpu-1", base, false),
+				newJob("ihpa-nginx-cpu-2", base.Add(24*time.Hour), true),
+			},
+			expected: "job ihpa-nginx-cpu-2 failed (BackoffLimitExceeded: Job has reached the specified backoff limit)",
+		},
+		{
+			// recovered by the latest job
+			jobs: []*batchv1.Job{
+				newJob("ihpa-nginx-cpu-1", base, true),
+				newJob("ihpa-nginx-cpu-2", base.Add(24*time.Hour), false),
+			},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme)
+		for _, job := range tt.jobs {
+			if err := c.Create(context.Background(), job); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := latestJobFailure(context.Background(), c, "default", "ihpa-nginx-cpu")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Fatalf("failure message is not match (got=%s, exp=%s)", got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/internal/webhook/admissionreview"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// IHPAValidatingWebhookPath is the path of the validating webhook of IntelligentHorizontalPodAutoscaler.
+const IHPAValidatingWebhookPath = "/validate-ihpa-ake-cyberagent-co-jp-v1beta2-intelligenthorizontalpodautoscaler"
+
+// +kubebuilder:webhook:path=/validate-ihpa-ake-cyberagent-co-jp-v1beta2-intelligenthorizontalpodautoscaler,mutating=false,failurePolicy=fail,groups=ihpa.ake.cyberagent.co.jp,resources=intelligenthorizontalpodautoscalers,verbs=create;update,versions=v1beta2,name=vintelligenthorizontalpodautoscaler.ake.cyberagent.co.jp,sideEffects=None,matchPolicy=Equivalent,webhookVersions=v1,admissionReviewVersions=v1
+
+// IntelligentHorizontalPodAutoscalerValidator validates IHPA by generating its resources in dry-run.
+// The generator of IntelligentHorizontalPodAutoscalerReconciler is used, so the same errors as
+// reconciliation are reported at admission.
+type IntelligentHorizontalPodAutoscalerValidator struct {
+	Reconciler *IntelligentHorizontalPodAutoscalerReconciler
+
+	decoder *admission.Decoder
+}
+
+// SetupWebhookWithManager registers the validating webhook to the manager.
+func (v *IntelligentHorizontalPodAutoscalerValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	v.decoder = decoder
+	mgr.GetWebhookServer().Register(IHPAValidatingWebhookPath, admissionreview.NewHandler(&webhook.Admission{Handler: v}))
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *IntelligentHorizontalPodAutoscalerValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ihpa := &ihpav1beta2.IntelligentHorizontalPodAutoscaler{}
+	if err := v.decoder.Decode(req, ihpa); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// the ihpa being deleted must be able to remove its finalizer
+	if !ihpa.GetDeletionTimestamp().IsZero() {
+		return admission.Allowed("")
+	}
+	if req.Operation == admissionv1beta1.Update {
+		old := &ihpav1beta2.IntelligentHorizontalPodAutoscaler{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if equality.Semantic.DeepEqual(&old.Spec, &ihpa.Spec) {
+			return admission.Allowed("")
+		}
+	}
+
+	errs := validateIntelligentHorizontalPodAutoscaler(ihpa)
+	if len(errs) == 0 {
+		errs = v.validateGeneration(ctx, ihpa)
+	}
+	if len(errs) != 0 {
+		statusErr := apierrors.NewInvalid(ihpav1beta2.GroupVersion.WithKind("IntelligentHorizontalPodAutoscaler").GroupKind(), ihpa.GetName(), errs)
+		return admission.Response{
+			AdmissionResponse: admissionv1beta1.AdmissionResponse{
+				Allowed: false,
+				Result:  &statusErr.ErrStatus,
+			},
+		}
+	}
+	return admission.Allowed("")
+}
+
+// validateGeneration generates resources from the IHPA in dry-run and reports errors with field paths.
+// If the scale target does not exist yet, the checks depending on it are skipped.
+func (v *IntelligentHorizontalPodAutoscalerValidator) validateGeneration(
+	ctx context.Context,
+	ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler,
+) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec", "template", "spec")
+
+	g, err := NewIntelligentHorizontalPodAutoscalerGenerator(ihpa, v.Reconciler, ctx)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return append(errs, field.Invalid(specPath.Child("scaleTargetRef"), ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.ScaleTargetRef, err.Error()))
+	}
+	gi, ok := g.(*ihpaGeneratorImpl)
+	if !ok {
+		return nil
+	}
+
+	for i, metric := range ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec.Metrics {
+		metricName, _ := extractScopedMetricInfo(metric.MetricSpec())
+		if _, err := gi.generateForecastedMetricSpec(metric.MetricSpec()); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("metrics").Index(i), metricName, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateIntelligentHorizontalPodAutoscaler validates the spec without accessing the cluster.
+func validateIntelligentHorizontalPodAutoscaler(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) field.ErrorList {
+	var errs field.ErrorList
+
+	providerPath := field.NewPath("spec", "metricProvider")
+	provider := &ihpa.Spec.MetricProvider
+	switch {
+	case provider.Datadog == nil && provider.Prometheus == nil:
+		errs = append(errs, field.Required(providerPath, "one of datadog or prometheus must be specified"))
+	case provider.Datadog != nil && provider.Prometheus != nil:
+		errs = append(errs, field.Forbidden(providerPath.Child("prometheus"), "only one of datadog or prometheus can be specified"))
+	case provider.Datadog != nil:
+		dd := provider.Datadog
+		if len(dd.KeysFrom) == 0 && (dd.APIKey == "" || dd.APPKey == "") {
+			errs = append(errs, field.Required(providerPath.Child("datadog"), "apikey and appkey, or keysFrom must be specified"))
+		}
+	case provider.Prometheus != nil:
+		if provider.Prometheus.URL == "" {
+			errs = append(errs, field.Required(providerPath.Child("prometheus", "url"), ""))
+		}
+	}
+
+	specPath := field.NewPath("spec", "template", "spec")
+	spec := &ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec
+	if spec.MinReplicas != nil && *spec.MinReplicas > spec.MaxReplicas {
+		errs = append(errs, field.Invalid(specPath.Child("minReplicas"), *spec.MinReplicas, "must be less than or equal to maxReplicas"))
+	}
+
+	// names of generated resources are derived from metric names
+	metricNames := make(map[string]struct{}, len(spec.Metrics))
+	for i, metric := range spec.Metrics {
+		metricPath := specPath.Child("metrics").Index(i)
+		var missing bool
+		switch metric.Type {
+		case "Resource":
+			missing = metric.Resource == nil
+		case "Pods":
+			missing = metric.Pods == nil
+		case "Object":
+			missing = metric.Object == nil
+		case "External":
+			missing = metric.External == nil
+		default:
+			errs = append(errs, field.NotSupported(metricPath.Child("type"), metric.Type, []string{"Resource", "Pods", "Object", "External"}))
+			continue
+		}
+		sourcePath := metricPath.Child(strings.ToLower(string(metric.Type)))
+		if missing {
+			errs = append(errs, field.Required(sourcePath, "must be specified for "+string(metric.Type)+" metric"))
+			continue
+		}
+
+		metricName, target := extractScopedMetricInfo(metric.MetricSpec())
+		if target.Type == "Utilization" && target.AverageUtilization == nil {
+			errs = append(errs, field.Required(sourcePath.Child("target", "averageUtilization"), ""))
+		}
+		errs = append(errs, validateFittingJobSchedule(&metric.FittingJobPatchSpec, ihpa, metricPath.Child("fittingJob"))...)
+		name := strings.ToLower(sanitizeForKubernetesResourceName(metricName))
+		if _, ok := metricNames[name]; ok {
+			errs = append(errs, field.Duplicate(metricPath, metricName))
+		}
+		metricNames[name] = struct{}{}
+	}
+
+	overridesPath := field.NewPath("spec", "scheduledOverrides")
+	overrideNames := make(map[string]struct{}, len(ihpa.Spec.ScheduledOverrides))
+	for i := range ihpa.Spec.ScheduledOverrides {
+		o := &ihpa.Spec.ScheduledOverrides[i]
+		overridePath := overridesPath.Index(i)
+		if o.Name == "" {
+			errs = append(errs, field.Required(overridePath.Child("name"), ""))
+		} else if _, ok := overrideNames[o.Name]; ok {
+			errs = append(errs, field.Duplicate(overridePath.Child("name"), o.Name))
+		}
+		overrideNames[o.Name] = struct{}{}
+		if _, err := newScheduledOverride(o); err != nil {
+			errs = append(errs, field.Invalid(overridePath, o.Name, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+// validateFittingJobSchedule validates the schedule and the time zone of fitting job.
+func validateFittingJobSchedule(fjps *ihpav1beta2.FittingJobPatchSpec, ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler, fjPath *field.Path) field.ErrorList {
+	if fjps.TimeZone != "" {
+		if _, err := time.LoadLocation(fjps.TimeZone); err != nil {
+			return field.ErrorList{field.Invalid(fjPath.Child("timeZone"), fjps.TimeZone, err.Error())}
+		}
+	}
+	if _, err := fittingJobSchedule(fjps.GenerateFittingJobSpec(), ihpa, time.Now()); err != nil {
+		return field.ErrorList{field.Invalid(fjPath.Child("schedule"), fjps.Schedule, err.Error())}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func testValidationIHPA() *ihpav1beta2.IntelligentHorizontalPodAutoscaler {
+	return &ihpav1beta2.IntelligentHorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec: ihpav1beta2.IntelligentHorizontalPodAutoscalerSpec{
+			HorizontalPodAutoscalerTemplate: ihpav1beta2.ExtendedHorizontalPodAutoscalerTemplateSpec{
+				Spec: ihpav1beta2.ExtendedHorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx"},
+					MaxReplicas:    5,
+					Metrics: []ihpav1beta2.ExtendedMetricSpec{
+						{
+							Type: "Resource",
+							Resource: &autoscalingv2beta2.ResourceMetricSource{
+								Name: "cpu",
+								Target: autoscalingv2beta2.MetricTarget{
+									Type:               "Utilization",
+									AverageUtilization: func(i int32) *int32 { return &i }(50),
+								},
+							},
+						},
+					},
+				},
+			},
+			MetricProvider: ihpav1beta2.MetricProvider{
+				Name: "datadog",
+				ProviderSource: ihpav1beta2.ProviderSource{
+					Datadog: &ihpav1beta2.DatadogProviderSource{APIKey: "xxx", APPKey: "yyy"},
+				},
+			},
+		},
+	}
+}
+
+func TestValidateIntelligentHorizontalPodAutoscaler(t *testing.T) {
+	tests := []struct {
+		modify   func(*ihpav1beta2.IntelligentHorizontalPodAutoscaler)
+		expected []string
+	}{
+		{
+			modify:   func(*ihpav1beta2.IntelligentHorizontalPodAutoscaler) {},
+			expected: nil,
+		},
+		{
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				ihpa.Spec.MetricProvider.Datadog = nil
+			},
+			expected: []string{"spec.metricProvider"},
+		},
+		{
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				ihpa.Spec.MetricProvider.Prometheus = &ihpav1beta2.PrometheusProviderSource{URL: "http://prometheus:9090"}
+			},
+			expected: []string{"spec.metricProvider.prometheus"},
+		},
+		{
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				ihpa.Spec.MetricProvider.Datadog.APPKey = ""
+			},
+			expected: []string{"spec.metricProvider.datadog"},
+		},
+		{
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				spec := &ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec
+				spec.MinReplicas = func(i int32) *int32 { return &i }(10)
+				spec.Metrics = append(spec.Metrics,
+					ihpav1beta2.ExtendedMetricSpec{Type: "ContainerResource"},
+					ihpav1beta2.ExtendedMetricSpec{Type: "Pods"},
+					*spec.Metrics[0].DeepCopy(),
+				)
+				spec.Metrics[0].Resource.Target.AverageUtilization = nil
+			},
+			expected: []string{
+				"spec.template.spec.minReplicas",
+				"spec.template.spec.metrics[0].resource.target.averageUtilization",
+				"spec.template.spec.metrics[1].type",
+				"spec.template.spec.metrics[2].pods",
+				"spec.template.spec.metrics[3]",
+			},
+		},
+		{
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				ihpa.Spec.ScheduledOverrides = []ihpav1beta2.ScheduledOverride{
+					{Name: "campaign", Schedule: "0 20 * * *", DurationMinutes: 60, MinReplicas: func(i int32) *int32 { return &i }(3)},
+					{Name: "campaign", Schedule: "0 25 * * *", DurationMinutes: 60, MinReplicas: func(i int32) *int32 { return &i }(3)},
+				}
+			},
+			expected: []string{
+				"spec.scheduledOverrides[1].name",
+				"spec.scheduledOverrides[1]",
+			},
+		},
+		{
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				spec := &ihpa.Spec.HorizontalPodAutoscalerTemplate.Spec
+				spec.Metrics = append(spec.Metrics, *spec.Metrics[0].DeepCopy(), *spec.Metrics[0].DeepCopy())
+				spec.Metrics[1].Resource.Name = "memory"
+				spec.Metrics[2].Resource.Name = "storage"
+				spec.Metrics[0].FittingJobPatchSpec.Schedule = "30 2 * * 1-5"
+				spec.Metrics[0].FittingJobPatchSpec.TimeZone = "Asia/Tokyo"
+				spec.Metrics[1].FittingJobPatchSpec.TimeZone = "Unknown/Zone"
+				// the day of month cannot be moved to UTC
+				spec.Metrics[2].FittingJobPatchSpec.Schedule = "30 2 1 * *"
+				spec.Metrics[2].FittingJobPatchSpec.TimeZone = "Asia/Tokyo"
+			},
+			expected: []string{
+				"spec.template.spec.metrics[1].fittingJob.timeZone",
+				"spec.template.spec.metrics[2].fittingJob.schedule",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		ihpa := testValidationIHPA()
+		tt.modify(ihpa)
+		errs := validateIntelligentHorizontalPodAutoscaler(ihpa)
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Field)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+			t.Fatalf("invalid fields are not match (got=%v, exp=%v)", got, tt.expected)
+		}
+	}
+}
+
+func TestIntelligentHorizontalPodAutoscalerValidatorHandle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ihpav1beta2.AddToScheme(scheme)
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployment := func(requests corev1.ResourceList) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "nginx", Resources: corev1.ResourceRequirements{Requests: requests}}},
+					},
+				},
+			},
+		}
+	}
+	kubeSystem := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uid"}}
+
+	tests := []struct {
+		objs     []runtime.Object
+		modify   func(*ihpav1beta2.IntelligentHorizontalPodAutoscaler)
+		allowed  bool
+		expected string
+	}{
+		{
+			objs:    []runtime.Object{kubeSystem, deployment(corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")})},
+			modify:  func(*ihpav1beta2.IntelligentHorizontalPodAutoscaler) {},
+			allowed: true,
+		},
+		{
+			// utilization target on containers without requests
+			objs:     []runtime.Object{kubeSystem, deployment(nil)},
+			modify:   func(*ihpav1beta2.IntelligentHorizontalPodAutoscaler) {},
+			allowed:  false,
+			expected: "spec.template.spec.metrics[0]",
+		},
+		{
+			// scale target is created after the ihpa
+			objs:    []runtime.Object{kubeSystem},
+			modify:  func(*ihpav1beta2.IntelligentHorizontalPodAutoscaler) {},
+			allowed: true,
+		},
+		{
+			objs: []runtime.Object{kubeSystem},
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				ihpa.Spec.MetricProvider.Datadog = nil
+			},
+			allowed:  false,
+			expected: "spec.metricProvider",
+		},
+		{
+			// deleting ihpa is not validated
+			objs: []runtime.Object{kubeSystem},
+			modify: func(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler) {
+				now := metav1.Now()
+				ihpa.DeletionTimestamp = &now
+				ihpa.Spec.MetricProvider.Datadog = nil
+			},
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		v := &IntelligentHorizontalPodAutoscalerValidator{
+			Reconciler: &IntelligentHorizontalPodAutoscalerReconciler{Client: fake.NewFakeClientWithScheme(scheme, tt.objs...)},
+			decoder:    decoder,
+		}
+		ihpa := testValidationIHPA()
+		tt.modify(ihpa)
+		raw, err := json.Marshal(ihpa)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := v.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: admissionv1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		if resp.Allowed != tt.allowed {
+			t.Fatalf("allowed is not match (got=%v, exp=%v, result=%v)", resp.Allowed, tt.allowed, resp.Result)
+		}
+		if tt.allowed {
+			continue
+		}
+		if resp.Result == nil || resp.Result.Details == nil || len(resp.Result.Details.Causes) == 0 ||
+			resp.Result.Details.Causes[0].Field != tt.expected {
+			t.Fatalf("denied field is not match (got=%v, exp=%s)", resp.Result, tt.expected)
+		}
+	}
+}
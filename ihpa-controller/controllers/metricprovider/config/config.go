@@ -23,8 +23,25 @@ func ConvertMetricProvider(mp *ihpav1beta2.MetricProvider) *MetricProviderConfig
 		}
 		metricProvider.Datadog = &datadog
 	} else if mp.ProviderSource.Prometheus != nil {
-		prometheus := prometheusmp.Prometheus{}
-		metricProvider.Prometheus = &prometheus
+		src := mp.ProviderSource.Prometheus
+		var basicAuth *prometheusmp.BasicAuth
+		if src.BasicAuth != nil {
+			basicAuth = &prometheusmp.BasicAuth{
+				Username: src.BasicAuth.Username,
+				Password: src.BasicAuth.Password,
+			}
+		}
+		var tlsConfig *prometheusmp.TLSConfig
+		if src.TLSConfig != nil {
+			tlsConfig = &prometheusmp.TLSConfig{
+				CA:                 src.TLSConfig.CA,
+				Cert:               src.TLSConfig.Cert,
+				Key:                src.TLSConfig.Key,
+				ServerName:         src.TLSConfig.ServerName,
+				InsecureSkipVerify: src.TLSConfig.InsecureSkipVerify,
+			}
+		}
+		metricProvider.Prometheus = prometheusmp.NewPrometheus(src.URL, src.RemoteWriteURL, src.BearerToken, basicAuth, tlsConfig)
 	}
 	return &metricProvider
 }
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
@@ -33,7 +35,29 @@ func TestConvertMetricProvider(t *testing.T) {
 				},
 			},
 			expected: &MetricProviderConfig{
-				Prometheus: &prometheusmp.Prometheus{},
+				Prometheus: prometheusmp.NewPrometheus("", "", "", nil, nil),
+			},
+		},
+		{
+			input: &ihpav1beta2.MetricProvider{
+				Name: "prometheus",
+				ProviderSource: ihpav1beta2.ProviderSource{
+					Prometheus: &ihpav1beta2.PrometheusProviderSource{
+						URL:            "http://prometheus:9090",
+						RemoteWriteURL: "http://remote-storage:9201/write",
+						BasicAuth:      &ihpav1beta2.PrometheusBasicAuth{Username: "user", Password: "pass"},
+						TLSConfig:      &ihpav1beta2.PrometheusTLSConfig{ServerName: "prometheus", InsecureSkipVerify: true},
+					},
+				},
+			},
+			expected: &MetricProviderConfig{
+				Prometheus: prometheusmp.NewPrometheus(
+					"http://prometheus:9090",
+					"http://remote-storage:9201/write",
+					"",
+					&prometheusmp.BasicAuth{Username: "user", Password: "pass"},
+					&prometheusmp.TLSConfig{ServerName: "prometheus", InsecureSkipVerify: true},
+				),
 			},
 		},
 	}
@@ -45,3 +69,28 @@ func TestConvertMetricProvider(t *testing.T) {
 		}
 	}
 }
+
+func TestMetricProviderConfigJSON(t *testing.T) {
+	// credentials resolved from Secrets must not be written to the config of fitting jobs
+	mp := ConvertMetricProvider(&ihpav1beta2.MetricProvider{
+		ProviderSource: ihpav1beta2.ProviderSource{
+			Prometheus: &ihpav1beta2.PrometheusProviderSource{
+				URL:         "http://prometheus:9090",
+				BearerToken: "secret-token",
+				BasicAuth:   &ihpav1beta2.PrometheusBasicAuth{Username: "user", Password: "secret-password"},
+				TLSConfig:   &ihpav1beta2.PrometheusTLSConfig{Cert: "cert", Key: "secret-key"},
+			},
+		},
+	})
+	if mp.Prometheus.BearerToken != "secret-token" || mp.Prometheus.BasicAuth.Password != "secret-password" || mp.Prometheus.TLSConfig.Key != "secret-key" {
+		t.Fatalf("credentials are not converted (got=%+v)", mp.Prometheus)
+	}
+
+	b, err := json.Marshal(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret-") {
+		t.Fatalf("credentials are marshaled (got=%s)", b)
+	}
+}
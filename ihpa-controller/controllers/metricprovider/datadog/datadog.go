@@ -37,8 +37,8 @@ func (mi *metricIdentifier) GetName() string { return mi.name }
 func (mi *metricIdentifier) GetScale() int   { return mi.scale }
 
 type Datadog struct {
-	APIKey string `json:"apikey"`
-	APPKey string `json:"appkey"`
+	APIKey string `json:"apikey,omitempty"`
+	APPKey string `json:"appkey,omitempty"`
 }
 
 type datapoint struct {
@@ -1,11 +1,69 @@
 package prometheus
 
-import "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider"
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+const (
+	QueryPath       = "/api/v1/query"
+	RemoteWritePath = "/api/v1/write"
+
+	// RateRange is range of rate() applied to counter metrics.
+	RateRange = "5m"
+
+	requestTimeout = 30 * time.Second
+)
 
 var (
-	resourceMetricMap = map[string]metricIdentifier{}
-	objectMetricMap   = map[string]metricIdentifier{}
-	podsMetricMap     = map[string]metricIdentifier{}
+	// cAdvisor series exposed by kubelet.
+	// cpu is a counter of cpu seconds, so the rate of it is core (scale 0).
+	resourceMetricMap = map[string]metricIdentifier{
+		"cpu":    {name: "container_cpu_usage_seconds_total", scale: 0},
+		"memory": {name: "container_memory_working_set_bytes", scale: 0},
+	}
+	objectMetricMap = map[string]metricIdentifier{}
+	podsMetricMap   = map[string]metricIdentifier{}
+
+	invalidLabelNameChars  = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+	// Tags generated by the controller follow Datadog, but series of Kubernetes exposed by cAdvisor
+	// and kube-state-metrics are labeled with namespace and pod.
+	// tagLabelNames maps the tags into the labels, and the tags in droppedTags have no label.
+	tagLabelNames = map[string]string{
+		"kube_namespace": "namespace",
+	}
+	droppedTags = map[string]struct{}{
+		"kube_system_uid": {},
+	}
+	// podNamePatterns maps the tags of scale targets into patterns of names of their pods.
+	podNamePatterns = map[string]func(name string) string{
+		// <deployment>-<pod-template-hash>-<suffix>
+		"kube_deployment": func(name string) string { return regexp.QuoteMeta(name) + "-[a-z0-9]+-[a-z0-9]+" },
+		// <statefulset>-<ordinal>
+		"kube_statefulset": func(name string) string { return regexp.QuoteMeta(name) + "-[0-9]+" },
+		// <replicaset>-<suffix>
+		"kube_replicaset": func(name string) string { return regexp.QuoteMeta(name) + "-[a-z0-9]+" },
+	}
+	// containerMatchers excludes series of the pod cgroup and the pause container from cAdvisor series,
+	// which duplicate the usage of containers.
+	containerMatchers = []string{`container!=""`, `container!="POD"`}
 )
 
 type metricIdentifier struct {
@@ -16,14 +74,363 @@ type metricIdentifier struct {
 func (mi *metricIdentifier) GetName() string { return mi.name }
 func (mi *metricIdentifier) GetScale() int   { return mi.scale }
 
-type Prometheus struct{}
+// Prometheus is the metric provider of Prometheus.
+// The credentials (BearerToken, BasicAuth.Password and TLSConfig.Key) are not marshaled,
+// so they are not written to the config of fitting jobs.
+type Prometheus struct {
+	URL            string     `json:"url,omitempty"`
+	RemoteWriteURL string     `json:"remoteWriteURL,omitempty"`
+	BearerToken    string     `json:"-"`
+	BasicAuth      *BasicAuth `json:"basicAuth,omitempty"`
+	TLSConfig      *TLSConfig `json:"tlsConfig,omitempty"`
+
+	// client is shared by all requests to reuse connections.
+	client    *http.Client
+	clientErr error
+}
+
+// NewPrometheus returns Prometheus with the HTTP client built from the TLS config.
+// An error of the TLS config is returned by Send and Fetch.
+func NewPrometheus(url, remoteWriteURL, bearerToken string, basicAuth *BasicAuth, tlsConfig *TLSConfig) *Prometheus {
+	p := &Prometheus{
+		URL:            url,
+		RemoteWriteURL: remoteWriteURL,
+		BearerToken:    bearerToken,
+		BasicAuth:      basicAuth,
+		TLSConfig:      tlsConfig,
+	}
+	p.client, p.clientErr = p.newHTTPClient()
+	return p
+}
+
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"-"`
+}
+
+type TLSConfig struct {
+	CA                 string `json:"ca,omitempty"`
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"-"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+type queryResponse struct {
+	Status    string    `json:"status"`
+	Data      queryData `json:"data"`
+	ErrorType string    `json:"errorType,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type queryData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type vectorSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
 
 func (p *Prometheus) Send(metricName string, timestamp int64, point float64, tags []string, opts map[string]interface{}) error {
+	url := p.RemoteWriteURL
+	if url == "" {
+		// Prometheus itself can receive remote write requests
+		// when --web.enable-remote-write-receiver is enabled.
+		url = strings.TrimSuffix(p.URL, "/") + RemoteWritePath
+	}
+	return p.send(url, metricName, timestamp, point, tags)
+}
+
+func (p *Prometheus) send(url, metricName string, timestamp int64, point float64, tags []string) error {
+	wr := writeRequest{
+		Timeseries: []*timeSeries{
+			{
+				Labels: convertTagsToLabels(SanitizeMetricName(metricName), tags),
+				Samples: []*sample{
+					{
+						Value: point,
+						// NOTE: remote write timestamp is msec scale
+						Timestamp: timestamp * 1000,
+					},
+				},
+			},
+		},
+	}
+
+	b, err := proto.Marshal(&wr)
+	if err != nil {
+		return fmt.Errorf("failed to marshal write request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(snappy.Encode(nil, b)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	p.setAuthHeader(req)
+
+	client, err := p.httpClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("Request error: %s (code=%d, metricName=%s)", string(b), resp.StatusCode, metricName)
+	}
+
 	return nil
 }
 
+// convertTagsToLabels converts "key:value" tags to labels including metric name.
+// Labels are sorted by name as required by remote write protocol.
+func convertTagsToLabels(metricName string, tags []string) []*label {
+	labelMap := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		labelMap[sanitizeLabelName(kv[0])] = kv[1]
+	}
+	labelMap["__name__"] = metricName
+
+	labels := make([]*label, 0, len(labelMap))
+	for k, v := range labelMap {
+		labels = append(labels, &label{Name: k, Value: v})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
 func (p *Prometheus) Fetch(metricName string, timestamp int64, tags []string, opts map[string]interface{}) (float64, error) {
-	return 0.0, nil
+	return p.fetch(p.URL, metricName, timestamp, tags)
+}
+
+func (p *Prometheus) fetch(baseurl, metricName string, timestamp int64, tags []string) (float64, error) {
+	query := buildQuery(metricName, tags)
+
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("time", strconv.FormatInt(timestamp, 10))
+	u := fmt.Sprintf("%s%s?%s", strings.TrimSuffix(baseurl, "/"), QueryPath, values.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0.0, err
+	}
+	p.setAuthHeader(req)
+
+	client, err := p.httpClient()
+	if err != nil {
+		return 0.0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0.0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return 0.0, err
+		}
+		return 0.0, fmt.Errorf("Request error: %s (code=%d, query=%s)", string(b), resp.StatusCode, query)
+	}
+
+	var qr queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&qr); err != nil {
+		return 0.0, fmt.Errorf("decode failed: %w", err)
+	}
+	if qr.Status != "success" {
+		return 0.0, fmt.Errorf("query failed: %s: %s (query=%s)", qr.ErrorType, qr.Error, query)
+	}
+
+	return sumQueryResult(&qr.Data)
+}
+
+// sumQueryResult sums up all samples in the result of instant query.
+func sumQueryResult(data *queryData) (float64, error) {
+	switch data.ResultType {
+	case "vector":
+		var samples []vectorSample
+		if err := json.Unmarshal(data.Result, &samples); err != nil {
+			return 0.0, fmt.Errorf("decode failed: %w", err)
+		}
+		if len(samples) == 0 {
+			return 0.0, fmt.Errorf("no datapoint is found")
+		}
+		var sum float64
+		for _, s := range samples {
+			v, err := parseSampleValue(s.Value)
+			if err != nil {
+				return 0.0, err
+			}
+			sum += v
+		}
+		return sum, nil
+	case "scalar":
+		var value []interface{}
+		if err := json.Unmarshal(data.Result, &value); err != nil {
+			return 0.0, fmt.Errorf("decode failed: %w", err)
+		}
+		return parseSampleValue(value)
+	}
+	return 0.0, fmt.Errorf("unsupported result type: %s", data.ResultType)
+}
+
+// parseSampleValue parses [ <unixtime>, "<value>" ] pair.
+func parseSampleValue(value []interface{}) (float64, error) {
+	if len(value) < 2 {
+		return 0.0, fmt.Errorf("invalid sample value: %v", value)
+	}
+	s, ok := value[1].(string)
+	if !ok {
+		return 0.0, fmt.Errorf("invalid sample value: %v", value)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// buildQuery generates PromQL from metric name and tags.
+// Tags formatted as "key:value" are translated into label matchers,
+// and counter metrics (suffixed by "_total") are wrapped by rate().
+// ex.) sum(container_cpu_usage_seconds_total) with ["kube_namespace:default", "kube_deployment:nginx"] is translated into
+// sum(rate(container_cpu_usage_seconds_total{namespace="default",pod=~"nginx-[a-z0-9]+-[a-z0-9]+",container!="",container!="POD"}[5m])).
+func buildQuery(metricName string, tags []string) string {
+	var aggregator string
+	if strings.HasPrefix(metricName, "sum(") && strings.HasSuffix(metricName, ")") {
+		aggregator = "sum"
+		metricName = strings.TrimSuffix(strings.TrimPrefix(metricName, "sum("), ")")
+	}
+
+	matchers := convertTagsToMatchers(tags)
+	if isCAdvisorMetric(metricName) {
+		matchers = append(matchers, containerMatchers...)
+	}
+	selector := metricName + "{" + strings.Join(matchers, ",") + "}"
+	if strings.HasSuffix(metricName, "_total") {
+		selector = fmt.Sprintf("rate(%s[%s])", selector, RateRange)
+	}
+
+	if aggregator != "" {
+		return aggregator + "(" + selector + ")"
+	}
+	return selector
+}
+
+// convertTagsToMatchers converts "key:value" tags to `key="value"` label matchers.
+// Tags of Kubernetes resources are converted into the labels of Kubernetes series
+// (see tagLabelNames and podNamePatterns).
+func convertTagsToMatchers(tags []string) []string {
+	matchers := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		name := sanitizeLabelName(kv[0])
+		if _, ok := droppedTags[name]; ok {
+			continue
+		}
+		if pattern, ok := podNamePatterns[name]; ok {
+			matchers = append(matchers, fmt.Sprintf("pod=~%s", strconv.Quote(pattern(kv[1]))))
+			continue
+		}
+		if label, ok := tagLabelNames[name]; ok {
+			name = label
+		}
+		matchers = append(matchers, fmt.Sprintf("%s=%s", name, strconv.Quote(kv[1])))
+	}
+	return matchers
+}
+
+// isCAdvisorMetric returns true if metricName is a series of cAdvisor used for Resource metrics.
+func isCAdvisorMetric(metricName string) bool {
+	for _, mi := range resourceMetricMap {
+		if mi.name == metricName {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeMetricName replaces characters which are not allowed in metric name.
+// ex.) ake.ihpa.forecasted_nginx_connections_active.raw -> ake_ihpa_forecasted_nginx_connections_active_raw
+func SanitizeMetricName(name string) string {
+	name = invalidMetricNameChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// sanitizeLabelName replaces characters which are not allowed in label name.
+func sanitizeLabelName(name string) string {
+	name = invalidLabelNameChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func (p *Prometheus) setAuthHeader(req *http.Request) {
+	if p.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.BearerToken)
+	} else if p.BasicAuth != nil {
+		req.SetBasicAuth(p.BasicAuth.Username, p.BasicAuth.Password)
+	}
+}
+
+// httpClient returns the client built by NewPrometheus.
+// The client is built at every call if p is not created by NewPrometheus.
+func (p *Prometheus) httpClient() (*http.Client, error) {
+	if p.client != nil || p.clientErr != nil {
+		return p.client, p.clientErr
+	}
+	return p.newHTTPClient()
+}
+
+func (p *Prometheus) newHTTPClient() (*http.Client, error) {
+	if p.TLSConfig == nil {
+		return &http.Client{Timeout: requestTimeout}, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         p.TLSConfig.ServerName,
+		InsecureSkipVerify: p.TLSConfig.InsecureSkipVerify,
+	}
+	if p.TLSConfig.CA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(p.TLSConfig.CA)) {
+			return nil, fmt.Errorf("failed to parse CA certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if p.TLSConfig.Cert != "" || p.TLSConfig.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(p.TLSConfig.Cert), []byte(p.TLSConfig.Key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
 }
 
 func (p *Prometheus) ConvertResourceMetricName(metricName string, reverse bool) metricprovider.MetricIdentifier {
@@ -72,5 +479,5 @@ func (p *Prometheus) ConvertPodsMetricName(metricName string, reverse bool) metr
 }
 
 func (p *Prometheus) AddSumAggregator(metricName string) string {
-	return metricName
+	return "sum(" + metricName + ")"
 }
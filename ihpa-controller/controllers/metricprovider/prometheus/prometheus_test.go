@@ -0,0 +1,250 @@
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+func TestBuildQuery(t *testing.T) {
+	tests := []struct {
+		metricName string
+		tags       []string
+		expected   string
+	}{
+		{
+			metricName: "nginx_connections_active",
+			tags:       nil,
+			expected:   `nginx_connections_active{}`,
+		},
+		{
+			// tags generated by the controller are converted into labels of cAdvisor
+			metricName: "sum(container_memory_working_set_bytes)",
+			tags:       []string{"kube_system_uid:0123", "kube_namespace:loadtest", "kube_deployment:nginx"},
+			expected:   `sum(container_memory_working_set_bytes{namespace="loadtest",pod=~"nginx-[a-z0-9]+-[a-z0-9]+",container!="",container!="POD"})`,
+		},
+		{
+			metricName: "sum(container_cpu_usage_seconds_total)",
+			tags:       []string{"kube.namespace:loadtest", "kube_statefulset:web.v1", "invalid"},
+			expected:   `sum(rate(container_cpu_usage_seconds_total{namespace="loadtest",pod=~"web\\.v1-[0-9]+",container!="",container!="POD"}[5m]))`,
+		},
+		{
+			metricName: "sum(nginx_http_requests_total)",
+			tags:       []string{"kube_namespace:loadtest", "service:nginx"},
+			expected:   `sum(rate(nginx_http_requests_total{namespace="loadtest",service="nginx"}[5m]))`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := buildQuery(tt.metricName, tt.tags)
+		if got != tt.expected {
+			t.Fatalf("query is not match (got=%s, exp=%s)", got, tt.expected)
+		}
+	}
+}
+
+func TestPodNamePatterns(t *testing.T) {
+	tests := []struct {
+		tag      string
+		pod      string
+		expected bool
+	}{
+		{tag: "kube_deployment", pod: "nginx-5d8f8d6b9c-2xkqp", expected: true},
+		{tag: "kube_deployment", pod: "nginx-api-5d8f8d6b9c-2xkqp", expected: false},
+		{tag: "kube_deployment", pod: "nginx-0", expected: false},
+		{tag: "kube_statefulset", pod: "nginx-0", expected: true},
+		{tag: "kube_statefulset", pod: "nginx-api-0", expected: false},
+		{tag: "kube_replicaset", pod: "nginx-2xkqp", expected: true},
+	}
+
+	for _, tt := range tests {
+		// regex matchers of PromQL are fully anchored
+		re := regexp.MustCompile("^(?:" + podNamePatterns[tt.tag]("nginx") + ")$")
+		if got := re.MatchString(tt.pod); got != tt.expected {
+			t.Fatalf("result of match is not match (tag=%s, pod=%s, got=%v, exp=%v)", tt.tag, tt.pod, got, tt.expected)
+		}
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "kube_namespace", expected: "kube_namespace"},
+		{input: "kube-system.uid", expected: "kube_system_uid"},
+		{input: "1st", expected: "_1st"},
+	}
+
+	for _, tt := range tests {
+		got := sanitizeLabelName(tt.input)
+		if got != tt.expected {
+			t.Fatalf("label name is not match (got=%s, exp=%s)", got, tt.expected)
+		}
+	}
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "ake.ihpa.forecasted_nginx_connections_active", expected: "ake_ihpa_forecasted_nginx_connections_active"},
+		{input: "ake.ihpa.forecasted_container_cpu_usage_seconds_total.upper", expected: "ake_ihpa_forecasted_container_cpu_usage_seconds_total_upper"},
+		{input: "nginx:requests-per-second", expected: "nginx:requests_per_second"},
+		{input: "2xx_responses", expected: "_2xx_responses"},
+	}
+
+	for _, tt := range tests {
+		got := SanitizeMetricName(tt.input)
+		if got != tt.expected {
+			t.Fatalf("metric name is not match (got=%s, exp=%s)", got, tt.expected)
+		}
+	}
+}
+
+func TestConvertTagsToLabels(t *testing.T) {
+	got := convertTagsToLabels("test_metric", []string{"kube_namespace:loadtest", "kube-deployment:nginx", "invalid"})
+	expected := []*label{
+		{Name: "__name__", Value: "test_metric"},
+		{Name: "kube_deployment", Value: "nginx"},
+		{Name: "kube_namespace", Value: "loadtest"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("labels are not match (got=%v, exp=%v)", got, expected)
+	}
+}
+
+func TestPrometheusRequest(t *testing.T) {
+	contents := []struct {
+		query      string
+		bodyPath   string
+		statusCode int
+	}{
+		{
+			query:      `sum(rate(container_cpu_usage_seconds_total{namespace="loadtest",pod=~"nginx-[a-z0-9]+-[a-z0-9]+",container!="",container!="POD"}[5m]))`,
+			bodyPath:   "testdata/query/container_cpu_usage_seconds_total.json",
+			statusCode: http.StatusOK,
+		},
+		{
+			query:      `sum(container_memory_working_set_bytes{namespace="loadtest",container!="",container!="POD"})`,
+			bodyPath:   "testdata/query/bad_data.json",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		for _, c := range contents {
+			if r.URL.Query().Get("query") != c.query {
+				continue
+			}
+			w.WriteHeader(c.statusCode)
+			body, err := os.Open(c.bodyPath)
+			if err != nil {
+				fmt.Fprintf(w, `{"error": "file open error: %s"}`, c.bodyPath)
+				return
+			}
+			io.Copy(w, body)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	var received writeRequest
+	mux.HandleFunc("/api/v1/write", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := proto.Unmarshal(b, &received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	testPrometheusFetch(server.URL, t)
+	testPrometheusSend(server.URL, &received, t)
+}
+
+func testPrometheusFetch(url string, t *testing.T) {
+	p := NewPrometheus(url, "", "", &BasicAuth{Username: "user", Password: "pass"}, nil)
+	ts := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC).Unix()
+
+	point, err := p.Fetch("sum(container_cpu_usage_seconds_total)", ts, []string{"kube_system_uid:0123", "kube_namespace:loadtest", "kube_deployment:nginx"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if point != 0.375 {
+		t.Fatalf("point is not match (got=%f, exp=%f)", point, 0.375)
+	}
+
+	if _, err := p.Fetch("sum(container_memory_working_set_bytes)", ts, []string{"kube_namespace:loadtest"}, nil); err == nil {
+		t.Fatalf("error is expected for bad query")
+	}
+
+	unauthorized := &Prometheus{URL: url}
+	if _, err := unauthorized.Fetch("sum(container_cpu_usage_seconds_total)", ts, []string{"kube_namespace:loadtest", "kube_deployment:nginx"}, nil); err == nil {
+		t.Fatalf("error is expected for unauthorized request")
+	}
+}
+
+func testPrometheusSend(url string, received *writeRequest, t *testing.T) {
+	p := &Prometheus{URL: url}
+	ts := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC).Unix()
+
+	err := p.Send("ake.ihpa.forecasted_nginx_connections_active.raw", ts, 12.5, []string{"kube_namespace:loadtest"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := writeRequest{
+		Timeseries: []*timeSeries{
+			{
+				Labels: []*label{
+					{Name: "__name__", Value: "ake_ihpa_forecasted_nginx_connections_active_raw"},
+					{Name: "kube_namespace", Value: "loadtest"},
+				},
+				Samples: []*sample{
+					{Value: 12.5, Timestamp: ts * 1000},
+				},
+			},
+		},
+	}
+	if !proto.Equal(received, &expected) {
+		t.Fatalf("write request is not match (got=%v, exp=%v)", received, &expected)
+	}
+
+	notFound := &Prometheus{URL: url, RemoteWriteURL: url + "/not_found"}
+	if err := notFound.Send("test", ts, 1.0, nil, nil); err == nil {
+		t.Fatalf("error is expected for invalid endpoint")
+	}
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "ihpa"
+
+const (
+	providerOperationSend  = "send"
+	providerOperationFetch = "fetch"
+)
+
+// forecastValueTypes is values of type label of forecast value metric.
+var forecastValueTypes = []string{"adjusted", "raw", "upper", "lower"}
+
+var (
+	shadowRecommendedReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "shadow",
+		Name:      "recommended_replicas",
+		Help:      "Replicas recommended by forecasted metrics of the IHPA in shadow mode.",
+	}, []string{"namespace", "ihpa"})
+	shadowHPADesiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "shadow",
+		Name:      "hpa_desired_replicas",
+		Help:      "Desired replicas of the HPA generated from the IHPA in shadow mode.",
+	}, []string{"namespace", "ihpa"})
+
+	forecastValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "estimator",
+		Name:      "forecast_value",
+		Help:      "The latest forecasted value sent by the estimator.",
+	}, []string{"namespace", "ihpa", "estimator", "type"})
+	adjustCorrection = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "estimator",
+		Name:      "adjust_correction",
+		Help:      "Difference between the adjusted value and the raw forecasted value of the latest send in adjust mode.",
+	}, []string{"namespace", "ihpa", "estimator"})
+	horizonRemainingSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "estimator",
+		Name:      "horizon_remaining_seconds",
+		Help:      "Seconds until the end of forecasted data loaded in the estimator.",
+	}, []string{"namespace", "ihpa", "estimator"})
+	activeEstimators = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_estimators",
+		Help:      "Number of estimators of the IHPA whose forecasted data covers the current time.",
+	}, []string{"namespace", "ihpa"})
+	fittingJobSecondsSinceLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "fittingjob",
+		Name:      "seconds_since_last_success",
+		Help:      "Seconds since the latest successful fitting job completed.",
+	}, []string{"namespace", "ihpa", "fittingjob"})
+
+	providerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "provider",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests to metric provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"namespace", "ihpa", "provider", "operation"})
+	providerRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "provider",
+		Name:      "request_errors_total",
+		Help:      "Number of failed requests to metric provider.",
+	}, []string{"namespace", "ihpa", "provider", "operation"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		shadowRecommendedReplicas,
+		shadowHPADesiredReplicas,
+		forecastValue,
+		adjustCorrection,
+		horizonRemainingSeconds,
+		activeEstimators,
+		fittingJobSecondsSinceLastSuccess,
+		providerRequestDuration,
+		providerRequestErrors,
+	)
+}
+
+// recordShadowMetrics exports the shadow status of the IHPA.
+// The recommended replicas are removed while no forecast is available.
+func recordShadowMetrics(namespace, name string, status *ihpav1beta2.ShadowStatus) {
+	if status.RecommendedReplicas != nil {
+		shadowRecommendedReplicas.WithLabelValues(namespace, name).Set(float64(*status.RecommendedReplicas))
+	} else {
+		shadowRecommendedReplicas.DeleteLabelValues(namespace, name)
+	}
+	shadowHPADesiredReplicas.WithLabelValues(namespace, name).Set(float64(status.HPADesiredReplicas))
+}
+
+// deleteShadowMetrics removes the shadow metrics of the IHPA.
+func deleteShadowMetrics(namespace, name string) {
+	shadowRecommendedReplicas.DeleteLabelValues(namespace, name)
+	shadowHPADesiredReplicas.DeleteLabelValues(namespace, name)
+}
+
+// recordForecastMetrics exports the values sent by the estimator.
+// The correction is exported only when the value is adjusted.
+func (et *EstimateTarget) recordForecastMetrics(datum *EstimateDatum, adjustedYHat float64, adjusted bool) {
+	values := []float64{adjustedYHat, datum.YHat, datum.UpperYHat, datum.LowerYHat}
+	for i, t := range forecastValueTypes {
+		forecastValue.WithLabelValues(et.Namespace, et.IHPAName, et.Name, t).Set(values[i])
+	}
+	if adjusted {
+		adjustCorrection.WithLabelValues(et.Namespace, et.IHPAName, et.Name).Set(adjustedYHat - datum.YHat)
+	}
+}
+
+// observeProviderRequest records the latency and the error of a request to metric provider.
+func (et *EstimateTarget) observeProviderRequest(operation string, start time.Time, err error) {
+	providerRequestDuration.WithLabelValues(et.Namespace, et.IHPAName, et.ProviderName, operation).
+		Observe(time.Since(start).Seconds())
+	if err != nil {
+		providerRequestErrors.WithLabelValues(et.Namespace, et.IHPAName, et.ProviderName, operation).Inc()
+	}
+}
+
+// deleteEstimatorMetrics removes the metrics exported by the estimator.
+func (et *EstimateTarget) deleteEstimatorMetrics() {
+	for _, t := range forecastValueTypes {
+		forecastValue.DeleteLabelValues(et.Namespace, et.IHPAName, et.Name, t)
+	}
+	adjustCorrection.DeleteLabelValues(et.Namespace, et.IHPAName, et.Name)
+}
+
+// recordIHPAMetrics exports the state of estimators and fitting jobs of the IHPA.
+func recordIHPAMetrics(ihpa *ihpav1beta2.IntelligentHorizontalPodAutoscaler, src *ihpaStatusSource, fittingJobs map[string]*ihpav1beta2.FittingJobStatus, now time.Time) {
+	namespace, name := ihpa.GetNamespace(), ihpa.GetName()
+	active := 0
+	if src.children != nil {
+		for _, m := range src.children.metrics {
+			snapshot, ok := src.snapshots[m.estimatorName]
+			if ok && !snapshot.HorizonEnd.IsZero() {
+				horizonRemainingSeconds.WithLabelValues(namespace, name, m.estimatorName).Set(snapshot.HorizonEnd.Sub(now).Seconds())
+				if snapshot.HorizonEnd.After(now) {
+					active++
+				}
+			} else {
+				horizonRemainingSeconds.DeleteLabelValues(namespace, name, m.estimatorName)
+			}
+			if status, ok := fittingJobs[m.fittingJobName]; ok && status.LastSuccessfulTime != nil {
+				fittingJobSecondsSinceLastSuccess.WithLabelValues(namespace, name, m.fittingJobName).
+					Set(now.Sub(status.LastSuccessfulTime.Time).Seconds())
+			} else {
+				fittingJobSecondsSinceLastSuccess.DeleteLabelValues(namespace, name, m.fittingJobName)
+			}
+		}
+	}
+	activeEstimators.WithLabelValues(namespace, name).Set(float64(active))
+}
+
+// deleteChildMetrics removes the metrics of a generated resource when it is deleted.
+func deleteChildMetrics(namespace, ihpaName, kind, name string) {
+	switch kind {
+	case estimatorKind:
+		horizonRemainingSeconds.DeleteLabelValues(namespace, ihpaName, name)
+	case fittingJobKind:
+		fittingJobSecondsSinceLastSuccess.DeleteLabelValues(namespace, ihpaName, name)
+	}
+}
+
+// deleteIHPAMetrics removes the metrics of the IHPA itself when it is deleted.
+func deleteIHPAMetrics(namespace, name string) {
+	deleteShadowMetrics(namespace, name)
+	activeEstimators.DeleteLabelValues(namespace, name)
+	for _, provider := range []string{"datadog", "prometheus"} {
+		for _, operation := range []string{providerOperationSend, providerOperationFetch} {
+			providerRequestDuration.DeleteLabelValues(namespace, name, provider, operation)
+			providerRequestErrors.DeleteLabelValues(namespace, name, provider, operation)
+		}
+	}
+}
+
+// metricProviderName returns the name of the provider used by the MetricProvider.
+func metricProviderName(mp *ihpav1beta2.MetricProvider) string {
+	switch {
+	case mp.Datadog != nil:
+		return "datadog"
+	case mp.Prometheus != nil:
+		return "prometheus"
+	}
+	return mp.Name
+}
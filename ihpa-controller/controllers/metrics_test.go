@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEstimatorMetrics(t *testing.T) {
+	et := &EstimateTarget{Namespace: "metrics", Name: "ihpa-nginx-cpu", IHPAName: "nginx", ProviderName: "datadog"}
+	et.recordForecastMetrics(&EstimateDatum{YHat: 10, UpperYHat: 20, LowerYHat: 5}, 12, true)
+
+	expected := map[string]float64{"adjusted": 12, "raw": 10, "upper": 20, "lower": 5}
+	for typ, exp := range expected {
+		if got := testutil.ToFloat64(forecastValue.WithLabelValues("metrics", "nginx", "ihpa-nginx-cpu", typ)); got != exp {
+			t.Fatalf("forecast value is not match (type=%s, got=%v, exp=%v)", typ, got, exp)
+		}
+	}
+	if got := testutil.ToFloat64(adjustCorrection.WithLabelValues("metrics", "nginx", "ihpa-nginx-cpu")); got != 2 {
+		t.Fatalf("adjust correction is not match (got=%v, exp=%v)", got, 2)
+	}
+
+	et.observeProviderRequest(providerOperationSend, time.Now(), nil)
+	et.observeProviderRequest(providerOperationSend, time.Now(), fmt.Errorf("connection refused"))
+	if got := testutil.ToFloat64(providerRequestErrors.WithLabelValues("metrics", "nginx", "datadog", providerOperationSend)); got != 1 {
+		t.Fatalf("provider errors are not match (got=%v, exp=%v)", got, 1)
+	}
+
+	et.deleteEstimatorMetrics()
+	// deletion succeeds only if the metric exists
+	if forecastValue.DeleteLabelValues("metrics", "nginx", "ihpa-nginx-cpu", "raw") {
+		t.Fatalf("forecast value is not deleted")
+	}
+}
+
+func TestRecordIHPAMetrics(t *testing.T) {
+	now := time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)
+	ihpa := &ihpav1beta2.IntelligentHorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Namespace: "metrics", Name: "nginx"}}
+	src := &ihpaStatusSource{
+		children: &ihpaChildren{
+			metrics: []ihpaMetricChildren{
+				{metricName: "cpu", fittingJobName: "ihpa-nginx-cpu", estimatorName: "ihpa-nginx-cpu"},
+				{metricName: "memory", fittingJobName: "ihpa-nginx-memory", estimatorName: "ihpa-nginx-memory"},
+			},
+		},
+		snapshots: map[string]ForecastSnapshot{
+			"ihpa-nginx-cpu":    {HorizonEnd: now.Add(time.Hour)},
+			"ihpa-nginx-memory": {HorizonEnd: now.Add(-time.Minute)},
+		},
+	}
+	lastSuccess := metav1.NewTime(now.Add(-2 * time.Hour))
+	fittingJobs := map[string]*ihpav1beta2.FittingJobStatus{
+		"ihpa-nginx-cpu": {LastSuccessfulTime: &lastSuccess},
+	}
+
+	recordIHPAMetrics(ihpa, src, fittingJobs, now)
+	if got := testutil.ToFloat64(horizonRemainingSeconds.WithLabelValues("metrics", "nginx", "ihpa-nginx-cpu")); got != 3600 {
+		t.Fatalf("horizon remaining seconds is not match (got=%v, exp=%v)", got, 3600)
+	}
+	if got := testutil.ToFloat64(activeEstimators.WithLabelValues("metrics", "nginx")); got != 1 {
+		t.Fatalf("active estimators is not match (got=%v, exp=%v)", got, 1)
+	}
+	if got := testutil.ToFloat64(fittingJobSecondsSinceLastSuccess.WithLabelValues("metrics", "nginx", "ihpa-nginx-cpu")); got != 7200 {
+		t.Fatalf("seconds since last success is not match (got=%v, exp=%v)", got, 7200)
+	}
+	// fitting job which has never succeeded is not exported
+	if fittingJobSecondsSinceLastSuccess.DeleteLabelValues("metrics", "nginx", "ihpa-nginx-memory") {
+		t.Fatalf("seconds since last success is exported for fitting job without success")
+	}
+
+	deleteChildMetrics("metrics", "nginx", estimatorKind, "ihpa-nginx-cpu")
+	deleteChildMetrics("metrics", "nginx", estimatorKind, "ihpa-nginx-memory")
+	deleteChildMetrics("metrics", "nginx", fittingJobKind, "ihpa-nginx-cpu")
+	deleteIHPAMetrics("metrics", "nginx")
+	if horizonRemainingSeconds.DeleteLabelValues("metrics", "nginx", "ihpa-nginx-cpu") ||
+		horizonRemainingSeconds.DeleteLabelValues("metrics", "nginx", "ihpa-nginx-memory") ||
+		activeEstimators.DeleteLabelValues("metrics", "nginx") ||
+		fittingJobSecondsSinceLastSuccess.DeleteLabelValues("metrics", "nginx", "ihpa-nginx-cpu") {
+		t.Fatalf("metrics of the ihpa are not deleted")
+	}
+}
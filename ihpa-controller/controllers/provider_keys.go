@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DatadogAPIKeyEnv and DatadogAPPKeyEnv are variable names searched in KeysFrom.
+	// The name is prefixed by EnvFromSource.Prefix same as envFrom of container.
+	DatadogAPIKeyEnv = "APIKey"
+	DatadogAPPKeyEnv = "APPKey"
+)
+
+// resolveMetricProvider returns a copy of MetricProvider whose keys are filled from KeysFrom
+// and whose Prometheus credentials are filled from the Secrets.
+// Keys written in the spec directly take precedence over KeysFrom.
+func resolveMetricProvider(ctx context.Context, c client.Reader, namespace string, mp *ihpav1beta2.MetricProvider) (*ihpav1beta2.MetricProvider, error) {
+	resolved := mp.DeepCopy()
+	if prom := resolved.ProviderSource.Prometheus; prom != nil {
+		if err := resolvePrometheusCredentials(ctx, c, namespace, prom); err != nil {
+			return nil, err
+		}
+	}
+
+	dd := resolved.ProviderSource.Datadog
+	if dd == nil || len(dd.KeysFrom) == 0 {
+		return resolved, nil
+	}
+
+	vars, err := readEnvFromSources(ctx, c, namespace, dd.KeysFrom)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := vars[DatadogAPIKeyEnv]; ok && dd.APIKey == "" {
+		dd.APIKey = v
+	}
+	if v, ok := vars[DatadogAPPKeyEnv]; ok && dd.APPKey == "" {
+		dd.APPKey = v
+	}
+
+	return resolved, nil
+}
+
+// resolvePrometheusCredentials fills the token, password and client key from the Secrets.
+func resolvePrometheusCredentials(ctx context.Context, c client.Reader, namespace string, prom *ihpav1beta2.PrometheusProviderSource) error {
+	var err error
+	if prom.BearerToken, err = readSecretKey(ctx, c, namespace, prom.BearerTokenSecret); err != nil {
+		return err
+	}
+	if prom.BasicAuth != nil {
+		if prom.BasicAuth.Password, err = readSecretKey(ctx, c, namespace, prom.BasicAuth.PasswordSecret); err != nil {
+			return err
+		}
+	}
+	if prom.TLSConfig != nil {
+		if prom.TLSConfig.Key, err = readSecretKey(ctx, c, namespace, prom.TLSConfig.KeySecret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSecretKey reads the value of the key in Secret same as secretKeyRef of container.
+// An empty string is returned if selector is nil, or the optional Secret or key is not found.
+func readSecretKey(ctx context.Context, c client.Reader, namespace string, selector *corev1.SecretKeySelector) (string, error) {
+	if selector == nil {
+		return "", nil
+	}
+	var secret corev1.Secret
+	key := types.NamespacedName{Namespace: namespace, Name: selector.Name}
+	if err := c.Get(ctx, key, &secret); err != nil {
+		if apierrors.IsNotFound(err) && isOptional(selector.Optional) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get secret %s: %w", key, err)
+	}
+	v, ok := secret.Data[selector.Key]
+	if !ok {
+		if isOptional(selector.Optional) {
+			return "", nil
+		}
+		return "", fmt.Errorf("key %s is not found in secret %s", selector.Key, key)
+	}
+	return string(v), nil
+}
+
+// readEnvFromSources reads variables from Secrets and ConfigMaps same as envFrom of container.
+// When a key exists in multiple sources, the value associated with the last source will take precedence.
+func readEnvFromSources(ctx context.Context, c client.Reader, namespace string, sources []corev1.EnvFromSource) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, src := range sources {
+		switch {
+		case src.SecretRef != nil:
+			var secret corev1.Secret
+			key := types.NamespacedName{Namespace: namespace, Name: src.SecretRef.Name}
+			if err := c.Get(ctx, key, &secret); err != nil {
+				if apierrors.IsNotFound(err) && isOptional(src.SecretRef.Optional) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get secret %s: %w", key, err)
+			}
+			for k, v := range secret.Data {
+				vars[src.Prefix+k] = string(v)
+			}
+		case src.ConfigMapRef != nil:
+			var cm corev1.ConfigMap
+			key := types.NamespacedName{Namespace: namespace, Name: src.ConfigMapRef.Name}
+			if err := c.Get(ctx, key, &cm); err != nil {
+				if apierrors.IsNotFound(err) && isOptional(src.ConfigMapRef.Optional) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get configmap %s: %w", key, err)
+			}
+			for k, v := range cm.Data {
+				vars[src.Prefix+k] = v
+			}
+		}
+	}
+	return vars, nil
+}
+
+// referredSourcesIndexField is the field index of Estimator by the Secrets and ConfigMaps referred by the provider.
+const referredSourcesIndexField = ".spec.provider.referredSources"
+
+// referredSources returns the values of referredSourcesIndexField for MetricProvider,
+// which are Secrets and ConfigMaps in KeysFrom of Datadog and Secrets of Prometheus credentials.
+func referredSources(mp *ihpav1beta2.MetricProvider) []string {
+	var sources []string
+	if dd := mp.ProviderSource.Datadog; dd != nil {
+		for _, src := range dd.KeysFrom {
+			if src.SecretRef != nil {
+				sources = append(sources, referredSource(&corev1.Secret{}, src.SecretRef.Name))
+			}
+			if src.ConfigMapRef != nil {
+				sources = append(sources, referredSource(&corev1.ConfigMap{}, src.ConfigMapRef.Name))
+			}
+		}
+	}
+	if prom := mp.ProviderSource.Prometheus; prom != nil {
+		selectors := []*corev1.SecretKeySelector{prom.BearerTokenSecret}
+		if prom.BasicAuth != nil {
+			selectors = append(selectors, prom.BasicAuth.PasswordSecret)
+		}
+		if prom.TLSConfig != nil {
+			selectors = append(selectors, prom.TLSConfig.KeySecret)
+		}
+		for _, sel := range selectors {
+			if sel != nil {
+				sources = append(sources, referredSource(&corev1.Secret{}, sel.Name))
+			}
+		}
+	}
+	return sources
+}
+
+// referredSource returns the value of referredSourcesIndexField for the Secret or ConfigMap.
+// This returns an empty string for other objects.
+func referredSource(obj interface{}, name string) string {
+	switch obj.(type) {
+	case *corev1.Secret:
+		return "Secret/" + name
+	case *corev1.ConfigMap:
+		return "ConfigMap/" + name
+	}
+	return ""
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
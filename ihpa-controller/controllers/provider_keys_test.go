@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveMetricProvider(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "datadog-keys", Namespace: "default"},
+			Data: map[string][]byte{
+				"APIKey": []byte("secret-api"),
+				"APPKey": []byte("secret-app"),
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "datadog-config", Namespace: "default"},
+			Data: map[string]string{
+				"APIKey": "cm-api",
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "prefixed-keys", Namespace: "default"},
+			Data: map[string][]byte{
+				"APIKey": []byte("prefixed-api"),
+				"Key":    []byte("prefixed-app"),
+			},
+		},
+	)
+
+	tests := []struct {
+		input     *ihpav1beta2.MetricProvider
+		expected  *ihpav1beta2.DatadogProviderSource
+		expectErr bool
+	}{
+		{
+			input: &ihpav1beta2.MetricProvider{
+				ProviderSource: ihpav1beta2.ProviderSource{
+					Datadog: &ihpav1beta2.DatadogProviderSource{APIKey: "xxx", APPKey: "yyy"},
+				},
+			},
+			expected: &ihpav1beta2.DatadogProviderSource{APIKey: "xxx", APPKey: "yyy"},
+		},
+		{
+			// later source takes precedence
+			input: &ihpav1beta2.MetricProvider{
+				ProviderSource: ihpav1beta2.ProviderSource{
+					Datadog: &ihpav1beta2.DatadogProviderSource{
+						KeysFrom: []corev1.EnvFromSource{
+							{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "datadog-keys"}}},
+							{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "datadog-config"}}},
+						},
+					},
+				},
+			},
+			expected: &ihpav1beta2.DatadogProviderSource{APIKey: "cm-api", APPKey: "secret-app"},
+		},
+		{
+			// inline key takes precedence and prefix is applied
+			input: &ihpav1beta2.MetricProvider{
+				ProviderSource: ihpav1beta2.ProviderSource{
+					Datadog: &ihpav1beta2.DatadogProviderSource{
+						APIKey: "inline",
+						KeysFrom: []corev1.EnvFromSource{
+							{Prefix: "APP", SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "prefixed-keys"}}},
+						},
+					},
+				},
+			},
+			expected: &ihpav1beta2.DatadogProviderSource{APIKey: "inline", APPKey: "prefixed-app"},
+		},
+		{
+			input: &ihpav1beta2.MetricProvider{
+				ProviderSource: ihpav1beta2.ProviderSource{
+					Datadog: &ihpav1beta2.DatadogProviderSource{
+						KeysFrom: []corev1.EnvFromSource{
+							{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "none"}, Optional: func(b bool) *bool { return &b }(true)}},
+						},
+					},
+				},
+			},
+			expected: &ihpav1beta2.DatadogProviderSource{},
+		},
+		{
+			input: &ihpav1beta2.MetricProvider{
+				ProviderSource: ihpav1beta2.ProviderSource{
+					Datadog: &ihpav1beta2.DatadogProviderSource{
+						KeysFrom: []corev1.EnvFromSource{
+							{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "none"}}},
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		org := tt.input.DeepCopy()
+		got, err := resolveMetricProvider(context.Background(), c, "default", tt.input)
+		if tt.expectErr {
+			if err == nil {
+				t.Fatalf("error is expected (input=%v)", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotDatadog := got.ProviderSource.Datadog
+		gotDatadog.KeysFrom = nil
+		if !reflect.DeepEqual(gotDatadog, tt.expected) {
+			t.Fatalf("datadog provider source is not match (got=%v, exp=%v)", gotDatadog, tt.expected)
+		}
+		if !reflect.DeepEqual(tt.input, org) {
+			t.Fatalf("input is changed (got=%v, exp=%v)", tt.input, org)
+		}
+	}
+}
+
+func TestResolvePrometheusCredentials(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "prometheus-auth", Namespace: "default"},
+			Data: map[string][]byte{
+				"token":    []byte("secret-token"),
+				"password": []byte("secret-password"),
+				"tls.key":  []byte("secret-key"),
+			},
+		},
+	)
+	selector := func(name, key string, optional bool) *corev1.SecretKeySelector {
+		return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key, Optional: &optional}
+	}
+
+	tests := []struct {
+		input     *ihpav1beta2.PrometheusProviderSource
+		expected  [3]string
+		expectErr bool
+	}{
+		{
+			input: &ihpav1beta2.PrometheusProviderSource{
+				BearerTokenSecret: selector("prometheus-auth", "token", false),
+				BasicAuth:         &ihpav1beta2.PrometheusBasicAuth{Username: "user", PasswordSecret: selector("prometheus-auth", "password", false)},
+				TLSConfig:         &ihpav1beta2.PrometheusTLSConfig{KeySecret: selector("prometheus-auth", "tls.key", false)},
+			},
+			expected: [3]string{"secret-token", "secret-password", "secret-key"},
+		},
+		{
+			input: &ihpav1beta2.PrometheusProviderSource{
+				BearerTokenSecret: selector("none", "token", true),
+				BasicAuth:         &ihpav1beta2.PrometheusBasicAuth{Username: "user", PasswordSecret: selector("prometheus-auth", "none", true)},
+				TLSConfig:         &ihpav1beta2.PrometheusTLSConfig{},
+			},
+		},
+		{
+			input:     &ihpav1beta2.PrometheusProviderSource{BearerTokenSecret: selector("none", "token", false)},
+			expectErr: true,
+		},
+		{
+			input:     &ihpav1beta2.PrometheusProviderSource{BearerTokenSecret: selector("prometheus-auth", "none", false)},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		mp := &ihpav1beta2.MetricProvider{ProviderSource: ihpav1beta2.ProviderSource{Prometheus: tt.input}}
+		got, err := resolveMetricProvider(context.Background(), c, "default", mp)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("error is not match (input=%v, err=%v, expectErr=%v)", tt.input, err, tt.expectErr)
+		}
+		if err != nil {
+			continue
+		}
+		prom := got.ProviderSource.Prometheus
+		var gotCredentials [3]string
+		gotCredentials[0] = prom.BearerToken
+		if prom.BasicAuth != nil {
+			gotCredentials[1] = prom.BasicAuth.Password
+		}
+		if prom.TLSConfig != nil {
+			gotCredentials[2] = prom.TLSConfig.Key
+		}
+		if gotCredentials != tt.expected {
+			t.Fatalf("credentials are not match (got=%v, exp=%v)", gotCredentials, tt.expected)
+		}
+		if mp.ProviderSource.Prometheus.BearerToken != "" {
+			t.Fatalf("input is changed (got=%v)", mp.ProviderSource.Prometheus)
+		}
+	}
+}
+
+func TestReferredSources(t *testing.T) {
+	mp := &ihpav1beta2.MetricProvider{
+		ProviderSource: ihpav1beta2.ProviderSource{
+			Datadog: &ihpav1beta2.DatadogProviderSource{
+				KeysFrom: []corev1.EnvFromSource{
+					{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "datadog-keys"}}},
+					{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "datadog-config"}}},
+				},
+			},
+		},
+	}
+	promMP := &ihpav1beta2.MetricProvider{
+		ProviderSource: ihpav1beta2.ProviderSource{
+			Prometheus: &ihpav1beta2.PrometheusProviderSource{
+				BasicAuth: &ihpav1beta2.PrometheusBasicAuth{
+					Username:       "user",
+					PasswordSecret: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "prometheus-auth"}, Key: "password"},
+				},
+			},
+		},
+	}
+	sources := append(referredSources(mp), referredSources(promMP)...)
+
+	tests := []struct {
+		obj      interface{}
+		name     string
+		expected bool
+	}{
+		{obj: &corev1.Secret{}, name: "datadog-keys", expected: true},
+		{obj: &corev1.Secret{}, name: "other", expected: false},
+		{obj: &corev1.ConfigMap{}, name: "datadog-keys", expected: false},
+		{obj: &corev1.ConfigMap{}, name: "datadog-config", expected: true},
+		{obj: &corev1.Secret{}, name: "prometheus-auth", expected: true},
+		{obj: &corev1.ConfigMap{}, name: "prometheus-auth", expected: false},
+	}
+
+	for _, tt := range tests {
+		source := referredSource(tt.obj, tt.name)
+		var got bool
+		for _, s := range sources {
+			got = got || s == source
+		}
+		if got != tt.expected {
+			t.Fatalf("result is not match (got=%v, exp=%v, name=%s)", got, tt.expected, tt.name)
+		}
+	}
+
+	if got := referredSources(&ihpav1beta2.MetricProvider{}); len(got) != 0 {
+		t.Fatalf("sources should be empty without provider (got=%v)", got)
+	}
+}
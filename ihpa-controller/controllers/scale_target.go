@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	amtypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// scaleTargetContainers returns containers of pods managed by the scale target.
+// Deployment, StatefulSet and ReplicaSet are read from their pod template.
+// Other resources are resolved by the RESTMapper and the scale subresource, and
+// containers of a live pod matched with the selector of the scale subresource are returned.
+// If there is no live pod, this returns no containers without error.
+func (r *IntelligentHorizontalPodAutoscalerReconciler) scaleTargetContainers(
+	ctx context.Context,
+	namespace string,
+	ref *autoscalingv2beta2.CrossVersionObjectReference,
+) ([]corev1.Container, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apiVersion of scaleTargetRef: %w", err)
+	}
+	key := amtypes.NamespacedName{Namespace: namespace, Name: ref.Name}
+
+	// apps workloads are read from cache
+	if gv.Group == "" || gv.Group == appsv1.GroupName || gv.Group == "extensions" {
+		switch ref.Kind {
+		case "Deployment":
+			deployment := &appsv1.Deployment{}
+			if err := r.Get(ctx, key, deployment); err != nil {
+				return nil, err
+			}
+			return deployment.Spec.Template.Spec.Containers, nil
+		case "StatefulSet":
+			statefulset := &appsv1.StatefulSet{}
+			if err := r.Get(ctx, key, statefulset); err != nil {
+				return nil, err
+			}
+			return statefulset.Spec.Template.Spec.Containers, nil
+		case "ReplicaSet":
+			replicaset := &appsv1.ReplicaSet{}
+			if err := r.Get(ctx, key, replicaset); err != nil {
+				return nil, err
+			}
+			return replicaset.Spec.Template.Spec.Containers, nil
+		}
+	}
+
+	if r.RESTMapper == nil || r.ScaleClient == nil {
+		return nil, fmt.Errorf("%s is not supported as scale target", ref.Kind)
+	}
+	gk := schema.GroupKind{Group: gv.Group, Kind: ref.Kind}
+	mapping, err := r.RESTMapper.RESTMapping(gk, gv.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource of scale target %s: %w", gk, err)
+	}
+	scale, err := r.ScaleClient.Scales(namespace).Get(mapping.Resource.GroupResource(), ref.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scale subresource of %s %s: %w", gk, ref.Name, err)
+	}
+	if scale.Status.Selector == "" {
+		return nil, fmt.Errorf("scale subresource of %s %s has no selector", gk, ref.Name)
+	}
+	selector, err := labels.Parse(scale.Status.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of scale subresource: %w", err)
+	}
+
+	// pods are read directly to avoid caching all pods in the cluster
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	var pods corev1.PodList
+	if err := reader.List(ctx, &pods,
+		client.InNamespace(namespace),
+		client.MatchingLabelsSelector{Selector: selector},
+	); err != nil {
+		return nil, fmt.Errorf("failed to get list of pods of %s %s: %w", gk, ref.Name, err)
+	}
+	for i := range pods.Items {
+		if pods.Items[i].GetDeletionTimestamp().IsZero() {
+			return pods.Items[i].Spec.Containers, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	fakescale "k8s.io/client-go/scale/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScaleTargetContainers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	podSpec := func(name string) corev1.PodSpec {
+		return corev1.PodSpec{Containers: []corev1.Container{{Name: name}}}
+	}
+	now := metav1.Now()
+	c := fake.NewFakeClientWithScheme(scheme,
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec("deployment")}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "rollout-terminating",
+				Namespace:         "default",
+				Labels:            map[string]string{"app": "rollout"},
+				DeletionTimestamp: &now,
+			},
+			Spec: podSpec("terminating"),
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "rollout-running",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "rollout"},
+			},
+			Spec: podSpec("rollout"),
+		},
+	)
+
+	rolloutGV := schema.GroupVersion{Group: "argoproj.io", Version: "v1alpha1"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{rolloutGV})
+	mapper.Add(rolloutGV.WithKind("Rollout"), meta.RESTScopeNamespace)
+	mapper.Add(rolloutGV.WithKind("Canary"), meta.RESTScopeNamespace)
+
+	scaleClient := &fakescale.FakeScaleClient{}
+	scaleClient.AddReactor("get", "rollouts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &autoscalingv1.Scale{Status: autoscalingv1.ScaleStatus{Selector: "app=rollout"}}, nil
+	})
+	scaleClient.AddReactor("get", "canaries", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &autoscalingv1.Scale{Status: autoscalingv1.ScaleStatus{Selector: "app=nopods"}}, nil
+	})
+
+	r := &IntelligentHorizontalPodAutoscalerReconciler{
+		Client:      c,
+		RESTMapper:  mapper,
+		ScaleClient: scaleClient,
+	}
+
+	tests := []struct {
+		ref       autoscalingv2beta2.CrossVersionObjectReference
+		expected  string
+		expectErr bool
+	}{
+		{
+			ref:      autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx"},
+			expected: "deployment",
+		},
+		{
+			ref:      autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "rollout"},
+			expected: "rollout",
+		},
+		{
+			// no live pods
+			ref:      autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Canary", Name: "canary"},
+			expected: "",
+		},
+		{
+			ref:       autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "example.com/v1", Kind: "Unknown", Name: "unknown"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		containers, err := r.scaleTargetContainers(context.Background(), "default", &tt.ref)
+		if tt.expectErr {
+			if err == nil {
+				t.Fatalf("error is expected (ref=%v)", tt.ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if len(containers) != 0 {
+			got = containers[0].Name
+		}
+		if got != tt.expected {
+			t.Fatalf("container is not match (got=%s, exp=%s)", got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+)
+
+// scheduledOverride is ScheduledOverride whose schedule and time zone are parsed.
+type scheduledOverride struct {
+	ihpav1beta2.ScheduledOverride
+	schedule *cronSchedule
+	location *time.Location
+	// multiplier is ForecastMultiplier as float. This is 0 if ForecastMultiplier is not specified.
+	multiplier float64
+}
+
+// newScheduledOverride parses the schedule and the time zone of the override.
+func newScheduledOverride(o *ihpav1beta2.ScheduledOverride) (*scheduledOverride, error) {
+	so := &scheduledOverride{ScheduledOverride: *o.DeepCopy(), location: time.UTC}
+
+	switch {
+	case o.Schedule != "" && (o.Start != nil || o.End != nil):
+		return nil, fmt.Errorf("only one of schedule or start/end can be specified")
+	case o.Schedule != "":
+		if o.DurationMinutes <= 0 {
+			return nil, fmt.Errorf("durationMinutes must be specified with schedule")
+		}
+		schedule, err := parseCronSchedule(o.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule: %w", err)
+		}
+		so.schedule = schedule
+	case o.Start != nil && o.End != nil:
+		if !o.Start.Before(o.End) {
+			return nil, fmt.Errorf("start must be before end")
+		}
+	default:
+		return nil, fmt.Errorf("schedule or both of start and end must be specified")
+	}
+
+	if o.TimeZone != "" {
+		loc, err := time.LoadLocation(o.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone: %w", err)
+		}
+		so.location = loc
+	}
+
+	if o.MinReplicas == nil && o.ForecastMultiplier == nil {
+		return nil, fmt.Errorf("minReplicas or forecastMultiplier must be specified")
+	}
+	if o.ForecastMultiplier != nil {
+		so.multiplier = float64(o.ForecastMultiplier.MilliValue()) / 1000
+		if so.multiplier <= 0 {
+			return nil, fmt.Errorf("forecastMultiplier must be positive")
+		}
+	}
+	return so, nil
+}
+
+// newScheduledOverrides parses all overrides.
+func newScheduledOverrides(overrides []ihpav1beta2.ScheduledOverride) ([]*scheduledOverride, error) {
+	sos := make([]*scheduledOverride, 0, len(overrides))
+	for i := range overrides {
+		so, err := newScheduledOverride(&overrides[i])
+		if err != nil {
+			return nil, fmt.Errorf("scheduled override %s: %w", overrides[i].Name, err)
+		}
+		sos = append(sos, so)
+	}
+	return sos, nil
+}
+
+// activeAt returns true if t is in a window of the override.
+func (so *scheduledOverride) activeAt(t time.Time) bool {
+	if so.schedule == nil {
+		return !t.Before(so.Start.Time) && t.Before(so.End.Time)
+	}
+	// the window is active if it starts in (t - duration, t]
+	duration := time.Duration(so.DurationMinutes) * time.Minute
+	start := so.schedule.next(t.In(so.location).Add(-duration))
+	return !start.IsZero() && !start.After(t)
+}
+
+// nextTransition returns the first time after t when a window of the override starts or ends.
+// This returns zero time if the override is never changed after t.
+func (so *scheduledOverride) nextTransition(t time.Time) time.Time {
+	if so.schedule == nil {
+		switch {
+		case t.Before(so.Start.Time):
+			return so.Start.Time
+		case t.Before(so.End.Time):
+			return so.End.Time
+		}
+		return time.Time{}
+	}
+	next := so.schedule.next(t.In(so.location))
+	// the window started in (t - duration, t] ends in the future
+	duration := time.Duration(so.DurationMinutes) * time.Minute
+	if start := so.schedule.next(t.In(so.location).Add(-duration)); !start.IsZero() && !start.After(t) {
+		if end := start.Add(duration); next.IsZero() || end.Before(next) {
+			next = end
+		}
+	}
+	return next
+}
+
+// nextScheduledOverrideTransition returns the earliest transition of the overrides after t.
+// This returns zero time if no override is changed after t.
+func nextScheduledOverrideTransition(sos []*scheduledOverride, t time.Time) time.Time {
+	var next time.Time
+	for _, so := range sos {
+		if tr := so.nextTransition(t); !tr.IsZero() && (next.IsZero() || tr.Before(next)) {
+			next = tr
+		}
+	}
+	return next
+}
+
+// activeScheduledOverrides returns overrides active at t.
+func activeScheduledOverrides(sos []*scheduledOverride, t time.Time) []*scheduledOverride {
+	var active []*scheduledOverride
+	for _, so := range sos {
+		if so.activeAt(t) {
+			active = append(active, so)
+		}
+	}
+	return active
+}
+
+// overrideMinReplicas returns the largest MinReplicas of the overrides.
+// This returns 0 if no override has MinReplicas.
+func overrideMinReplicas(sos []*scheduledOverride) int32 {
+	var min int32
+	for _, so := range sos {
+		if so.MinReplicas != nil && *so.MinReplicas > min {
+			min = *so.MinReplicas
+		}
+	}
+	return min
+}
+
+// overrideForecastMultiplier returns the largest ForecastMultiplier of the overrides.
+// This returns 1 if no override has ForecastMultiplier.
+func overrideForecastMultiplier(sos []*scheduledOverride) float64 {
+	var multiplier float64
+	for _, so := range sos {
+		if so.multiplier > multiplier {
+			multiplier = so.multiplier
+		}
+	}
+	if multiplier == 0 {
+		return 1
+	}
+	return multiplier
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewScheduledOverride(t *testing.T) {
+	replicas := func(i int32) *int32 { return &i }(10)
+	multiplier := resource.MustParse("1.5")
+	start := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		override  ihpav1beta2.ScheduledOverride
+		expectErr bool
+	}{
+		{override: ihpav1beta2.ScheduledOverride{Schedule: "0 20 * * *", DurationMinutes: 60, TimeZone: "Asia/Tokyo", MinReplicas: replicas}},
+		{override: ihpav1beta2.ScheduledOverride{Start: &start, End: &end, ForecastMultiplier: &multiplier}},
+		{override: ihpav1beta2.ScheduledOverride{Schedule: "0 20 * * *", MinReplicas: replicas}, expectErr: true},
+		{override: ihpav1beta2.ScheduledOverride{Schedule: "0 20 * * *", DurationMinutes: 60, Start: &start, End: &end, MinReplicas: replicas}, expectErr: true},
+		{override: ihpav1beta2.ScheduledOverride{Start: &end, End: &start, MinReplicas: replicas}, expectErr: true},
+		{override: ihpav1beta2.ScheduledOverride{Start: &start, MinReplicas: replicas}, expectErr: true},
+		{override: ihpav1beta2.ScheduledOverride{Schedule: "0 20 * * *", DurationMinutes: 60, TimeZone: "Unknown/Zone", MinReplicas: replicas}, expectErr: true},
+		{override: ihpav1beta2.ScheduledOverride{Schedule: "0 20 * * *", DurationMinutes: 60}, expectErr: true},
+	}
+
+	for i, tt := range tests {
+		_, err := newScheduledOverride(&tt.override)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("error is not match (case=%d, err=%v, expectErr=%v)", i, err, tt.expectErr)
+		}
+	}
+}
+
+func TestScheduledOverrideActiveAt(t *testing.T) {
+	start := metav1.NewTime(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC))
+	overrides, err := newScheduledOverrides([]ihpav1beta2.ScheduledOverride{
+		{
+			// 20:00-21:00 JST = 11:00-12:00 UTC
+			Name:            "tv",
+			Schedule:        "0 20 * * *",
+			DurationMinutes: 60,
+			TimeZone:        "Asia/Tokyo",
+			MinReplicas:     func(i int32) *int32 { return &i }(10),
+		},
+		{
+			Name:               "campaign",
+			Start:              &start,
+			End:                &end,
+			MinReplicas:        func(i int32) *int32 { return &i }(5),
+			ForecastMultiplier: func(q resource.Quantity) *resource.Quantity { return &q }(resource.MustParse("1.5")),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		t                  time.Time
+		expectedNames      []string
+		expectedReplicas   int32
+		expectedMultiplier float64
+	}{
+		{t: time.Date(2020, 1, 1, 10, 59, 0, 0, time.UTC), expectedMultiplier: 1},
+		{t: time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC), expectedNames: []string{"tv"}, expectedReplicas: 10, expectedMultiplier: 1},
+		{t: time.Date(2020, 1, 1, 11, 59, 59, 0, time.UTC), expectedNames: []string{"tv"}, expectedReplicas: 10, expectedMultiplier: 1},
+		{t: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), expectedNames: []string{"campaign"}, expectedReplicas: 5, expectedMultiplier: 1.5},
+		{t: time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC), expectedMultiplier: 1},
+		{t: time.Date(2020, 1, 2, 11, 30, 0, 0, time.UTC), expectedNames: []string{"tv"}, expectedReplicas: 10, expectedMultiplier: 1},
+	}
+
+	for _, tt := range tests {
+		active := activeScheduledOverrides(overrides, tt.t)
+		var names []string
+		for _, o := range active {
+			names = append(names, o.Name)
+		}
+		if len(names) != len(tt.expectedNames) || (len(names) != 0 && names[0] != tt.expectedNames[0]) {
+			t.Fatalf("active overrides are not match (time=%v, got=%v, exp=%v)", tt.t, names, tt.expectedNames)
+		}
+		if got := overrideMinReplicas(active); got != tt.expectedReplicas {
+			t.Fatalf("minReplicas is not match (time=%v, got=%d, exp=%d)", tt.t, got, tt.expectedReplicas)
+		}
+		if got := overrideForecastMultiplier(active); got != tt.expectedMultiplier {
+			t.Fatalf("multiplier is not match (time=%v, got=%v, exp=%v)", tt.t, got, tt.expectedMultiplier)
+		}
+	}
+}
+
+func TestNextScheduledOverrideTransition(t *testing.T) {
+	start := metav1.NewTime(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC))
+	overrides, err := newScheduledOverrides([]ihpav1beta2.ScheduledOverride{
+		{
+			// 20:00-21:00 JST = 11:00-12:00 UTC
+			Name:            "tv",
+			Schedule:        "0 20 * * *",
+			DurationMinutes: 60,
+			TimeZone:        "Asia/Tokyo",
+			MinReplicas:     func(i int32) *int32 { return &i }(10),
+		},
+		{
+			Name:        "campaign",
+			Start:       &start,
+			End:         &end,
+			MinReplicas: func(i int32) *int32 { return &i }(5),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		t        time.Time
+		expected time.Time
+	}{
+		{t: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), expected: time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{t: time.Date(2020, 1, 1, 11, 30, 0, 0, time.UTC), expected: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{t: time.Date(2020, 1, 1, 12, 30, 0, 0, time.UTC), expected: time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{t: time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC), expected: time.Date(2020, 1, 2, 11, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := nextScheduledOverrideTransition(overrides, tt.t); !got.Equal(tt.expected) {
+			t.Fatalf("next transition is not match (time=%v, got=%v, exp=%v)", tt.t, got, tt.expected)
+		}
+	}
+	if got := nextScheduledOverrideTransition(nil, start.Time); !got.IsZero() {
+		t.Fatalf("next transition should be zero (got=%v)", got)
+	}
+}
@@ -2,10 +2,9 @@ package controllers
 
 import (
 	"fmt"
-	"math/rand"
 	"strings"
-	"time"
 
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/metricprovider"
 	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -38,24 +37,21 @@ func replaceStrings(s string, m map[string]string) string {
 
 // extractScopedMetricInfo extracts name and target information of the metric.
 func extractScopedMetricInfo(metric *autoscalingv2beta2.MetricSpec) (string, *autoscalingv2beta2.MetricTarget) {
-	var name string
+	name := "unknown_metric"
 	var target *autoscalingv2beta2.MetricTarget
-	switch metric.Type {
-	case "Resource":
+	switch {
+	case metric.Type == "Resource" && metric.Resource != nil:
 		name = metric.Resource.Name.String()
 		target = metric.Resource.Target.DeepCopy()
-	case "Object":
+	case metric.Type == "Object" && metric.Object != nil:
 		name = metric.Object.Metric.Name
 		target = metric.Object.Target.DeepCopy()
-	case "Pods":
+	case metric.Type == "Pods" && metric.Pods != nil:
 		name = metric.Pods.Metric.Name
 		target = metric.Pods.Target.DeepCopy()
-	case "External":
+	case metric.Type == "External" && metric.External != nil:
 		name = metric.External.Metric.Name
 		target = metric.External.Target.DeepCopy()
-	default:
-		name = "unknown_metric"
-		target = nil
 	}
 	return name, target
 }
@@ -69,6 +65,36 @@ func generateMetricUniqueFilter(kubeSystemUID, namespace, kind, name string) map
 	}
 }
 
+// scopedMetricIdentifier returns a metric identifier of which selector is scoped by filters.
+// The name is converted by provider dependent identifier mi. If mi is nil, the name is used as it is
+// because Pods and Object metrics are usually custom metrics stored with the same name.
+func scopedMetricIdentifier(
+	metric *autoscalingv2beta2.MetricIdentifier,
+	mi metricprovider.MetricIdentifier,
+	filters map[string]string,
+) *autoscalingv2beta2.MetricIdentifier {
+	name := metric.Name
+	if mi != nil {
+		name = mi.GetName()
+	}
+
+	labels := make(map[string]string, len(filters))
+	if metric.Selector != nil {
+		for k, v := range metric.Selector.MatchLabels {
+			labels[k] = v
+		}
+	}
+	// filters take priority over selector to keep the metric scoped
+	for k, v := range filters {
+		labels[k] = v
+	}
+
+	return &autoscalingv2beta2.MetricIdentifier{
+		Name:     name,
+		Selector: &metav1.LabelSelector{MatchLabels: labels},
+	}
+}
+
 // totalResourceList sum up all requests of all containers.
 func totalResourceList(containers []corev1.Container) *corev1.ResourceList {
 	resourceLists := make([]corev1.ResourceList, 0, len(containers))
@@ -99,6 +125,38 @@ func sumUpResourceLists(resourceLists []corev1.ResourceList) *corev1.ResourceLis
 	return &baserl
 }
 
+// containsString checks whether s is contained in slice.
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns a copy of slice which s is removed from.
+func removeString(slice []string, s string) []string {
+	result := make([]string, 0, len(slice))
+	for _, v := range slice {
+		if v != s {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// addIHPALabel add the label of IHPA name to dependent.
+// This label is used for listing resources generated from the IHPA.
+func addIHPALabel(ihpaName string, dependent metav1.Object) {
+	labels := dependent.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string, 1)
+	}
+	labels[ihpaNameLabel] = ihpaName
+	dependent.SetLabels(labels)
+}
+
 // addOwnerReference add owner reference to dependent.
 func addOwnerReference(ownerTypeMeta *metav1.TypeMeta, ownerObjectMeta *metav1.ObjectMeta, dependent metav1.Object) {
 	if ownerTypeMeta == nil || ownerObjectMeta == nil || dependent == nil {
@@ -117,13 +175,12 @@ func addOwnerReference(ownerTypeMeta *metav1.TypeMeta, ownerObjectMeta *metav1.O
 	dependent.SetOwnerReferences(ownerReferences)
 }
 
-// randomMinuteCronFormat return cron format that is set specified hour
-// (it means daily execution) and randomized minute.
-func randomMinuteCronFormat(hour int) string {
+// dailyCronFormat returns cron format that is executed daily on the specified hour
+// with the delay in minutes. The delay over the day is wrapped around.
+func dailyCronFormat(hour, delayMinutes int) string {
 	if hour < 0 {
 		hour = 0
 	}
-	hour %= 24
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%d %d * * *", rand.Intn(60), hour)
+	minutes := (hour%24*60 + delayMinutes) % (24 * 60)
+	return fmt.Sprintf("%d %d * * *", minutes%60, minutes/60)
 }
@@ -1,10 +1,7 @@
 package controllers
 
 import (
-	"fmt"
 	"reflect"
-	"strconv"
-	"strings"
 	"testing"
 
 	ihpav1beta1 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta1"
@@ -477,50 +474,40 @@ func TestAddOwnerReference(t *testing.T) {
 	}
 }
 
-func TestRandomMinuteCronFormat(t *testing.T) {
+func TestDailyCronFormat(t *testing.T) {
 	tests := []struct {
-		hour     int
-		expected string
+		hour         int
+		delayMinutes int
+		expected     string
 	}{
 		{
 			hour:     0,
-			expected: "* 0 * * *",
+			expected: "0 0 * * *",
 		},
 		{
 			hour:     100,
-			expected: "* 4 * * *",
+			expected: "0 4 * * *",
+		},
+		{
+			hour:         10,
+			delayMinutes: 59,
+			expected:     "59 10 * * *",
 		},
 		{
-			hour:     10,
-			expected: "* 10 * * *",
+			hour:         -10,
+			delayMinutes: 30,
+			expected:     "30 0 * * *",
 		},
 		{
-			hour:     -10,
-			expected: "* 0 * * *",
+			hour:         23,
+			delayMinutes: 90,
+			expected:     "30 0 * * *",
 		},
 	}
 
 	for _, tt := range tests {
-		got := randomMinuteCronFormat(tt.hour)
-
-		var err error
-		got, err = testReplaceCronMinuteSectionToAny(t, got)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		if got != tt.expected {
+		if got := dailyCronFormat(tt.hour, tt.delayMinutes); got != tt.expected {
 			t.Fatalf("cron format is not match (got=%s, exp=%s)", got, tt.expected)
 		}
 	}
 }
-
-func testReplaceCronMinuteSectionToAny(t *testing.T, cronFormat string) (string, error) {
-	t.Helper()
-	// remove random minute section
-	if _, err := strconv.Atoi(strings.SplitN(cronFormat, " ", 2)[0]); err != nil {
-		return "", fmt.Errorf("cron minute section is not valid (not applied random): %s", cronFormat)
-	}
-	// overwrite minute section by *
-	return "* " + strings.SplitN(cronFormat, " ", 2)[1], nil
-}
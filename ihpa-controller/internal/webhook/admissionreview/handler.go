@@ -0,0 +1,94 @@
+package admissionreview
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Handler serves AdmissionReview of admission.k8s.io/v1 with the webhook of controller-runtime,
+// which decodes only admission.k8s.io/v1beta1.
+// AdmissionRequest and AdmissionResponse have the same fields in both versions, so they are
+// converted through JSON. Requests of admission.k8s.io/v1beta1 are passed to the webhook as they are.
+type Handler struct {
+	Webhook *admission.Webhook
+}
+
+// NewHandler returns Handler of the webhook.
+func NewHandler(wh *admission.Webhook) *Handler {
+	return &Handler{Webhook: wh}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		http.Error(w, "request body is empty", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode admission review: %s", err), http.StatusBadRequest)
+		return
+	}
+	if review.APIVersion != admissionv1.SchemeGroupVersion.String() {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.Webhook.ServeHTTP(w, r)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "admission request is empty", http.StatusBadRequest)
+		return
+	}
+
+	req := admission.Request{}
+	if err := convert(review.Request, &req.AdmissionRequest); err != nil {
+		http.Error(w, fmt.Sprintf("failed to convert admission request: %s", err), http.StatusBadRequest)
+		return
+	}
+	resp := h.Webhook.Handle(r.Context(), req)
+
+	out := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Response: &admissionv1.AdmissionResponse{},
+	}
+	if err := convert(&resp.AdmissionResponse, out.Response); err != nil {
+		http.Error(w, fmt.Sprintf("failed to convert admission response: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&out); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode admission review: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// InjectFunc passes the dependencies injected by the webhook server to the webhook.
+func (h *Handler) InjectFunc(f inject.Func) error {
+	return f(h.Webhook)
+}
+
+// InjectLogger passes the logger injected by the webhook server to the webhook.
+func (h *Handler) InjectLogger(l logr.Logger) error {
+	return h.Webhook.InjectLogger(l)
+}
+
+// convert copies src into dst of the other version through JSON.
+func convert(src, dst interface{}) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
@@ -0,0 +1,80 @@
+package admissionreview
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(&admission.Webhook{
+		Handler: admission.HandlerFunc(func(ctx context.Context, req admission.Request) admission.Response {
+			if req.Name == "denied" {
+				return admission.Denied("denied")
+			}
+			return admission.Allowed("")
+		}),
+	})
+	if err := h.InjectLogger(logf.Log.WithName("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		apiVersion      string
+		name            string
+		expectedAllowed bool
+	}{
+		{apiVersion: "admission.k8s.io/v1", name: "allowed", expectedAllowed: true},
+		{apiVersion: "admission.k8s.io/v1", name: "denied", expectedAllowed: false},
+		{apiVersion: "admission.k8s.io/v1beta1", name: "allowed", expectedAllowed: true},
+	}
+
+	for _, tt := range tests {
+		body, err := json.Marshal(map[string]interface{}{
+			"apiVersion": tt.apiVersion,
+			"kind":       "AdmissionReview",
+			"request":    map[string]interface{}{"uid": "uid", "name": tt.name, "operation": "CREATE"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status code is not match (got=%d, exp=%d)", rec.Code, http.StatusOK)
+		}
+
+		var allowed bool
+		var uid string
+		if tt.apiVersion == admissionv1.SchemeGroupVersion.String() {
+			var review admissionv1.AdmissionReview
+			if err := json.Unmarshal(rec.Body.Bytes(), &review); err != nil {
+				t.Fatal(err)
+			}
+			// admission.k8s.io/v1 requires the type of the response
+			if review.APIVersion != tt.apiVersion || review.Kind != "AdmissionReview" {
+				t.Fatalf("apiVersion/kind is not match (got=%s/%s, exp=%s/AdmissionReview)", review.APIVersion, review.Kind, tt.apiVersion)
+			}
+			allowed, uid = review.Response.Allowed, string(review.Response.UID)
+		} else {
+			var review admissionv1beta1.AdmissionReview
+			if err := json.Unmarshal(rec.Body.Bytes(), &review); err != nil {
+				t.Fatal(err)
+			}
+			allowed, uid = review.Response.Allowed, string(review.Response.UID)
+		}
+		if allowed != tt.expectedAllowed || uid != "uid" {
+			t.Fatalf("response is not match (apiVersion=%s, got=%v/%s, exp=%v/%s)", tt.apiVersion, allowed, uid, tt.expectedAllowed, "uid")
+		}
+	}
+}
@@ -22,14 +22,20 @@ import (
 	"os"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/scale"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	ihpav1beta1 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta1"
 	ihpav1beta2 "github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/api/v1beta2"
 	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/estimatorstate"
+	"github.com/cyberagent-oss/intelligent-hpa/ihpa-controller/controllers/externalmetrics"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,9 +55,24 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var externalMetricsAddr string
+	var externalMetricsCertDir string
+	var estimatorStateStore string
+	var estimatorStateDir string
+	var estimatorWorkers int
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&externalMetricsAddr, "external-metrics-addr", "",
+		"The address the built-in external metrics server binds to. The server is disabled if this is empty.")
+	flag.StringVar(&externalMetricsCertDir, "external-metrics-cert-dir", externalmetrics.DefaultCertDir,
+		"The directory that contains the serving certificate (tls.crt and tls.key) of the external metrics server.")
+	flag.StringVar(&estimatorStateStore, "estimator-state-store", "configmap",
+		"The backend to checkpoint the state of estimators (configmap, file or none).")
+	flag.StringVar(&estimatorStateDir, "estimator-state-dir", "/var/lib/ihpa/estimator-state",
+		"The directory to store the state of estimators when --estimator-state-store=file.")
+	flag.IntVar(&estimatorWorkers, "estimator-workers", controllers.DefaultEstimateWorkers,
+		"The number of workers which send forecasted metrics of estimators concurrently.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -68,18 +89,116 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.IntelligentHorizontalPodAutoscalerReconciler{
+	var externalMetricStore *externalmetrics.Store
+	if externalMetricsAddr != "" {
+		externalMetricStore = externalmetrics.NewStore()
+		authorizationClient, err := authorizationv1client.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "unable to create authorization client")
+			os.Exit(1)
+		}
+		if err = mgr.Add(&externalmetrics.Server{
+			Store:                externalMetricStore,
+			BindAddress:          externalMetricsAddr,
+			CertDir:              externalMetricsCertDir,
+			APIReader:            mgr.GetAPIReader(),
+			SubjectAccessReviews: authorizationClient.SubjectAccessReviews(),
+			Log:                  ctrl.Log.WithName("externalmetrics"),
+		}); err != nil {
+			setupLog.Error(err, "unable to add external metrics server")
+			os.Exit(1)
+		}
+	}
+
+	var stateStore estimatorstate.Store
+	switch estimatorStateStore {
+	case "configmap":
+		stateStore = estimatorstate.NewConfigMapStore(mgr.GetClient())
+	case "file":
+		if stateStore, err = estimatorstate.NewFileStore(estimatorStateDir); err != nil {
+			setupLog.Error(err, "unable to create estimator state store")
+			os.Exit(1)
+		}
+	case "none":
+	default:
+		setupLog.Info("unknown estimator state store", "store", estimatorStateStore)
+		os.Exit(1)
+	}
+
+	// discoveryClient selects the versions of generated HPAs and CronJobs, and
+	// scaleClient resolves scale targets which are not apps workloads
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create discovery client")
+		os.Exit(1)
+	}
+	hpaAPIVersion, err := controllers.DiscoverHPAAPIVersion(discoveryClient)
+	if err != nil {
+		setupLog.Error(err, "unable to discover api version of HorizontalPodAutoscaler")
+		os.Exit(1)
+	}
+	setupLog.Info("discovered api version of HorizontalPodAutoscaler", "apiVersion", hpaAPIVersion)
+	cronJobAPIVersion, err := controllers.DiscoverCronJobAPIVersion(discoveryClient)
+	if err != nil {
+		setupLog.Error(err, "unable to discover api version of CronJob")
+		os.Exit(1)
+	}
+	setupLog.Info("discovered api version of CronJob", "apiVersion", cronJobAPIVersion)
+	cronJobTimeZone, err := controllers.DiscoverCronJobTimeZone(discoveryClient, cronJobAPIVersion)
+	if err != nil {
+		setupLog.Error(err, "unable to discover time zone support of CronJob")
+		os.Exit(1)
+	}
+	setupLog.Info("discovered time zone support of CronJob", "timeZone", cronJobTimeZone)
+	scaleClient, err := scale.NewForConfig(
+		mgr.GetConfig(),
+		mgr.GetRESTMapper(),
+		dynamic.LegacyAPIPathResolverFunc,
+		scale.NewDiscoveryScaleKindResolver(discoveryClient),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create scale client")
+		os.Exit(1)
+	}
+
+	// forecastSnapshots is written by estimators and read for IHPA status
+	forecastSnapshots := controllers.NewForecastSnapshotStore()
+	estimatorStatusReporter := &controllers.EstimatorStatusReporter{
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("EstimatorStatus"),
+		Snapshots: forecastSnapshots,
+		Interval:  controllers.EstimatorStatusReportInterval,
+	}
+	if err = mgr.Add(estimatorStatusReporter); err != nil {
+		setupLog.Error(err, "unable to add estimator status reporter")
+		os.Exit(1)
+	}
+
+	ihpaReconciler := &controllers.IntelligentHorizontalPodAutoscalerReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("IntelligentHorizontalPodAutoscaler"),
 		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+
+		Recorder:          mgr.GetEventRecorderFor("intelligenthorizontalpodautoscaler-controller"),
+		ForecastSnapshots: forecastSnapshots,
+		HPAAPIVersion:     hpaAPIVersion,
+		RESTMapper:        mgr.GetRESTMapper(),
+		ScaleClient:       scaleClient,
+		APIReader:         mgr.GetAPIReader(),
+		CacheReader:       mgr.GetCache(),
+	}
+	if err = ihpaReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IntelligentHorizontalPodAutoscaler")
 		os.Exit(1)
 	}
 	if err = (&controllers.FittingJobReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("FittingJob"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("FittingJob"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("fittingjob-controller"),
+
+		CronJobAPIVersion: cronJobAPIVersion,
+		CronJobTimeZone:   cronJobTimeZone,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "FittingJob")
 		os.Exit(1)
@@ -88,10 +207,34 @@ func main() {
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("Estimator"),
 		Scheme: mgr.GetScheme(),
+
+		Recorder:            mgr.GetEventRecorderFor("estimator-controller"),
+		ExternalMetricStore: externalMetricStore,
+		ForecastSnapshots:   forecastSnapshots,
+		StatusReporter:      estimatorStatusReporter,
+		StateStore:          stateStore,
+		Workers:             estimatorWorkers,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Estimator")
 		os.Exit(1)
 	}
+	// Webhook server needs serving certificates, so it can be disabled for running the manager locally.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&ihpav1beta2.IntelligentHorizontalPodAutoscaler{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "IntelligentHorizontalPodAutoscaler")
+			os.Exit(1)
+		}
+		if err = (&controllers.IntelligentHorizontalPodAutoscalerValidator{
+			Reconciler: ihpaReconciler,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "IntelligentHorizontalPodAutoscalerValidator")
+			os.Exit(1)
+		}
+		if err = (&ihpav1beta2.FittingJob{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "FittingJob")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 	//go func() {
 	//	log.Println(http.ListenAndServe("0.0.0.0:6060", nil))